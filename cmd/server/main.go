@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,26 +11,64 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/shellcraft/server/internal/config"
 	"github.com/shellcraft/server/internal/server"
 )
 
 func main() {
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "4242"
+	// Load configuration: defaults, config file, environment, then flags
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	printConfig := flags.Bool("print-config", false, "print the effective configuration as YAML and exit")
+	cfg, err := config.Load(flags, os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *printConfig {
+		out, err := cfg.YAML()
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+
+	// Containers are adopted or reaped by instance label, so it has to be
+	// unique to this server
+	if cfg.Instance == config.DefaultInstance {
+		log.Printf("WARNING: no instance configured; labelling containers %q. "+
+			"If several servers share this Docker host, give each a unique, stable "+
+			"instance (SHELLCRAFT_INSTANCE) or they will remove each other's containers.", cfg.Instance)
 	}
 
 	// Create server instance
-	srv := server.New()
+	srv := server.New(cfg)
+
+	// Adopt containers from a previous run and reap orphans
+	if _, err := srv.CleanupZombieContainers(); err != nil {
+		log.Printf("Container reconciliation failed: %v", err)
+	}
 
-	// Start cleanup manager (check every 5 minutes, timeout after 15 minutes)
-	srv.StartCleanup(5 * time.Minute)
+	srv.StartCleanupWithTimeout(time.Duration(cfg.Cleanup.Interval), time.Duration(cfg.Cleanup.IdleTimeout))
 	defer srv.StopCleanup()
 
+	// Re-read the Docker host's resources so capacity follows changes to it
+	srv.StartCapacityRefresh(time.Duration(cfg.Capacity.RefreshInterval))
+	defer srv.StopCapacityRefresh()
+
+	// Keep containers ready for new sessions if a pool size is configured
+	srv.StartWarmPool(cfg.Pool.Size, cfg.Pool.Prestart)
+	defer srv.StopWarmPool()
+
+	// Sum container resource usage for the metrics unless disabled
+	if interval := time.Duration(cfg.Metrics.StatsInterval); interval > 0 {
+		srv.StartStatsCollection(interval)
+		defer srv.StopStatsCollection()
+	}
+
 	// Create HTTP server
 	httpServer := &http.Server{
-		Addr:         fmt.Sprintf(":%s", port),
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
 		Handler:      srv.Router(),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
@@ -38,7 +77,7 @@ func main() {
 
 	// Start server in goroutine
 	go func() {
-		log.Printf("Starting ShellCraft server on port %s", port)
+		log.Printf("Starting ShellCraft server on port %d", cfg.Port)
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
@@ -51,6 +90,16 @@ func main() {
 
 	log.Println("Shutting down server...")
 
+	// Warn players, let their games save and remove their containers (or
+	// keep them for the next start) while the HTTP server still carries
+	// their terminals
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), time.Duration(cfg.Shutdown.Warning+cfg.Shutdown.Timeout))
+	defer drainCancel()
+
+	if err := srv.Shutdown(drainCtx); err != nil {
+		log.Printf("Not every session was ended: %v", err)
+	}
+
 	// Graceful shutdown with 30 second timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
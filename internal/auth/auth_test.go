@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigner_IssueAndVerify(t *testing.T) {
+	s := NewSigner(NewKey(), time.Hour)
+
+	token, expires := s.Issue("session-1")
+	if d := time.Until(expires); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("expected expiry in an hour, got %v", expires)
+	}
+	if err := s.Verify(token, "session-1"); err != nil {
+		t.Errorf("expected valid token, got %v", err)
+	}
+}
+
+func TestSigner_RejectsBadTokens(t *testing.T) {
+	s := NewSigner(NewKey(), time.Hour)
+	token, _ := s.Issue("session-1")
+	other, _ := NewSigner(NewKey(), time.Hour).Issue("session-1")
+
+	// Swap the subject but keep the signature
+	dot := strings.Index(token, ".")
+	forged := "session-2" + token[dot:]
+
+	tests := map[string]string{
+		"other subject": token,
+		"other key":     other,
+		"forged":        forged,
+		"empty":         "",
+		"no signature":  "session-1.9999999999",
+		"truncated":     token[:len(token)-1],
+	}
+	for name, bad := range tests {
+		subject := "session-1"
+		if name == "other subject" || name == "forged" {
+			subject = "session-2"
+		}
+		if err := s.Verify(bad, subject); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func TestSigner_Expires(t *testing.T) {
+	s := NewSigner(NewKey(), time.Minute)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	token, _ := s.Issue("session-1")
+
+	now = now.Add(2 * time.Minute)
+	if err := s.Verify(token, "session-1"); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("expected ErrExpiredToken, got %v", err)
+	}
+}
+
+func TestLoadOrCreateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.key")
+
+	key, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey failed: %v", err)
+	}
+	if len(key) != KeySize {
+		t.Errorf("expected %d byte key, got %d", KeySize, len(key))
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("expected key file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	// Tokens survive a restart that reloads the key
+	again, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey failed: %v", err)
+	}
+	token, _ := NewSigner(key, time.Hour).Issue("session-1")
+	if err := NewSigner(again, time.Hour).Verify(token, "session-1"); err != nil {
+		t.Errorf("expected token valid with reloaded key, got %v", err)
+	}
+
+	os.WriteFile(path, []byte("abcd\n"), 0600)
+	if _, err := LoadOrCreateKey(path); err == nil {
+		t.Error("expected error for short key")
+	}
+}
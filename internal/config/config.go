@@ -0,0 +1,697 @@
+// Package config loads the server's settings from a YAML file, environment
+// variables and command-line flags
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/netip"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the server's configuration
+type Config struct {
+	Port          int    `yaml:"port"`
+	Image         string `yaml:"image"`          // default game image
+	Instance      string `yaml:"instance"`       // labels our containers; must be stable across restarts
+	SessionFile   string `yaml:"session_file"`   // on-disk session store (in-memory if empty)
+	VaultDir      string `yaml:"vault_dir"`      // soul vault (disabled if empty)
+	RecordingsDir string `yaml:"recordings_dir"` // session recordings (disabled if empty)
+
+	// Games is the catalog of images players may start. If empty, only
+	// Image is allowed.
+	Games []GameConfig `yaml:"games,omitempty"`
+
+	// Profiles are named resource profiles games may offer besides their
+	// default. Each overrides container field by field.
+	Profiles map[string]ProfileConfig `yaml:"profiles,omitempty"`
+
+	Container ProfileConfig   `yaml:"container"` // default resource profile
+	Security  SecurityConfig  `yaml:"security"`
+	Capacity  CapacityConfig  `yaml:"capacity"`
+	Cleanup   CleanupConfig   `yaml:"cleanup"`
+	Pool      PoolConfig      `yaml:"pool"`
+	Queue     QueueConfig     `yaml:"queue"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Admin     AdminConfig     `yaml:"admin"`
+	Shutdown  ShutdownConfig  `yaml:"shutdown"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+}
+
+// GameConfig is a catalog entry: an image players may start
+type GameConfig struct {
+	Image       string          `yaml:"image"`
+	Name        string          `yaml:"name,omitempty"` // defaults to the image
+	Description string          `yaml:"description,omitempty"`
+	Resources   *ProfileConfig  `yaml:"resources,omitempty"` // default profile; overrides container
+	Security    *SecurityConfig `yaml:"security,omitempty"`  // overrides security
+	Profiles    []string        `yaml:"profiles,omitempty"`  // named profiles sessions may pick instead
+}
+
+// ProfileConfig is the resources a game container may use
+type ProfileConfig struct {
+	MemoryMB  int64   `yaml:"memory_mb"`            // hard limit
+	SwapMB    int64   `yaml:"swap_mb,omitempty"`    // swap on top of memory_mb
+	CPUShares int64   `yaml:"cpu_shares"`           // relative CPU weight (1024 = one full share)
+	CPUs      float64 `yaml:"cpus,omitempty"`       // CPU quota
+	PidsLimit int64   `yaml:"pids_limit,omitempty"` // overrides security.pids_limit
+	DiskMB    int64   `yaml:"disk_mb,omitempty"`    // writable layer size (overlay2 on xfs with pquota)
+	TmpfsMB   int64   `yaml:"tmpfs_mb,omitempty"`   // size of tmpfs mounts that don't set one
+	Runtime   string  `yaml:"runtime,omitempty"`    // OCI runtime such as runsc
+}
+
+// SecurityConfig hardens game containers against the player's shell
+type SecurityConfig struct {
+	NetworkMode     string                  `yaml:"network_mode"` // "none" cuts containers off from every network
+	PidsLimit       int64                   `yaml:"pids_limit"`   // guards against fork bombs
+	CapDrop         []string                `yaml:"cap_drop"`
+	CapAdd          []string                `yaml:"cap_add"` // added back after cap_drop
+	NoNewPrivileges bool                    `yaml:"no_new_privileges"`
+	ReadOnlyRootfs  bool                    `yaml:"read_only_rootfs"`
+	Tmpfs           map[string]string       `yaml:"tmpfs,omitempty"` // mount point to options; writable space on a read-only rootfs
+	Ulimits         map[string]UlimitConfig `yaml:"ulimits,omitempty"`
+}
+
+// UlimitConfig is a soft and hard resource limit
+type UlimitConfig struct {
+	Soft int64 `yaml:"soft"`
+	Hard int64 `yaml:"hard"`
+}
+
+// CapacityConfig controls how many sessions the server admits
+type CapacityConfig struct {
+	FallbackSessions int      `yaml:"fallback_sessions"` // limit when host resources can't be read
+	ReserveMemoryMB  int64    `yaml:"reserve_memory_mb"` // host memory kept back from sessions
+	ReserveCPUs      float64  `yaml:"reserve_cpus"`      // host CPUs kept back from sessions
+	RefreshInterval  Duration `yaml:"refresh_interval"`  // how often host resources are re-read
+}
+
+// CleanupConfig controls idle session cleanup
+type CleanupConfig struct {
+	Interval    Duration `yaml:"interval"`
+	IdleTimeout Duration `yaml:"idle_timeout"`
+}
+
+// PoolConfig controls the warm container pool
+type PoolConfig struct {
+	Size     int  `yaml:"size"` // disabled if 0
+	Prestart bool `yaml:"prestart"`
+}
+
+// QueueConfig controls the waiting room
+type QueueConfig struct {
+	MaxLength int `yaml:"max_length"`
+}
+
+// RateLimitConfig throttles clients, identified by IP address
+type RateLimitConfig struct {
+	SessionsPerMinute    float64  `yaml:"sessions_per_minute"` // POST /session; 0 disables
+	SessionBurst         int      `yaml:"session_burst"`
+	ConnectsPerMinute    float64  `yaml:"connects_per_minute"` // WebSocket connects; 0 disables
+	ConnectBurst         int      `yaml:"connect_burst"`
+	MaxSessionsPerClient int      `yaml:"max_sessions_per_client"`   // including queued requests; 0 for no cap
+	TrustedProxies       []string `yaml:"trusted_proxies,omitempty"` // IPs or CIDRs whose X-Forwarded-For is believed
+}
+
+// AuthConfig controls session access tokens
+type AuthConfig struct {
+	KeyFile  string   `yaml:"key_file"`  // signing key, created if missing; random per start if empty (required with session_file)
+	TokenTTL Duration `yaml:"token_ttl"` // how long an access token is valid
+}
+
+// AdminConfig controls the operator API under /admin
+type AdminConfig struct {
+	TokenFile string `yaml:"token_file"` // holds the admin bearer token; the API is disabled if empty
+	AuditLog  string `yaml:"audit_log"`  // JSON lines file of admin actions; the server log if empty
+}
+
+// What shutdown does with running sessions
+const (
+	ShutdownEndSessions  = "end"  // warn players, save souls and remove containers
+	ShutdownKeepSessions = "keep" // leave containers running for the next start to adopt
+)
+
+// ShutdownConfig controls how sessions are ended when the server shuts down
+type ShutdownConfig struct {
+	Sessions string   `yaml:"sessions"` // "end" or "keep"; if empty, keep when session_file is set
+	Warning  Duration `yaml:"warning"`  // countdown shown to players before their sessions end
+	Timeout  Duration `yaml:"timeout"`  // after the warning, to save souls and remove containers
+}
+
+// KeepSessionsOnShutdown reports whether shutdown leaves session containers
+// running for the next start to adopt rather than ending them
+func (c *Config) KeepSessionsOnShutdown() bool {
+	if c.Shutdown.Sessions == "" {
+		return c.SessionFile != ""
+	}
+	return c.Shutdown.Sessions == ShutdownKeepSessions
+}
+
+// MetricsConfig controls the container resource totals in the metrics
+type MetricsConfig struct {
+	StatsInterval Duration `yaml:"stats_interval"` // how often container stats are summed; 0 disables
+}
+
+// ParseTrustedProxies returns the trusted proxies as prefixes; a bare IP is
+// a single-address prefix
+func (rc RateLimitConfig) ParseTrustedProxies() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range rc.TrustedProxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Duration is a time.Duration written as a string such as "5m" in config files
+type Duration time.Duration
+
+// UnmarshalYAML parses a duration string
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalYAML writes the duration as a string
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+// DefaultInstance labels game containers when no instance is configured. It
+// stays the same across restarts and redeploys, so containers from a previous
+// run are always found again, but servers sharing a Docker host must each
+// set their own instance or they will remove each other's containers.
+const DefaultInstance = "shellcraft"
+
+// Default returns the configuration used when nothing is overridden
+func Default() *Config {
+	return &Config{
+		Port:     4242,
+		Image:    "shellcraft/game:latest",
+		Instance: DefaultInstance,
+		Container: ProfileConfig{
+			MemoryMB:  50,
+			CPUShares: 512, // 50% CPU priority
+		},
+		Security: SecurityConfig{
+			NetworkMode: "none",
+			PidsLimit:   128,
+			CapDrop:     []string{"ALL"},
+			// The game image's entrypoint runs crond as root and su's to the
+			// player; the dungeon master edits files the player owns
+			CapAdd:          []string{"CHOWN", "DAC_OVERRIDE", "FOWNER", "SETGID", "SETUID"},
+			NoNewPrivileges: true,
+			Ulimits: map[string]UlimitConfig{
+				"core":   {Soft: 0, Hard: 0},
+				"nofile": {Soft: 1024, Hard: 1024},
+			},
+		},
+		Capacity: CapacityConfig{
+			// With 3GB available and 50MB per container, safe limit is ~40 players
+			FallbackSessions: 40,
+			ReserveMemoryMB:  512,
+			ReserveCPUs:      0.25,
+			RefreshInterval:  Duration(time.Minute),
+		},
+		Cleanup: CleanupConfig{
+			Interval:    Duration(5 * time.Minute),
+			IdleTimeout: Duration(15 * time.Minute),
+		},
+		Queue: QueueConfig{
+			MaxLength: 100,
+		},
+		RateLimit: RateLimitConfig{
+			SessionsPerMinute:    10,
+			SessionBurst:         5,
+			ConnectsPerMinute:    60,
+			ConnectBurst:         20,
+			MaxSessionsPerClient: 3,
+		},
+		Auth: AuthConfig{
+			TokenTTL: Duration(24 * time.Hour),
+		},
+		Shutdown: ShutdownConfig{
+			Warning: Duration(30 * time.Second),
+			Timeout: Duration(time.Minute),
+		},
+		Metrics: MetricsConfig{
+			StatsInterval: Duration(30 * time.Second),
+		},
+	}
+}
+
+// Load builds the configuration from defaults, then the config file named by
+// -config or SHELLCRAFT_CONFIG, then environment variables, then flags, and
+// validates the result. The config flags are added to fs, which is parsed
+// with args.
+func Load(fs *flag.FlagSet, args []string, getenv func(string) string) (*Config, error) {
+	path := fs.String("config", getenv("SHELLCRAFT_CONFIG"), "path to a YAML config file")
+
+	// Flags are applied last, so record them while parsing and replay them
+	var overrides []func(*Config) error
+	for _, st := range settings {
+		record := func(value string) error {
+			overrides = append(overrides, func(c *Config) error {
+				if err := st.apply(c, value); err != nil {
+					return fmt.Errorf("-%s: %w", st.flag, err)
+				}
+				return nil
+			})
+			return nil
+		}
+		if st.boolean {
+			fs.BoolFunc(st.flag, st.usage, record)
+		} else {
+			fs.Func(st.flag, st.usage, record)
+		}
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, st := range settings {
+		value := getenv(st.env)
+		if value == "" {
+			continue
+		}
+		if err := st.apply(cfg, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", st.env, err)
+		}
+	}
+
+	for _, override := range overrides {
+		if err := override(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile reads a YAML config file over the current values. Unknown keys
+// are an error so typos don't go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	// Profiles, and a game's resources and security, override the top-level
+	// ones field by field, so decode them again over a copy of those
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	if profiles := mappingValue(doc.Content[0], "profiles"); profiles != nil && profiles.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(profiles.Content); i += 2 {
+			profile := c.Container
+			if err := profiles.Content[i+1].Decode(&profile); err != nil {
+				return fmt.Errorf("invalid config file %s: %w", path, err)
+			}
+			c.Profiles[profiles.Content[i].Value] = profile
+		}
+	}
+	games := mappingValue(doc.Content[0], "games")
+	if games == nil || games.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for i, entry := range games.Content {
+		if node := mappingValue(entry, "resources"); node != nil {
+			resources := c.Container
+			if err := node.Decode(&resources); err != nil {
+				return fmt.Errorf("invalid config file %s: %w", path, err)
+			}
+			c.Games[i].Resources = &resources
+		}
+		if node := mappingValue(entry, "security"); node != nil {
+			security := c.Security.clone()
+			if err := node.Decode(&security); err != nil {
+				return fmt.Errorf("invalid config file %s: %w", path, err)
+			}
+			c.Games[i].Security = &security
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in a YAML mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// clone returns a copy that shares no slices or maps with sc
+func (sc SecurityConfig) clone() SecurityConfig {
+	sc.CapDrop = slices.Clone(sc.CapDrop)
+	sc.CapAdd = slices.Clone(sc.CapAdd)
+	sc.Tmpfs = maps.Clone(sc.Tmpfs)
+	sc.Ulimits = maps.Clone(sc.Ulimits)
+	return sc
+}
+
+// Validate reports every setting that is out of range
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Port > 0 && c.Port < 65536, "port must be between 1 and 65535, got %d", c.Port)
+	check(c.Image != "", "image must be set")
+	check(c.Instance != "", "instance must be set")
+	// Docker's minimums
+	c.Container.validate("container", check)
+	c.Security.validate("security", check)
+	for name, profile := range c.Profiles {
+		profile.validate("profiles."+name, check)
+	}
+	check(c.Capacity.FallbackSessions > 0, "capacity.fallback_sessions must be positive, got %d", c.Capacity.FallbackSessions)
+	check(c.Capacity.ReserveMemoryMB >= 0, "capacity.reserve_memory_mb must not be negative, got %d", c.Capacity.ReserveMemoryMB)
+	check(c.Capacity.ReserveCPUs >= 0, "capacity.reserve_cpus must not be negative, got %g", c.Capacity.ReserveCPUs)
+	check(c.Capacity.RefreshInterval > 0, "capacity.refresh_interval must be positive, got %v", time.Duration(c.Capacity.RefreshInterval))
+	check(c.Cleanup.Interval > 0, "cleanup.interval must be positive, got %v", time.Duration(c.Cleanup.Interval))
+	check(c.Cleanup.IdleTimeout > 0, "cleanup.idle_timeout must be positive, got %v", time.Duration(c.Cleanup.IdleTimeout))
+	check(c.Pool.Size >= 0, "pool.size must not be negative, got %d", c.Pool.Size)
+	check(c.Queue.MaxLength >= 0, "queue.max_length must not be negative, got %d", c.Queue.MaxLength)
+	c.RateLimit.validate(check)
+	check(c.Auth.TokenTTL > 0, "auth.token_ttl must be positive, got %v", time.Duration(c.Auth.TokenTTL))
+	check(c.SessionFile == "" || c.Auth.KeyFile != "",
+		"session_file requires auth.key_file, or the sessions it keeps can't be reached after a restart")
+	check(c.Shutdown.Sessions == "" || c.Shutdown.Sessions == ShutdownEndSessions || c.Shutdown.Sessions == ShutdownKeepSessions,
+		"shutdown.sessions must be %q or %q, got %q", ShutdownEndSessions, ShutdownKeepSessions, c.Shutdown.Sessions)
+	check(c.Shutdown.Sessions != ShutdownKeepSessions || c.SessionFile != "",
+		"shutdown.sessions %q requires session_file, or the next start can't adopt them", ShutdownKeepSessions)
+	check(c.Shutdown.Warning >= 0, "shutdown.warning must not be negative, got %v", time.Duration(c.Shutdown.Warning))
+	check(c.Shutdown.Timeout > 0, "shutdown.timeout must be positive, got %v", time.Duration(c.Shutdown.Timeout))
+	check(c.Metrics.StatsInterval >= 0, "metrics.stats_interval must not be negative, got %v", time.Duration(c.Metrics.StatsInterval))
+
+	if len(c.Games) > 0 {
+		seen := make(map[string]bool)
+		for i, game := range c.Games {
+			check(game.Image != "", "games[%d].image must be set", i)
+			check(!seen[game.Image], "games[%d].image %q is listed twice", i, game.Image)
+			seen[game.Image] = true
+			if game.Resources != nil {
+				game.Resources.validate(fmt.Sprintf("games[%d].resources", i), check)
+			}
+			if game.Security != nil {
+				game.Security.validate(fmt.Sprintf("games[%d].security", i), check)
+			}
+			for _, name := range game.Profiles {
+				_, exists := c.Profiles[name]
+				check(exists, "games[%d].profiles: no profile named %q", i, name)
+			}
+		}
+		check(seen[c.Image], "image %q must be one of the games", c.Image)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// validate checks the limits against Docker's minimums
+func (pc ProfileConfig) validate(field string, check func(bool, string, ...interface{})) {
+	check(pc.MemoryMB >= 6, "%s.memory_mb must be at least 6, got %d", field, pc.MemoryMB)
+	check(pc.CPUShares >= 2, "%s.cpu_shares must be at least 2, got %d", field, pc.CPUShares)
+	check(pc.SwapMB >= 0, "%s.swap_mb must not be negative, got %d", field, pc.SwapMB)
+	check(pc.CPUs >= 0, "%s.cpus must not be negative, got %g", field, pc.CPUs)
+	check(pc.PidsLimit >= 0, "%s.pids_limit must not be negative, got %d", field, pc.PidsLimit)
+	check(pc.DiskMB >= 0, "%s.disk_mb must not be negative, got %d", field, pc.DiskMB)
+	check(pc.TmpfsMB >= 0, "%s.tmpfs_mb must not be negative, got %d", field, pc.TmpfsMB)
+}
+
+// validate checks the rates are sane and the trusted proxies parse
+func (rc RateLimitConfig) validate(check func(bool, string, ...interface{})) {
+	check(rc.SessionsPerMinute >= 0, "rate_limit.sessions_per_minute must not be negative, got %g", rc.SessionsPerMinute)
+	check(rc.SessionsPerMinute == 0 || rc.SessionBurst > 0, "rate_limit.session_burst must be positive, got %d", rc.SessionBurst)
+	check(rc.ConnectsPerMinute >= 0, "rate_limit.connects_per_minute must not be negative, got %g", rc.ConnectsPerMinute)
+	check(rc.ConnectsPerMinute == 0 || rc.ConnectBurst > 0, "rate_limit.connect_burst must be positive, got %d", rc.ConnectBurst)
+	check(rc.MaxSessionsPerClient >= 0, "rate_limit.max_sessions_per_client must not be negative, got %d", rc.MaxSessionsPerClient)
+	_, err := rc.ParseTrustedProxies()
+	check(err == nil, "rate_limit.trusted_proxies: %v", err)
+}
+
+// validate checks the profile is complete and its limits are sane
+func (sc SecurityConfig) validate(field string, check func(bool, string, ...interface{})) {
+	check(sc.NetworkMode != "", "%s.network_mode must be set", field)
+	check(sc.PidsLimit > 0, "%s.pids_limit must be positive, got %d", field, sc.PidsLimit)
+	for mount := range sc.Tmpfs {
+		check(path.IsAbs(mount), "%s.tmpfs mount point %q must be absolute", field, mount)
+	}
+	for name, u := range sc.Ulimits {
+		check(u.Soft >= 0 && u.Soft <= u.Hard, "%s.ulimits.%s must have 0 <= soft <= hard, got %d/%d", field, name, u.Soft, u.Hard)
+	}
+}
+
+// Catalog returns the games players may start, with names, resources and
+// security defaulted. Without configured games it holds just the default image.
+func (c *Config) Catalog() []GameConfig {
+	games := c.Games
+	if len(games) == 0 {
+		games = []GameConfig{{
+			Image:       c.Image,
+			Name:        "ShellCraft",
+			Description: "A fantasy-themed UNIX shell RPG",
+		}}
+	}
+
+	catalog := make([]GameConfig, len(games))
+	for i, game := range games {
+		if game.Name == "" {
+			game.Name = game.Image
+		}
+		if game.Resources == nil {
+			resources := c.Container
+			game.Resources = &resources
+		}
+		if game.Security == nil {
+			security := c.Security.clone()
+			game.Security = &security
+		}
+		catalog[i] = game
+	}
+	return catalog
+}
+
+// YAML returns the configuration as a config file
+func (c *Config) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// setting is a value that can be overridden by an environment variable and a flag
+type setting struct {
+	env     string
+	flag    string
+	usage   string
+	boolean bool
+	apply   func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{env: "PORT", flag: "port", usage: "HTTP server port", apply: func(c *Config, v string) error {
+		return parseInt(v, &c.Port)
+	}},
+	{env: "SHELLCRAFT_IMAGE", flag: "image", usage: "Docker image for game containers", apply: func(c *Config, v string) error {
+		c.Image = v
+		return nil
+	}},
+	{env: "SHELLCRAFT_INSTANCE", flag: "instance", usage: "instance label on game containers", apply: func(c *Config, v string) error {
+		c.Instance = v
+		return nil
+	}},
+	{env: "SHELLCRAFT_SESSION_FILE", flag: "session-file", usage: "persist sessions to this JSON file", apply: func(c *Config, v string) error {
+		c.SessionFile = v
+		return nil
+	}},
+	{env: "SHELLCRAFT_VAULT_DIR", flag: "vault-dir", usage: "save souls between sessions in this directory", apply: func(c *Config, v string) error {
+		c.VaultDir = v
+		return nil
+	}},
+	{env: "SHELLCRAFT_RECORDINGS_DIR", flag: "recordings-dir", usage: "save opt-in session recordings in this directory", apply: func(c *Config, v string) error {
+		c.RecordingsDir = v
+		return nil
+	}},
+	{env: "SHELLCRAFT_CONTAINER_MEMORY_MB", flag: "container-memory-mb", usage: "memory limit of each game container", apply: func(c *Config, v string) error {
+		return parseInt(v, &c.Container.MemoryMB)
+	}},
+	{env: "SHELLCRAFT_CONTAINER_CPU_SHARES", flag: "container-cpu-shares", usage: "CPU shares of each game container", apply: func(c *Config, v string) error {
+		return parseInt(v, &c.Container.CPUShares)
+	}},
+	{env: "SHELLCRAFT_MAX_SESSIONS", flag: "max-sessions", usage: "session limit when host resources can't be read", apply: func(c *Config, v string) error {
+		return parseInt(v, &c.Capacity.FallbackSessions)
+	}},
+	{env: "SHELLCRAFT_RESERVE_MEMORY_MB", flag: "reserve-memory-mb", usage: "host memory kept back from game sessions", apply: func(c *Config, v string) error {
+		return parseInt(v, &c.Capacity.ReserveMemoryMB)
+	}},
+	{env: "SHELLCRAFT_RESERVE_CPUS", flag: "reserve-cpus", usage: "host CPUs kept back from game sessions", apply: func(c *Config, v string) error {
+		return parseFloat(v, &c.Capacity.ReserveCPUs)
+	}},
+	{env: "SHELLCRAFT_CAPACITY_REFRESH", flag: "capacity-refresh", usage: "how often host resources are re-read", apply: func(c *Config, v string) error {
+		return parseDuration(v, &c.Capacity.RefreshInterval)
+	}},
+	{env: "SHELLCRAFT_CLEANUP_INTERVAL", flag: "cleanup-interval", usage: "how often idle sessions are cleaned up", apply: func(c *Config, v string) error {
+		return parseDuration(v, &c.Cleanup.Interval)
+	}},
+	{env: "SHELLCRAFT_IDLE_TIMEOUT", flag: "idle-timeout", usage: "how long a session may be idle before cleanup", apply: func(c *Config, v string) error {
+		return parseDuration(v, &c.Cleanup.IdleTimeout)
+	}},
+	{env: "SHELLCRAFT_POOL_SIZE", flag: "pool-size", usage: "warm containers kept ready for new sessions", apply: func(c *Config, v string) error {
+		return parseInt(v, &c.Pool.Size)
+	}},
+	{env: "SHELLCRAFT_POOL_PRESTART", flag: "pool-prestart", usage: "start and attach warm containers", boolean: true, apply: func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		c.Pool.Prestart = b
+		return nil
+	}},
+	{env: "SHELLCRAFT_QUEUE_LENGTH", flag: "queue-length", usage: "clients the waiting room holds", apply: func(c *Config, v string) error {
+		return parseInt(v, &c.Queue.MaxLength)
+	}},
+	{env: "SHELLCRAFT_SESSION_RATE", flag: "session-rate", usage: "sessions each client may create per minute (0 disables)", apply: func(c *Config, v string) error {
+		return parseFloat(v, &c.RateLimit.SessionsPerMinute)
+	}},
+	{env: "SHELLCRAFT_SESSION_BURST", flag: "session-burst", usage: "sessions each client may create at once", apply: func(c *Config, v string) error {
+		return parseInt(v, &c.RateLimit.SessionBurst)
+	}},
+	{env: "SHELLCRAFT_CONNECT_RATE", flag: "connect-rate", usage: "WebSocket connects per client per minute (0 disables)", apply: func(c *Config, v string) error {
+		return parseFloat(v, &c.RateLimit.ConnectsPerMinute)
+	}},
+	{env: "SHELLCRAFT_CONNECT_BURST", flag: "connect-burst", usage: "WebSocket connects each client may make at once", apply: func(c *Config, v string) error {
+		return parseInt(v, &c.RateLimit.ConnectBurst)
+	}},
+	{env: "SHELLCRAFT_MAX_SESSIONS_PER_CLIENT", flag: "max-sessions-per-client", usage: "concurrent sessions per client (0 for no cap)", apply: func(c *Config, v string) error {
+		return parseInt(v, &c.RateLimit.MaxSessionsPerClient)
+	}},
+	{env: "SHELLCRAFT_TRUSTED_PROXIES", flag: "trusted-proxies", usage: "comma-separated proxy IPs or CIDRs whose X-Forwarded-For is believed", apply: func(c *Config, v string) error {
+		c.RateLimit.TrustedProxies = nil
+		for _, proxy := range strings.Split(v, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				c.RateLimit.TrustedProxies = append(c.RateLimit.TrustedProxies, proxy)
+			}
+		}
+		return nil
+	}},
+	{env: "SHELLCRAFT_KEY_FILE", flag: "key-file", usage: "signing key for session access tokens (created if missing)", apply: func(c *Config, v string) error {
+		c.Auth.KeyFile = v
+		return nil
+	}},
+	{env: "SHELLCRAFT_TOKEN_TTL", flag: "token-ttl", usage: "how long session access tokens are valid", apply: func(c *Config, v string) error {
+		return parseDuration(v, &c.Auth.TokenTTL)
+	}},
+	{env: "SHELLCRAFT_ADMIN_TOKEN_FILE", flag: "admin-token-file", usage: "file holding the bearer token for the admin API (disabled if unset)", apply: func(c *Config, v string) error {
+		c.Admin.TokenFile = v
+		return nil
+	}},
+	{env: "SHELLCRAFT_AUDIT_LOG", flag: "audit-log", usage: "file admin actions are appended to (the server log if unset)", apply: func(c *Config, v string) error {
+		c.Admin.AuditLog = v
+		return nil
+	}},
+	{env: "SHELLCRAFT_SHUTDOWN_SESSIONS", flag: "shutdown-sessions", usage: `what shutdown does with running sessions: "end" or "keep" (default: keep if --session-file is set)`, apply: func(c *Config, v string) error {
+		c.Shutdown.Sessions = v
+		return nil
+	}},
+	{env: "SHELLCRAFT_SHUTDOWN_WARNING", flag: "shutdown-warning", usage: "countdown shown to players before shutdown ends their sessions", apply: func(c *Config, v string) error {
+		return parseDuration(v, &c.Shutdown.Warning)
+	}},
+	{env: "SHELLCRAFT_SHUTDOWN_TIMEOUT", flag: "shutdown-timeout", usage: "how long shutdown may take to save souls and remove containers after the warning", apply: func(c *Config, v string) error {
+		return parseDuration(v, &c.Shutdown.Timeout)
+	}},
+	{env: "SHELLCRAFT_STATS_INTERVAL", flag: "stats-interval", usage: "how often container stats are summed for the metrics (0 disables)", apply: func(c *Config, v string) error {
+		return parseDuration(v, &c.Metrics.StatsInterval)
+	}},
+}
+
+func parseInt[T int | int64](value string, dst *T) error {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", value)
+	}
+	*dst = T(n)
+	return nil
+}
+
+func parseFloat(value string, dst *float64) error {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", value)
+	}
+	*dst = n
+	return nil
+}
+
+func parseDuration(value string, dst *Duration) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", value)
+	}
+	*dst = Duration(d)
+	return nil
+}
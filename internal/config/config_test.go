@@ -0,0 +1,390 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// load runs Load with the given args and environment
+func load(t *testing.T, args []string, env map[string]string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	return Load(fs, args, func(key string) string { return env[key] })
+}
+
+// writeConfig writes a config file and returns its path
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "shellcraft.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := load(t, nil, nil)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("expected defaults, got %+v", cfg)
+	}
+	if cfg.Port != 4242 || cfg.Container.MemoryMB != 50 || cfg.Capacity.FallbackSessions != 40 || cfg.Instance != DefaultInstance {
+		t.Errorf("unexpected defaults %+v", cfg)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeConfig(t, `
+port: 8080
+image: shellcraft/game:v2
+container:
+  memory_mb: 64
+cleanup:
+  idle_timeout: 30m
+pool:
+  size: 2
+`)
+
+	cfg, err := load(t,
+		[]string{"-config", path, "-pool-size", "5", "-pool-prestart"},
+		map[string]string{"PORT": "9090", "SHELLCRAFT_POOL_SIZE": "3"},
+	)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// File over defaults
+	if cfg.Image != "shellcraft/game:v2" || cfg.Container.MemoryMB != 64 {
+		t.Errorf("expected file values, got image %q memory %d", cfg.Image, cfg.Container.MemoryMB)
+	}
+	if time.Duration(cfg.Cleanup.IdleTimeout) != 30*time.Minute {
+		t.Errorf("expected idle timeout 30m, got %v", time.Duration(cfg.Cleanup.IdleTimeout))
+	}
+	// Untouched defaults survive a partial file
+	if cfg.Container.CPUShares != 512 {
+		t.Errorf("expected default cpu shares, got %d", cfg.Container.CPUShares)
+	}
+	// Environment over file
+	if cfg.Port != 9090 {
+		t.Errorf("expected port from environment, got %d", cfg.Port)
+	}
+	// Flags over environment
+	if cfg.Pool.Size != 5 || !cfg.Pool.Prestart {
+		t.Errorf("expected pool from flags, got %+v", cfg.Pool)
+	}
+}
+
+func TestLoad_ConfigFileFromEnvironment(t *testing.T) {
+	path := writeConfig(t, "port: 8080\n")
+
+	cfg, err := load(t, nil, map[string]string{"SHELLCRAFT_CONFIG": path})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Port != 8080 {
+		t.Errorf("expected port 8080, got %d", cfg.Port)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{name: "unknown key", file: "container:\n  memory: 64\n", want: "field memory not found"},
+		{name: "bad duration", file: "cleanup:\n  interval: soon\n", want: "line 2"},
+		{name: "missing file", args: []string{"-config", "/nonexistent/shellcraft.yaml"}, want: "failed to open config file"},
+		{name: "bad env value", env: map[string]string{"SHELLCRAFT_POOL_SIZE": "lots"}, want: "SHELLCRAFT_POOL_SIZE"},
+		{name: "bad flag value", args: []string{"-idle-timeout", "forever"}, want: "-idle-timeout"},
+		{name: "out of range", args: []string{"-port", "70000"}, want: "port must be between"},
+		{name: "bad trusted proxy", env: map[string]string{"SHELLCRAFT_TRUSTED_PROXIES": "10.0.0.0/33"}, want: "rate_limit.trusted_proxies"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfig(t, tt.file)}, args...)
+			}
+
+			_, err := load(t, args, tt.env)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidate_ReportsEverySetting(t *testing.T) {
+	cfg := Default()
+	cfg.Image = ""
+	cfg.Container.MemoryMB = 1
+	cfg.Cleanup.Interval = 0
+	cfg.Shutdown.Warning = Duration(-time.Second)
+	cfg.Metrics.StatsInterval = Duration(-time.Second)
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"image", "container.memory_mb", "cleanup.interval", "shutdown.warning", "metrics.stats_interval"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %s, got %v", want, err)
+		}
+	}
+}
+
+func TestKeepSessionsOnShutdown(t *testing.T) {
+	tests := []struct {
+		sessions, sessionFile string
+		keep, valid           bool
+	}{
+		{"", "", false, true},
+		{"", "sessions.json", true, true},
+		{ShutdownEndSessions, "sessions.json", false, true},
+		{ShutdownKeepSessions, "sessions.json", true, true},
+		{ShutdownKeepSessions, "", true, false}, // nothing to adopt them by
+		{"detach", "", false, false},
+	}
+	for _, tt := range tests {
+		cfg := Default()
+		cfg.Shutdown.Sessions = tt.sessions
+		cfg.SessionFile = tt.sessionFile
+		if tt.sessionFile != "" {
+			cfg.Auth.KeyFile = "signing.key"
+		}
+		if got := cfg.KeepSessionsOnShutdown(); got != tt.keep {
+			t.Errorf("sessions %q, session file %q: expected keep %v, got %v", tt.sessions, tt.sessionFile, tt.keep, got)
+		}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("sessions %q, session file %q: unexpected validation result %v", tt.sessions, tt.sessionFile, err)
+		}
+	}
+}
+
+func TestValidate_SessionFileRequiresKeyFile(t *testing.T) {
+	cfg := Default()
+	cfg.SessionFile = "sessions.json"
+
+	// A random key per start would lock players out of the kept sessions
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "auth.key_file") {
+		t.Errorf("expected error to mention auth.key_file, got %v", err)
+	}
+
+	cfg.Auth.KeyFile = "signing.key"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected valid config, got %v", err)
+	}
+}
+
+func TestYAML_RoundTrips(t *testing.T) {
+	cfg := Default()
+	cfg.Pool.Size = 4
+	cfg.Capacity.RefreshInterval = Duration(30 * time.Second)
+
+	out, err := cfg.YAML()
+	if err != nil {
+		t.Fatalf("YAML failed: %v", err)
+	}
+	if !strings.Contains(string(out), "refresh_interval: 30s") {
+		t.Errorf("expected durations written as strings, got:\n%s", out)
+	}
+
+	loaded, err := load(t, []string{"-config", writeConfig(t, string(out))}, nil)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("expected %+v, got %+v", cfg, loaded)
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	cfg := Default()
+	if games := cfg.Catalog(); len(games) != 1 || games[0].Image != cfg.Image || games[0].Resources.MemoryMB != 50 {
+		t.Errorf("expected only the default image, got %+v", games)
+	}
+
+	path := writeConfig(t, `
+image: shellcraft/game:v2
+games:
+  - image: shellcraft/game:v2
+    name: ShellCraft
+  - image: shellcraft/tutorial:v1
+    description: Learn the basics
+    resources:
+      memory_mb: 32
+      cpu_shares: 256
+`)
+	cfg, err := load(t, []string{"-config", path}, nil)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	games := cfg.Catalog()
+	if len(games) != 2 {
+		t.Fatalf("expected 2 games, got %d", len(games))
+	}
+	if games[0].Name != "ShellCraft" || games[0].Resources.CPUShares != 512 {
+		t.Errorf("expected container defaults, got %+v", games[0])
+	}
+	if games[1].Name != "shellcraft/tutorial:v1" || games[1].Resources.MemoryMB != 32 {
+		t.Errorf("expected name defaulted and own resources, got %+v", games[1])
+	}
+}
+
+func TestValidate_Games(t *testing.T) {
+	cfg := Default()
+	cfg.Games = []GameConfig{
+		{Image: "shellcraft/tutorial:v1", Resources: &ProfileConfig{MemoryMB: 1, CPUShares: 512}},
+		{Image: "shellcraft/tutorial:v1"},
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"games[0].resources.memory_mb", "listed twice", "must be one of the games"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got %v", want, err)
+		}
+	}
+}
+
+func TestCatalog_GameOverridesSecurityFieldByField(t *testing.T) {
+	path := writeConfig(t, `
+games:
+  - image: shellcraft/game:latest
+  - image: shellcraft/arena:v1
+    resources:
+      memory_mb: 96
+    security:
+      read_only_rootfs: true
+      tmpfs:
+        /tmp: size=16m
+`)
+	cfg, err := load(t, []string{"-config", path}, nil)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	games := cfg.Catalog()
+	if !reflect.DeepEqual(*games[0].Security, cfg.Security) {
+		t.Errorf("expected default security, got %+v", games[0].Security)
+	}
+
+	arena := games[1]
+	if arena.Resources.MemoryMB != 96 || arena.Resources.CPUShares != 512 {
+		t.Errorf("expected memory overridden and cpu shares kept, got %+v", arena.Resources)
+	}
+	sec := arena.Security
+	if !sec.ReadOnlyRootfs || sec.Tmpfs["/tmp"] != "size=16m" {
+		t.Errorf("expected read-only rootfs with tmpfs, got %+v", sec)
+	}
+	if sec.NetworkMode != "none" || sec.PidsLimit != 128 || !sec.NoNewPrivileges || len(sec.Ulimits) != 2 {
+		t.Errorf("expected other settings from the defaults, got %+v", sec)
+	}
+	if cfg.Security.ReadOnlyRootfs || cfg.Security.Tmpfs != nil {
+		t.Error("game override leaked into the default security profile")
+	}
+}
+
+func TestValidate_Security(t *testing.T) {
+	cfg := Default()
+	cfg.Security.PidsLimit = 0
+	cfg.Security.Tmpfs = map[string]string{"tmp": ""}
+	cfg.Security.Ulimits["nofile"] = UlimitConfig{Soft: 2048, Hard: 1024}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"security.pids_limit", "must be absolute", "security.ulimits.nofile"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got %v", want, err)
+		}
+	}
+}
+
+func TestCatalog_Profiles(t *testing.T) {
+	path := writeConfig(t, `
+container:
+  memory_mb: 64
+profiles:
+  large:
+    memory_mb: 256
+    cpus: 1.5
+  sandboxed:
+    runtime: runsc
+    disk_mb: 512
+games:
+  - image: shellcraft/game:latest
+    profiles: [large, sandboxed]
+  - image: shellcraft/tutorial:v1
+`)
+	cfg, err := load(t, []string{"-config", path}, nil)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if large := cfg.Profiles["large"]; large.MemoryMB != 256 || large.CPUs != 1.5 || large.CPUShares != 512 {
+		t.Errorf("expected large profile over container defaults, got %+v", large)
+	}
+	if sandboxed := cfg.Profiles["sandboxed"]; sandboxed.Runtime != "runsc" || sandboxed.DiskMB != 512 || sandboxed.MemoryMB != 64 {
+		t.Errorf("expected sandboxed profile over container defaults, got %+v", sandboxed)
+	}
+
+	games := cfg.Catalog()
+	if !reflect.DeepEqual(games[0].Profiles, []string{"large", "sandboxed"}) || len(games[1].Profiles) != 0 {
+		t.Errorf("unexpected game profiles %v and %v", games[0].Profiles, games[1].Profiles)
+	}
+}
+
+func TestValidate_Profiles(t *testing.T) {
+	cfg := Default()
+	cfg.Profiles = map[string]ProfileConfig{
+		"broken": {MemoryMB: 64, CPUShares: 512, CPUs: -1, SwapMB: -1},
+	}
+	cfg.Games = []GameConfig{{Image: cfg.Image, Profiles: []string{"broken", "huge"}}}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"profiles.broken.cpus", "profiles.broken.swap_mb", `no profile named "huge"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got %v", want, err)
+		}
+	}
+}
+
+func TestRateLimit_TrustedProxies(t *testing.T) {
+	cfg, err := load(t, nil, map[string]string{"SHELLCRAFT_TRUSTED_PROXIES": "10.0.0.1, 172.16.0.0/12,,fd00::/8"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	prefixes, err := cfg.RateLimit.ParseTrustedProxies()
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies failed: %v", err)
+	}
+	var got []string
+	for _, prefix := range prefixes {
+		got = append(got, prefix.String())
+	}
+	if want := []string{"10.0.0.1/32", "172.16.0.0/12", "fd00::/8"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
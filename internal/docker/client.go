@@ -1,11 +1,23 @@
 package docker
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
+	cerrdefs "github.com/containerd/errdefs"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
 )
 
@@ -16,14 +28,113 @@ type AttachResult struct {
 	Resize func(height, width uint) error
 }
 
+// Labels applied to every game container so the server can find its own
+// containers again after a restart
+const (
+	LabelManaged  = "shellcraft.managed"
+	LabelInstance = "shellcraft.instance"
+	LabelSession  = "shellcraft.session"
+	LabelPool     = "shellcraft.pool" // created for the warm pool, before any session
+)
+
+// ContainerInfo is a summary of a container returned by ListContainers
+type ContainerInfo struct {
+	ID     string
+	Image  string
+	State  string
+	Labels map[string]string
+}
+
+// ResourceProfile is the resources a game container may use
+type ResourceProfile struct {
+	MemoryBytes int64   // hard limit
+	SwapBytes   int64   // swap on top of MemoryBytes; 0 disables swap
+	CPUShares   int64   // relative CPU weight (1024 = one full share)
+	CPUs        float64 // CPU quota; 0 for none
+	PidsLimit   int64   // overrides the security profile's limit if set
+	DiskBytes   int64   // writable layer size; needs a storage driver that supports it
+	TmpfsBytes  int64   // size of tmpfs mounts that don't set one
+	Runtime     string  // OCI runtime such as "runsc"; Docker's default if empty
+}
+
+// SecurityProfile hardens a game container against the player's shell
+type SecurityProfile struct {
+	NetworkMode     string // "none" cuts the container off from every network
+	PidsLimit       int64  // guards against fork bombs; 0 for unlimited
+	CapDrop         []string
+	CapAdd          []string // added back after CapDrop
+	NoNewPrivileges bool
+	ReadOnlyRootfs  bool
+	Tmpfs           map[string]string // mount point to mount options; writable space on a read-only rootfs
+	Volumes         []string          // mount points given a fresh anonymous volume, removed with the container
+	Ulimits         []Ulimit
+}
+
+// PathUnder reports whether p is mount or inside it. Files under a tmpfs
+// can't be copied in or out of a container that isn't running, as the tmpfs
+// only exists while it runs; files under a volume can.
+func PathUnder(p, mount string) bool {
+	mount = strings.TrimSuffix(mount, "/")
+	return p == mount || strings.HasPrefix(p, mount+"/")
+}
+
+// Ulimit is a resource limit applied to every process in a container
+type Ulimit struct {
+	Name string
+	Soft int64
+	Hard int64
+}
+
+// HostResources describes the resources of the machine the Docker daemon runs on
+type HostResources struct {
+	MemoryBytes int64
+	CPUs        int
+}
+
+// ErrContainerNotFound is returned when a container does not exist
+var ErrContainerNotFound = errors.New("container not found")
+
+// ErrFileNotFound is returned when copying a path that does not exist in a container
+var ErrFileNotFound = errors.New("file not found in container")
+
+// ContainerState describes a container's runtime state as reported by inspect
+type ContainerState struct {
+	Status     string    `json:"status"` // created, running, paused, restarting, removing, exited or dead
+	Running    bool      `json:"running"`
+	OOMKilled  bool      `json:"oom_killed"`
+	ExitCode   int       `json:"exit_code"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+// ContainerStats is a snapshot of a container's resource usage. Network and
+// block I/O are totals since the container started.
+type ContainerStats struct {
+	MemoryUsageBytes uint64  `json:"memory_usage_bytes"` // without reclaimable page cache
+	MemoryLimitBytes uint64  `json:"memory_limit_bytes"`
+	CPUPercent       float64 `json:"cpu_percent"` // of one CPU, so may exceed 100
+	PIDs             uint64  `json:"pids"`
+	NetworkRxBytes   uint64  `json:"network_rx_bytes"`
+	NetworkTxBytes   uint64  `json:"network_tx_bytes"`
+	BlockReadBytes   uint64  `json:"block_read_bytes"`
+	BlockWriteBytes  uint64  `json:"block_write_bytes"`
+}
+
 // Client is an interface for Docker operations
 type Client interface {
+	HostResources(ctx context.Context) (*HostResources, error)
 	ListImages(ctx context.Context) ([]string, error)
-	CreateContainer(ctx context.Context, imageName string, config *container.Config) (string, error)
+	ListContainers(ctx context.Context, labels map[string]string) ([]ContainerInfo, error)
+	CreateContainer(ctx context.Context, imageName string, config *container.Config, resources ResourceProfile, security SecurityProfile) (string, error)
 	StartContainer(ctx context.Context, containerID string) error
+	InspectContainer(ctx context.Context, containerID string) (*ContainerState, error)
+	WaitContainer(ctx context.Context, containerID string) (*ContainerState, error)
 	StopContainer(ctx context.Context, containerID string) error
 	RemoveContainer(ctx context.Context, containerID string) error
 	AttachContainer(ctx context.Context, containerID string) (*AttachResult, error)
+	CopyFromContainer(ctx context.Context, containerID, filePath string) ([]byte, error)
+	CopyToContainer(ctx context.Context, containerID, filePath string, data []byte, uid, gid int) error
+	Stats(ctx context.Context, containerID string) (*ContainerStats, error)
 	Close() error
 }
 
@@ -57,8 +168,59 @@ func (d *DockerClient) ListImages(ctx context.Context) ([]string, error) {
 	return imageNames, nil
 }
 
-// CreateContainer creates a new container from an image with resource limits
-func (d *DockerClient) CreateContainer(ctx context.Context, imageName string, config *container.Config) (string, error) {
+// HostResources returns the memory and CPUs the Docker daemon reports
+func (d *DockerClient) HostResources(ctx context.Context) (*HostResources, error) {
+	info, err := d.cli.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &HostResources{
+		MemoryBytes: info.MemTotal,
+		CPUs:        info.NCPU,
+	}, nil
+}
+
+// NewGameContainerConfig returns the interactive TTY config used for game containers
+func NewGameContainerConfig(imageName string, labels map[string]string) *container.Config {
+	return &container.Config{
+		Image:        imageName,
+		Tty:          true,
+		OpenStdin:    true,
+		StdinOnce:    false,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Labels:       labels,
+	}
+}
+
+// ListContainers returns all containers (running or not) carrying every given label
+func (d *DockerClient) ListContainers(ctx context.Context, labels map[string]string) ([]ContainerInfo, error) {
+	args := filters.NewArgs()
+	for key, value := range labels {
+		args.Add("label", key+"="+value)
+	}
+
+	containers, err := d.cli.ContainerList(ctx, container.ListOptions{All: true, Filters: args})
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ContainerInfo, 0, len(containers))
+	for _, c := range containers {
+		infos = append(infos, ContainerInfo{
+			ID:     c.ID,
+			Image:  c.Image,
+			State:  c.State,
+			Labels: c.Labels,
+		})
+	}
+	return infos, nil
+}
+
+// CreateContainer creates a new container from an image with a resource
+// profile and a security profile
+func (d *DockerClient) CreateContainer(ctx context.Context, imageName string, config *container.Config, resources ResourceProfile, security SecurityProfile) (string, error) {
 	// Check if image exists locally first
 	_, _, err := d.cli.ImageInspectWithRaw(ctx, imageName)
 	if err != nil {
@@ -75,37 +237,77 @@ func (d *DockerClient) CreateContainer(ctx context.Context, imageName string, co
 
 	// Use provided config or create default
 	if config == nil {
-		config = &container.Config{
-			Image:        imageName,
-			Tty:          true,
-			OpenStdin:    true,
-			StdinOnce:    false,
-			AttachStdin:  true,
-			AttachStdout: true,
-			AttachStderr: true,
-		}
+		config = NewGameContainerConfig(imageName, nil)
 	} else if config.Image == "" {
 		config.Image = imageName
 	}
 
-	// Resource limits for game containers
+	resp, err := d.cli.ContainerCreate(ctx, config, newHostConfig(resources, security), nil, nil, "")
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// newHostConfig translates a game container's resource and security profiles
+// into Docker's host config
+func newHostConfig(resources ResourceProfile, security SecurityProfile) *container.HostConfig {
 	hostConfig := &container.HostConfig{
 		Resources: container.Resources{
-			Memory:     50 * 1024 * 1024, // 50MB hard limit
-			MemorySwap: 50 * 1024 * 1024, // Disable swap (same as memory = no swap)
-			CPUShares:  512,              // 50% CPU priority
+			Memory:     resources.MemoryBytes,
+			MemorySwap: resources.MemoryBytes + resources.SwapBytes, // same as memory = no swap
+			CPUShares:  resources.CPUShares,
+			NanoCPUs:   int64(resources.CPUs * 1e9),
 		},
 		// Prevent containers from consuming excessive I/O
 		RestartPolicy: container.RestartPolicy{
 			Name: "no",
 		},
+		Runtime:        resources.Runtime,
+		NetworkMode:    container.NetworkMode(security.NetworkMode),
+		CapDrop:        security.CapDrop,
+		CapAdd:         security.CapAdd,
+		ReadonlyRootfs: security.ReadOnlyRootfs,
 	}
 
-	resp, err := d.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
-	if err != nil {
-		return "", err
+	pidsLimit := security.PidsLimit
+	if resources.PidsLimit > 0 {
+		pidsLimit = resources.PidsLimit
 	}
-	return resp.ID, nil
+	if pidsLimit > 0 {
+		hostConfig.Resources.PidsLimit = &pidsLimit
+	}
+	if resources.DiskBytes > 0 {
+		hostConfig.StorageOpt = map[string]string{"size": strconv.FormatInt(resources.DiskBytes, 10)}
+	}
+	if len(security.Tmpfs) > 0 {
+		hostConfig.Tmpfs = make(map[string]string, len(security.Tmpfs))
+		for mount, options := range security.Tmpfs {
+			if resources.TmpfsBytes > 0 && !strings.Contains(options, "size=") {
+				options = strings.TrimPrefix(options+",size="+strconv.FormatInt(resources.TmpfsBytes, 10), ",")
+			}
+			hostConfig.Tmpfs[mount] = options
+		}
+	}
+	for _, target := range security.Volumes {
+		// Populated from the image's content at that path on creation
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:   mount.TypeVolume,
+			Target: target,
+		})
+	}
+	if security.NoNewPrivileges {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "no-new-privileges:true")
+	}
+	for _, u := range security.Ulimits {
+		hostConfig.Resources.Ulimits = append(hostConfig.Resources.Ulimits, &container.Ulimit{
+			Name: u.Name,
+			Soft: u.Soft,
+			Hard: u.Hard,
+		})
+	}
+
+	return hostConfig
 }
 
 // StartContainer starts a container
@@ -113,6 +315,56 @@ func (d *DockerClient) StartContainer(ctx context.Context, containerID string) e
 	return d.cli.ContainerStart(ctx, containerID, container.StartOptions{})
 }
 
+// InspectContainer returns the runtime state of a container
+func (d *DockerClient) InspectContainer(ctx context.Context, containerID string) (*ContainerState, error) {
+	info, err := d.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrContainerNotFound, containerID)
+		}
+		return nil, err
+	}
+	if info.State == nil {
+		return nil, fmt.Errorf("container %s has no state", containerID)
+	}
+
+	return &ContainerState{
+		Status:     string(info.State.Status),
+		Running:    info.State.Running,
+		OOMKilled:  info.State.OOMKilled,
+		ExitCode:   info.State.ExitCode,
+		StartedAt:  parseDockerTime(info.State.StartedAt),
+		FinishedAt: parseDockerTime(info.State.FinishedAt),
+	}, nil
+}
+
+// WaitContainer blocks until a container is no longer running and returns its
+// final state, including the exit code and whether it was OOM-killed
+func (d *DockerClient) WaitContainer(ctx context.Context, containerID string) (*ContainerState, error) {
+	statusCh, errCh := d.cli.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if cerrdefs.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrContainerNotFound, containerID)
+		}
+		return nil, err
+	case <-statusCh:
+	}
+
+	// The wait response only carries the exit code; inspect for the OOM flag
+	return d.InspectContainer(ctx, containerID)
+}
+
+// parseDockerTime parses an inspect timestamp; Docker reports
+// "0001-01-01T00:00:00Z" for events that have not happened yet
+func parseDockerTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil || t.IsZero() {
+		return time.Time{}
+	}
+	return t
+}
+
 // StopContainer gracefully stops a container
 func (d *DockerClient) StopContainer(ctx context.Context, containerID string) error {
 	timeout := 10
@@ -121,7 +373,8 @@ func (d *DockerClient) StopContainer(ctx context.Context, containerID string) er
 
 // RemoveContainer deletes a container
 func (d *DockerClient) RemoveContainer(ctx context.Context, containerID string) error {
-	return d.cli.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true})
+	// Anonymous volumes belong to the container and go with it
+	return d.cli.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true, RemoveVolumes: true})
 }
 
 // AttachContainer attaches to a container's TTY for interactive I/O
@@ -152,6 +405,131 @@ func (d *DockerClient) AttachContainer(ctx context.Context, containerID string)
 	}, nil
 }
 
+// CopyFromContainer reads a single regular file out of a container (running or stopped)
+func (d *DockerClient) CopyFromContainer(ctx context.Context, containerID, filePath string) ([]byte, error) {
+	reader, _, err := d.cli.CopyFromContainer(ctx, containerID, filePath)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			// Distinguish a missing file from a missing container
+			if _, inspectErr := d.cli.ContainerInspect(ctx, containerID); cerrdefs.IsNotFound(inspectErr) {
+				return nil, fmt.Errorf("%w: %s", ErrContainerNotFound, containerID)
+			}
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, filePath)
+		}
+		return nil, err
+	}
+	defer reader.Close()
+
+	// The API returns a tar archive containing the requested path
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, filePath)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// CopyToContainer writes a single file into a container, owned by uid:gid
+func (d *DockerClient) CopyToContainer(ctx context.Context, containerID, filePath string, data []byte, uid, gid int) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     path.Base(filePath),
+		Mode:     0o644,
+		Size:     int64(len(data)),
+		Uid:      uid,
+		Gid:      gid,
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return d.cli.CopyToContainer(ctx, containerID, path.Dir(filePath), &buf, container.CopyToContainerOptions{})
+}
+
+// Stats returns a container's current resource usage. Docker samples the
+// container twice to work out CPU usage, so this takes a second or two.
+func (d *DockerClient) Stats(ctx context.Context, containerID string) (*ContainerStats, error) {
+	resp, err := d.cli.ContainerStats(ctx, containerID, false)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrContainerNotFound, containerID)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var stats container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("decode stats: %w", err)
+	}
+	return statsFromResponse(&stats), nil
+}
+
+// statsFromResponse summarizes a stats response the way "docker stats" does
+func statsFromResponse(resp *container.StatsResponse) *ContainerStats {
+	stats := &ContainerStats{
+		MemoryUsageBytes: resp.MemoryStats.Usage,
+		MemoryLimitBytes: resp.MemoryStats.Limit,
+		CPUPercent:       cpuPercent(resp),
+		PIDs:             resp.PidsStats.Current,
+	}
+
+	// Inactive page cache can be reclaimed, so it isn't counted as used
+	// (cgroup v2 calls it inactive_file, v1 total_inactive_file)
+	inactive, ok := resp.MemoryStats.Stats["inactive_file"]
+	if !ok {
+		inactive = resp.MemoryStats.Stats["total_inactive_file"]
+	}
+	if inactive < stats.MemoryUsageBytes {
+		stats.MemoryUsageBytes -= inactive
+	}
+
+	for _, network := range resp.Networks {
+		stats.NetworkRxBytes += network.RxBytes
+		stats.NetworkTxBytes += network.TxBytes
+	}
+	for _, entry := range resp.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			stats.BlockReadBytes += entry.Value
+		case "write":
+			stats.BlockWriteBytes += entry.Value
+		}
+	}
+	return stats
+}
+
+// cpuPercent is the container's share of the host's CPU time between the
+// two samples, scaled so one fully used CPU is 100
+func cpuPercent(resp *container.StatsResponse) float64 {
+	cpuDelta := float64(resp.CPUStats.CPUUsage.TotalUsage) - float64(resp.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(resp.CPUStats.SystemUsage) - float64(resp.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	cpus := float64(resp.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(resp.CPUStats.CPUUsage.PercpuUsage))
+	}
+	return cpuDelta / systemDelta * cpus * 100
+}
+
 // Close closes the Docker client connection
 func (d *DockerClient) Close() error {
 	return d.cli.Close()
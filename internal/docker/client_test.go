@@ -2,7 +2,14 @@ package docker
 
 import (
 	"context"
+	"errors"
+	"io"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
 )
 
 func TestMockDockerClient_ListImages(t *testing.T) {
@@ -25,7 +32,7 @@ func TestMockDockerClient_CreateContainer(t *testing.T) {
 	mock := NewMockClient()
 	ctx := context.Background()
 
-	containerID, err := mock.CreateContainer(ctx, "alpine:latest", nil)
+	containerID, err := mock.CreateContainer(ctx, "alpine:latest", nil, ResourceProfile{}, SecurityProfile{})
 	if err != nil {
 		t.Fatalf("CreateContainer failed: %v", err)
 	}
@@ -49,11 +56,122 @@ func TestMockDockerClient_CreateContainer(t *testing.T) {
 	}
 }
 
+func TestMockDockerClient_RecordsProfiles(t *testing.T) {
+	mock := NewMockClient()
+	ctx := context.Background()
+
+	resources := ResourceProfile{MemoryBytes: 64 << 20, CPUShares: 256, Runtime: "runsc"}
+	security := SecurityProfile{NetworkMode: "none", PidsLimit: 64, CapDrop: []string{"ALL"}}
+	containerID, _ := mock.CreateContainer(ctx, "alpine:latest", nil, resources, security)
+
+	c, _ := mock.GetContainer(containerID)
+	if c.Resources != resources {
+		t.Errorf("expected resources %+v, got %+v", resources, c.Resources)
+	}
+	if !reflect.DeepEqual(c.Security, security) {
+		t.Errorf("expected security %+v, got %+v", security, c.Security)
+	}
+}
+
+func TestNewHostConfig(t *testing.T) {
+	resources := ResourceProfile{MemoryBytes: 50 << 20, CPUShares: 512}
+	security := SecurityProfile{
+		NetworkMode:     "none",
+		PidsLimit:       128,
+		CapDrop:         []string{"ALL"},
+		CapAdd:          []string{"SETUID", "SETGID"},
+		NoNewPrivileges: true,
+		ReadOnlyRootfs:  true,
+		Tmpfs:           map[string]string{"/tmp": "size=16m"},
+		Volumes:         []string{"/home"},
+		Ulimits:         []Ulimit{{Name: "nofile", Soft: 1024, Hard: 1024}},
+	}
+
+	hc := newHostConfig(resources, security)
+
+	if hc.Memory != resources.MemoryBytes || hc.MemorySwap != resources.MemoryBytes || hc.CPUShares != 512 {
+		t.Errorf("unexpected resources %+v", hc.Resources)
+	}
+	if hc.NetworkMode != "none" {
+		t.Errorf("expected network mode none, got %q", hc.NetworkMode)
+	}
+	if hc.PidsLimit == nil || *hc.PidsLimit != 128 {
+		t.Errorf("expected pids limit 128, got %v", hc.PidsLimit)
+	}
+	if !reflect.DeepEqual([]string(hc.CapDrop), security.CapDrop) || !reflect.DeepEqual([]string(hc.CapAdd), security.CapAdd) {
+		t.Errorf("unexpected capabilities drop %v add %v", hc.CapDrop, hc.CapAdd)
+	}
+	if !reflect.DeepEqual(hc.SecurityOpt, []string{"no-new-privileges:true"}) {
+		t.Errorf("expected no-new-privileges, got %v", hc.SecurityOpt)
+	}
+	if !hc.ReadonlyRootfs || hc.Tmpfs["/tmp"] != "size=16m" {
+		t.Errorf("expected read-only rootfs with tmpfs, got %v %v", hc.ReadonlyRootfs, hc.Tmpfs)
+	}
+	if len(hc.Mounts) != 1 || hc.Mounts[0] != (mount.Mount{Type: mount.TypeVolume, Target: "/home"}) {
+		t.Errorf("expected an anonymous volume on /home, got %v", hc.Mounts)
+	}
+	if len(hc.Ulimits) != 1 || *hc.Ulimits[0] != (container.Ulimit{Name: "nofile", Soft: 1024, Hard: 1024}) {
+		t.Errorf("unexpected ulimits %v", hc.Ulimits)
+	}
+
+	if hc.NanoCPUs != 0 || hc.Runtime != "" || hc.StorageOpt != nil {
+		t.Errorf("expected no quota, runtime or disk limit, got %+v", hc)
+	}
+
+	// An empty profile leaves Docker's defaults alone
+	hc = newHostConfig(resources, SecurityProfile{})
+	if hc.PidsLimit != nil || hc.SecurityOpt != nil || hc.Ulimits != nil || hc.Mounts != nil {
+		t.Errorf("expected no security settings, got %+v", hc)
+	}
+}
+
+func TestNewHostConfig_ResourceProfile(t *testing.T) {
+	resources := ResourceProfile{
+		MemoryBytes: 128 << 20,
+		SwapBytes:   64 << 20,
+		CPUShares:   1024,
+		CPUs:        0.5,
+		PidsLimit:   256,
+		DiskBytes:   1 << 30,
+		TmpfsBytes:  16 << 20,
+		Runtime:     "runsc",
+	}
+	security := SecurityProfile{
+		PidsLimit: 128,
+		Tmpfs:     map[string]string{"/tmp": "", "/run": "noexec", "/var": "size=1m"},
+	}
+
+	hc := newHostConfig(resources, security)
+
+	if hc.Memory != 128<<20 || hc.MemorySwap != 192<<20 {
+		t.Errorf("expected 128MB memory with 64MB swap, got %d/%d", hc.Memory, hc.MemorySwap)
+	}
+	if hc.NanoCPUs != 500_000_000 {
+		t.Errorf("expected half a CPU, got %d", hc.NanoCPUs)
+	}
+	if hc.PidsLimit == nil || *hc.PidsLimit != 256 {
+		t.Errorf("expected the profile's pids limit, got %v", hc.PidsLimit)
+	}
+	if hc.StorageOpt["size"] != "1073741824" {
+		t.Errorf("expected disk size, got %v", hc.StorageOpt)
+	}
+	want := map[string]string{"/tmp": "size=16777216", "/run": "noexec,size=16777216", "/var": "size=1m"}
+	if !reflect.DeepEqual(hc.Tmpfs, want) {
+		t.Errorf("expected tmpfs %v, got %v", want, hc.Tmpfs)
+	}
+	if hc.Runtime != "runsc" {
+		t.Errorf("expected runsc runtime, got %q", hc.Runtime)
+	}
+	if security.Tmpfs["/tmp"] != "" {
+		t.Error("security profile's tmpfs map should not be modified")
+	}
+}
+
 func TestMockDockerClient_StartContainer(t *testing.T) {
 	mock := NewMockClient()
 	ctx := context.Background()
 
-	containerID, _ := mock.CreateContainer(ctx, "alpine:latest", nil)
+	containerID, _ := mock.CreateContainer(ctx, "alpine:latest", nil, ResourceProfile{}, SecurityProfile{})
 
 	err := mock.StartContainer(ctx, containerID)
 	if err != nil {
@@ -70,7 +188,7 @@ func TestMockDockerClient_StopContainer(t *testing.T) {
 	mock := NewMockClient()
 	ctx := context.Background()
 
-	containerID, _ := mock.CreateContainer(ctx, "alpine:latest", nil)
+	containerID, _ := mock.CreateContainer(ctx, "alpine:latest", nil, ResourceProfile{}, SecurityProfile{})
 	mock.StartContainer(ctx, containerID)
 
 	err := mock.StopContainer(ctx, containerID)
@@ -88,7 +206,7 @@ func TestMockDockerClient_RemoveContainer(t *testing.T) {
 	mock := NewMockClient()
 	ctx := context.Background()
 
-	containerID, _ := mock.CreateContainer(ctx, "alpine:latest", nil)
+	containerID, _ := mock.CreateContainer(ctx, "alpine:latest", nil, ResourceProfile{}, SecurityProfile{})
 
 	err := mock.RemoveContainer(ctx, containerID)
 	if err != nil {
@@ -106,7 +224,7 @@ func TestMockDockerClient_FullLifecycle(t *testing.T) {
 	ctx := context.Background()
 
 	// Create
-	containerID, err := mock.CreateContainer(ctx, "alpine:latest", nil)
+	containerID, err := mock.CreateContainer(ctx, "alpine:latest", nil, ResourceProfile{}, SecurityProfile{})
 	if err != nil {
 		t.Fatalf("CreateContainer failed: %v", err)
 	}
@@ -141,3 +259,274 @@ func TestMockDockerClient_FullLifecycle(t *testing.T) {
 		t.Error("container should be removed")
 	}
 }
+
+func TestMockDockerClient_ListContainers(t *testing.T) {
+	mock := NewMockClient()
+	ctx := context.Background()
+
+	labelled, _ := mock.CreateContainer(ctx, "alpine:latest",
+		NewGameContainerConfig("alpine:latest", map[string]string{LabelManaged: "true", LabelSession: "abc"}), ResourceProfile{}, SecurityProfile{})
+	mock.CreateContainer(ctx, "alpine:latest", nil, ResourceProfile{}, SecurityProfile{})
+
+	containers, err := mock.ListContainers(ctx, map[string]string{LabelManaged: "true"})
+	if err != nil {
+		t.Fatalf("ListContainers failed: %v", err)
+	}
+
+	if len(containers) != 1 {
+		t.Fatalf("expected 1 labelled container, got %d", len(containers))
+	}
+	if containers[0].ID != labelled {
+		t.Errorf("expected container %s, got %s", labelled, containers[0].ID)
+	}
+	if containers[0].Labels[LabelSession] != "abc" {
+		t.Errorf("expected session label 'abc', got %q", containers[0].Labels[LabelSession])
+	}
+
+	all, _ := mock.ListContainers(ctx, nil)
+	if len(all) != 2 {
+		t.Errorf("expected 2 containers without filter, got %d", len(all))
+	}
+}
+
+func TestMockDockerClient_InspectContainer(t *testing.T) {
+	mock := NewMockClient()
+	ctx := context.Background()
+
+	containerID, _ := mock.CreateContainer(ctx, "alpine:latest", nil, ResourceProfile{}, SecurityProfile{})
+
+	state, err := mock.InspectContainer(ctx, containerID)
+	if err != nil {
+		t.Fatalf("InspectContainer failed: %v", err)
+	}
+	if state.Status != "created" || state.Running {
+		t.Errorf("expected created state, got %+v", state)
+	}
+
+	mock.StartContainer(ctx, containerID)
+	state, _ = mock.InspectContainer(ctx, containerID)
+	if state.Status != "running" || !state.Running || state.StartedAt.IsZero() {
+		t.Errorf("expected running state with start time, got %+v", state)
+	}
+
+	mock.SimulateExit(containerID, 137, true)
+	state, _ = mock.InspectContainer(ctx, containerID)
+	if state.Status != "exited" || state.ExitCode != 137 || !state.OOMKilled {
+		t.Errorf("expected OOM-killed exit, got %+v", state)
+	}
+
+	mock.RemoveContainer(ctx, containerID)
+	if _, err := mock.InspectContainer(ctx, containerID); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("expected ErrContainerNotFound, got %v", err)
+	}
+}
+
+func TestMockDockerClient_WaitContainer(t *testing.T) {
+	mock := NewMockClient()
+	ctx := context.Background()
+
+	containerID, _ := mock.CreateContainer(ctx, "alpine:latest", nil, ResourceProfile{}, SecurityProfile{})
+	mock.StartContainer(ctx, containerID)
+	attach, _ := mock.AttachContainer(ctx, containerID)
+
+	// Blocks while running
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := mock.WaitContainer(short, containerID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected wait to time out while running, got %v", err)
+	}
+
+	go mock.SimulateExit(containerID, 137, true)
+
+	state, err := mock.WaitContainer(ctx, containerID)
+	if err != nil {
+		t.Fatalf("WaitContainer failed: %v", err)
+	}
+	if state.Running || state.ExitCode != 137 || !state.OOMKilled {
+		t.Errorf("expected OOM-killed exit, got %+v", state)
+	}
+
+	// Exiting ends the attached output stream
+	if _, err := attach.Reader.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected EOF from attach after exit, got %v", err)
+	}
+
+	if _, err := mock.WaitContainer(ctx, "missing"); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("expected ErrContainerNotFound, got %v", err)
+	}
+}
+
+func TestMockDockerClient_CopyFiles(t *testing.T) {
+	mock := NewMockClient()
+	ctx := context.Background()
+
+	containerID, _ := mock.CreateContainer(ctx, "alpine:latest", nil, ResourceProfile{}, SecurityProfile{})
+
+	if _, err := mock.CopyFromContainer(ctx, containerID, "/home/soul.dat"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("expected ErrFileNotFound, got %v", err)
+	}
+
+	if err := mock.CopyToContainer(ctx, containerID, "/home/soul.dat", []byte("SHC!"), 1000, 1000); err != nil {
+		t.Fatalf("CopyToContainer failed: %v", err)
+	}
+
+	data, err := mock.CopyFromContainer(ctx, containerID, "/home/soul.dat")
+	if err != nil {
+		t.Fatalf("CopyFromContainer failed: %v", err)
+	}
+	if string(data) != "SHC!" {
+		t.Errorf("expected 'SHC!', got %q", data)
+	}
+
+	if _, err := mock.CopyFromContainer(ctx, "missing", "/home/soul.dat"); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("expected ErrContainerNotFound, got %v", err)
+	}
+}
+
+func TestMockDockerClient_CopyFilesWithMounts(t *testing.T) {
+	mock := NewMockClient()
+	ctx := context.Background()
+
+	// Files copied under a tmpfs before start are hidden once it is mounted
+	security := SecurityProfile{Tmpfs: map[string]string{"/home": ""}}
+	containerID, _ := mock.CreateContainer(ctx, "alpine:latest", nil, ResourceProfile{}, security)
+	mock.CopyToContainer(ctx, containerID, "/home/soul.dat", []byte("SHC!"), 1000, 1000)
+	mock.StartContainer(ctx, containerID)
+	if _, err := mock.CopyFromContainer(ctx, containerID, "/home/soul.dat"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("expected the tmpfs to hide the file, got %v", err)
+	}
+
+	// A read-only rootfs only takes files into a volume, which survives start and stop
+	security = SecurityProfile{ReadOnlyRootfs: true, Volumes: []string{"/home"}}
+	containerID, _ = mock.CreateContainer(ctx, "alpine:latest", nil, ResourceProfile{}, security)
+	if err := mock.CopyToContainer(ctx, containerID, "/etc/passwd", []byte("root"), 0, 0); err == nil {
+		t.Error("expected copying onto the read-only rootfs to fail")
+	}
+	if err := mock.CopyToContainer(ctx, containerID, "/home/soul.dat", []byte("SHC!"), 1000, 1000); err != nil {
+		t.Fatalf("CopyToContainer failed: %v", err)
+	}
+	mock.StartContainer(ctx, containerID)
+	mock.StopContainer(ctx, containerID)
+	if data, err := mock.CopyFromContainer(ctx, containerID, "/home/soul.dat"); err != nil || string(data) != "SHC!" {
+		t.Errorf("expected the file to survive in the volume, got %q (%v)", data, err)
+	}
+}
+
+func TestPathUnder(t *testing.T) {
+	tests := []struct {
+		path, mount string
+		want        bool
+	}{
+		{"/home/soul.dat", "/home", true},
+		{"/home/soul.dat", "/home/", true},
+		{"/home", "/home", true},
+		{"/home/soul.dat", "/", true},
+		{"/homestead/soul.dat", "/home", false},
+		{"/tmp/x", "/home", false},
+	}
+	for _, tt := range tests {
+		if got := PathUnder(tt.path, tt.mount); got != tt.want {
+			t.Errorf("PathUnder(%q, %q) = %v, want %v", tt.path, tt.mount, got, tt.want)
+		}
+	}
+}
+
+func TestMockDockerClient_Stats(t *testing.T) {
+	mock := NewMockClient()
+	ctx := context.Background()
+
+	limited, _ := mock.CreateContainer(ctx, "alpine:latest", nil, ResourceProfile{MemoryBytes: 50 << 20}, SecurityProfile{})
+	unlimited, _ := mock.CreateContainer(ctx, "alpine:latest", nil, ResourceProfile{}, SecurityProfile{})
+
+	// A container that isn't running uses nothing
+	stats, err := mock.Stats(ctx, limited)
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if want := (ContainerStats{MemoryLimitBytes: 50 << 20}); *stats != want {
+		t.Errorf("expected %+v, got %+v", want, *stats)
+	}
+
+	// Running, the same numbers every time
+	mock.StartContainer(ctx, limited)
+	for i := 0; i < 2; i++ {
+		stats, _ = mock.Stats(ctx, limited)
+		want := mockStats
+		want.MemoryLimitBytes = 50 << 20
+		if *stats != want {
+			t.Errorf("expected %+v, got %+v", want, *stats)
+		}
+	}
+
+	// Without a limit, Docker reports the host's memory
+	stats, _ = mock.Stats(ctx, unlimited)
+	if stats.MemoryLimitBytes != 4<<30 {
+		t.Errorf("expected the host's memory as the limit, got %d", stats.MemoryLimitBytes)
+	}
+
+	custom := ContainerStats{MemoryUsageBytes: 1, MemoryLimitBytes: 2, CPUPercent: 150, PIDs: 9}
+	if err := mock.SetStats(unlimited, custom); err != nil {
+		t.Fatalf("SetStats failed: %v", err)
+	}
+	if stats, _ = mock.Stats(ctx, unlimited); *stats != custom {
+		t.Errorf("expected %+v, got %+v", custom, *stats)
+	}
+
+	if _, err := mock.Stats(ctx, "missing"); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("expected ErrContainerNotFound, got %v", err)
+	}
+}
+
+func TestStatsFromResponse(t *testing.T) {
+	resp := &container.StatsResponse{
+		PidsStats: container.PidsStats{Current: 7},
+		MemoryStats: container.MemoryStats{
+			Usage: 100 << 20,
+			Limit: 512 << 20,
+			Stats: map[string]uint64{"inactive_file": 20 << 20},
+		},
+		CPUStats: container.CPUStats{
+			CPUUsage:    container.CPUUsage{TotalUsage: 3_000_000},
+			SystemUsage: 20_000_000,
+			OnlineCPUs:  2,
+		},
+		PreCPUStats: container.CPUStats{
+			CPUUsage:    container.CPUUsage{TotalUsage: 1_000_000},
+			SystemUsage: 10_000_000,
+		},
+		Networks: map[string]container.NetworkStats{
+			"eth0": {RxBytes: 100, TxBytes: 200},
+			"eth1": {RxBytes: 1, TxBytes: 2},
+		},
+		BlkioStats: container.BlkioStats{
+			IoServiceBytesRecursive: []container.BlkioStatEntry{
+				{Op: "Read", Value: 300},
+				{Op: "write", Value: 400},
+				{Op: "Total", Value: 700},
+			},
+		},
+	}
+
+	want := ContainerStats{
+		MemoryUsageBytes: 80 << 20,
+		MemoryLimitBytes: 512 << 20,
+		CPUPercent:       40,
+		PIDs:             7,
+		NetworkRxBytes:   101,
+		NetworkTxBytes:   202,
+		BlockReadBytes:   300,
+		BlockWriteBytes:  400,
+	}
+	if got := statsFromResponse(resp); *got != want {
+		t.Errorf("expected %+v, got %+v", want, *got)
+	}
+
+	// cgroup v1 names the page cache differently; a first sample has no CPU delta
+	resp.MemoryStats.Stats = map[string]uint64{"total_inactive_file": 50 << 20}
+	resp.PreCPUStats = container.CPUStats{}
+	resp.CPUStats.SystemUsage = 0
+	got := statsFromResponse(resp)
+	if got.MemoryUsageBytes != 50<<20 || got.CPUPercent != 0 {
+		t.Errorf("expected 50 MiB and no CPU, got %+v", *got)
+	}
+}
@@ -0,0 +1,120 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Observer is told how long each Docker operation took and its error, if any
+type Observer func(operation string, elapsed time.Duration, err error)
+
+// instrumentedClient reports every call to a Client to an Observer
+type instrumentedClient struct {
+	Client
+	observe Observer
+}
+
+// NewInstrumentedClient wraps a Client so each operation is reported to
+// observe under a snake_case name such as "create_container". Close is
+// passed through unobserved.
+func NewInstrumentedClient(c Client, observe Observer) Client {
+	return &instrumentedClient{Client: c, observe: observe}
+}
+
+// track reports an operation started at start
+func (c *instrumentedClient) track(operation string, start time.Time, err error) {
+	c.observe(operation, time.Since(start), err)
+}
+
+func (c *instrumentedClient) HostResources(ctx context.Context) (*HostResources, error) {
+	start := time.Now()
+	host, err := c.Client.HostResources(ctx)
+	c.track("host_resources", start, err)
+	return host, err
+}
+
+func (c *instrumentedClient) ListImages(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	images, err := c.Client.ListImages(ctx)
+	c.track("list_images", start, err)
+	return images, err
+}
+
+func (c *instrumentedClient) ListContainers(ctx context.Context, labels map[string]string) ([]ContainerInfo, error) {
+	start := time.Now()
+	containers, err := c.Client.ListContainers(ctx, labels)
+	c.track("list_containers", start, err)
+	return containers, err
+}
+
+func (c *instrumentedClient) CreateContainer(ctx context.Context, imageName string, config *container.Config, resources ResourceProfile, security SecurityProfile) (string, error) {
+	start := time.Now()
+	id, err := c.Client.CreateContainer(ctx, imageName, config, resources, security)
+	c.track("create_container", start, err)
+	return id, err
+}
+
+func (c *instrumentedClient) StartContainer(ctx context.Context, containerID string) error {
+	start := time.Now()
+	err := c.Client.StartContainer(ctx, containerID)
+	c.track("start_container", start, err)
+	return err
+}
+
+func (c *instrumentedClient) InspectContainer(ctx context.Context, containerID string) (*ContainerState, error) {
+	start := time.Now()
+	state, err := c.Client.InspectContainer(ctx, containerID)
+	c.track("inspect_container", start, err)
+	return state, err
+}
+
+func (c *instrumentedClient) WaitContainer(ctx context.Context, containerID string) (*ContainerState, error) {
+	start := time.Now()
+	state, err := c.Client.WaitContainer(ctx, containerID)
+	c.track("wait_container", start, err)
+	return state, err
+}
+
+func (c *instrumentedClient) StopContainer(ctx context.Context, containerID string) error {
+	start := time.Now()
+	err := c.Client.StopContainer(ctx, containerID)
+	c.track("stop_container", start, err)
+	return err
+}
+
+func (c *instrumentedClient) RemoveContainer(ctx context.Context, containerID string) error {
+	start := time.Now()
+	err := c.Client.RemoveContainer(ctx, containerID)
+	c.track("remove_container", start, err)
+	return err
+}
+
+func (c *instrumentedClient) AttachContainer(ctx context.Context, containerID string) (*AttachResult, error) {
+	start := time.Now()
+	attach, err := c.Client.AttachContainer(ctx, containerID)
+	c.track("attach_container", start, err)
+	return attach, err
+}
+
+func (c *instrumentedClient) CopyFromContainer(ctx context.Context, containerID, filePath string) ([]byte, error) {
+	start := time.Now()
+	data, err := c.Client.CopyFromContainer(ctx, containerID, filePath)
+	c.track("copy_from_container", start, err)
+	return data, err
+}
+
+func (c *instrumentedClient) CopyToContainer(ctx context.Context, containerID, filePath string, data []byte, uid, gid int) error {
+	start := time.Now()
+	err := c.Client.CopyToContainer(ctx, containerID, filePath, data, uid, gid)
+	c.track("copy_to_container", start, err)
+	return err
+}
+
+func (c *instrumentedClient) Stats(ctx context.Context, containerID string) (*ContainerStats, error) {
+	start := time.Now()
+	stats, err := c.Client.Stats(ctx, containerID)
+	c.track("container_stats", start, err)
+	return stats, err
+}
@@ -0,0 +1,53 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInstrumentedClient_ReportsOperations(t *testing.T) {
+	type call struct {
+		operation string
+		err       error
+	}
+	var calls []call
+	mock := NewMockClient()
+	c := NewInstrumentedClient(mock, func(operation string, elapsed time.Duration, err error) {
+		if elapsed < 0 {
+			t.Errorf("%s: negative elapsed time %v", operation, elapsed)
+		}
+		calls = append(calls, call{operation, err})
+	})
+
+	ctx := context.Background()
+	id, err := c.CreateContainer(ctx, "alpine:latest", nil, ResourceProfile{}, SecurityProfile{})
+	if err != nil {
+		t.Fatalf("CreateContainer failed: %v", err)
+	}
+	if err := c.StartContainer(ctx, id); err != nil {
+		t.Fatalf("StartContainer failed: %v", err)
+	}
+	if _, err := c.InspectContainer(ctx, "missing"); !errors.Is(err, ErrContainerNotFound) {
+		t.Fatalf("expected %v, got %v", ErrContainerNotFound, err)
+	}
+
+	want := []string{"create_container", "start_container", "inspect_container"}
+	if len(calls) != len(want) {
+		t.Fatalf("expected %d calls, got %+v", len(want), calls)
+	}
+	for i, op := range want {
+		if calls[i].operation != op {
+			t.Errorf("call %d: expected %q, got %q", i, op, calls[i].operation)
+		}
+	}
+	if calls[0].err != nil || !errors.Is(calls[2].err, ErrContainerNotFound) {
+		t.Errorf("expected errors passed to the observer, got %+v", calls)
+	}
+
+	// The wrapped client still sees every change
+	if c, exists := mock.GetContainer(id); !exists || !c.Running {
+		t.Error("expected the mock's container to be running")
+	}
+}
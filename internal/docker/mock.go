@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/docker/docker/api/types/container"
 )
@@ -12,25 +14,63 @@ import (
 // MockClient is a fake Docker client for testing
 type MockClient struct {
 	mu         sync.RWMutex
+	host       HostResources
+	hostErr    error
 	images     map[string]bool
 	containers map[string]*mockContainer
 	nextID     int
 }
 
 type mockContainer struct {
-	ID      string
-	Image   string
-	Running bool
+	ID         string
+	Image      string
+	Running    bool
+	Labels     map[string]string
+	Resources  ResourceProfile
+	Security   SecurityProfile
+	Files      map[string][]byte
+	TTYHeight  uint
+	TTYWidth   uint
+	Exited     bool
+	ExitCode   int
+	OOMKilled  bool
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Stats      *ContainerStats // set by SetStats
+
+	exited      chan struct{}    // closed when the running container stops
+	attachments []*io.PipeWriter // closed on exit so attached readers see EOF
 }
 
 // NewMockClient creates a new mock Docker client
 func NewMockClient() *MockClient {
 	return &MockClient{
+		host:       HostResources{MemoryBytes: 4 << 30, CPUs: 4},
 		images:     make(map[string]bool),
 		containers: make(map[string]*mockContainer),
 	}
 }
 
+// SetHostResources sets what HostResources reports; a non-nil err makes it fail
+func (m *MockClient) SetHostResources(host HostResources, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.host = host
+	m.hostErr = err
+}
+
+// HostResources returns the mock host (4GB and 4 CPUs unless changed)
+func (m *MockClient) HostResources(ctx context.Context) (*HostResources, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.hostErr != nil {
+		return nil, m.hostErr
+	}
+	host := m.host
+	return &host, nil
+}
+
 // AddImage adds an image to the mock registry
 func (m *MockClient) AddImage(name string) {
 	m.mu.Lock()
@@ -50,8 +90,48 @@ func (m *MockClient) ListImages(ctx context.Context) ([]string, error) {
 	return imageNames, nil
 }
 
+// ListContainers returns mock containers carrying every given label, sorted by ID
+func (m *MockClient) ListContainers(ctx context.Context, labels map[string]string) ([]ContainerInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var infos []ContainerInfo
+	for _, c := range m.containers {
+		if !hasLabels(c.Labels, labels) {
+			continue
+		}
+
+		state := "created"
+		if c.Running {
+			state = "running"
+		} else if c.Exited {
+			state = "exited"
+		}
+
+		infos = append(infos, ContainerInfo{
+			ID:     c.ID,
+			Image:  c.Image,
+			State:  state,
+			Labels: c.Labels,
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos, nil
+}
+
+// hasLabels reports whether have contains every key/value pair in want
+func hasLabels(have, want map[string]string) bool {
+	for key, value := range want {
+		if have[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
 // CreateContainer creates a new mock container
-func (m *MockClient) CreateContainer(ctx context.Context, imageName string, config *container.Config) (string, error) {
+func (m *MockClient) CreateContainer(ctx context.Context, imageName string, config *container.Config, resources ResourceProfile, security SecurityProfile) (string, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -61,10 +141,19 @@ func (m *MockClient) CreateContainer(ctx context.Context, imageName string, conf
 	m.nextID++
 	containerID := fmt.Sprintf("mock-%d", m.nextID)
 
+	var labels map[string]string
+	if config != nil {
+		labels = config.Labels
+	}
+
 	m.containers[containerID] = &mockContainer{
-		ID:      containerID,
-		Image:   imageName,
-		Running: false,
+		ID:        containerID,
+		Image:     imageName,
+		Running:   false,
+		Labels:    labels,
+		Resources: resources,
+		Security:  security,
+		Files:     make(map[string][]byte),
 	}
 
 	return containerID, nil
@@ -80,10 +169,65 @@ func (m *MockClient) StartContainer(ctx context.Context, containerID string) err
 		return fmt.Errorf("container %s not found", containerID)
 	}
 
+	if !c.Running {
+		c.exited = make(chan struct{})
+		c.clearTmpfs() // mounted over anything copied there before start
+	}
 	c.Running = true
+	c.Exited = false
+	c.StartedAt = time.Now()
 	return nil
 }
 
+// markExited records that a container stopped, waking waiters and ending
+// attached output streams. Callers must hold m.mu.
+func (c *mockContainer) markExited() {
+	wasRunning := c.Running
+	c.Running = false
+	c.Exited = true
+	c.FinishedAt = time.Now()
+
+	if wasRunning && c.exited != nil {
+		close(c.exited)
+	}
+	c.clearTmpfs()
+	c.closeAttachments()
+}
+
+// clearTmpfs drops files under the container's tmpfs mounts, as happens when
+// they are mounted at start and unmounted on exit. Callers must hold m.mu.
+func (c *mockContainer) clearTmpfs() {
+	for filePath := range c.Files {
+		for mount := range c.Security.Tmpfs {
+			if PathUnder(filePath, mount) {
+				delete(c.Files, filePath)
+			}
+		}
+	}
+}
+
+// writable reports whether a file can be copied to filePath: anywhere unless
+// the rootfs is read-only, and then only into a volume
+func (c *mockContainer) writable(filePath string) bool {
+	if !c.Security.ReadOnlyRootfs {
+		return true
+	}
+	for _, mount := range c.Security.Volumes {
+		if PathUnder(filePath, mount) {
+			return true
+		}
+	}
+	return false
+}
+
+// closeAttachments ends every attached output stream. Callers must hold m.mu.
+func (c *mockContainer) closeAttachments() {
+	for _, pw := range c.attachments {
+		pw.Close()
+	}
+	c.attachments = nil
+}
+
 // StopContainer stops a mock container
 func (m *MockClient) StopContainer(ctx context.Context, containerID string) error {
 	m.mu.Lock()
@@ -94,7 +238,77 @@ func (m *MockClient) StopContainer(ctx context.Context, containerID string) erro
 		return fmt.Errorf("container %s not found", containerID)
 	}
 
-	c.Running = false
+	if c.Running {
+		c.markExited()
+	}
+	return nil
+}
+
+// InspectContainer returns the runtime state of a mock container
+func (m *MockClient) InspectContainer(ctx context.Context, containerID string) (*ContainerState, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, exists := m.containers[containerID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrContainerNotFound, containerID)
+	}
+
+	status := "created"
+	if c.Running {
+		status = "running"
+	} else if c.Exited {
+		status = "exited"
+	}
+
+	return &ContainerState{
+		Status:     status,
+		Running:    c.Running,
+		OOMKilled:  c.OOMKilled,
+		ExitCode:   c.ExitCode,
+		StartedAt:  c.StartedAt,
+		FinishedAt: c.FinishedAt,
+	}, nil
+}
+
+// WaitContainer blocks until a mock container stops, then returns its state
+func (m *MockClient) WaitContainer(ctx context.Context, containerID string) (*ContainerState, error) {
+	m.mu.RLock()
+	c, exists := m.containers[containerID]
+	var exited chan struct{}
+	if exists && c.Running {
+		exited = c.exited
+	}
+	m.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrContainerNotFound, containerID)
+	}
+
+	if exited != nil {
+		select {
+		case <-exited:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return m.InspectContainer(ctx, containerID)
+}
+
+// SimulateExit marks a mock container as exited (for testing crashes and OOM kills)
+func (m *MockClient) SimulateExit(containerID string, exitCode int, oomKilled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, exists := m.containers[containerID]
+	if !exists {
+		return fmt.Errorf("container %s not found", containerID)
+	}
+
+	c.ExitCode = exitCode
+	c.OOMKilled = oomKilled
+	c.markExited()
 	return nil
 }
 
@@ -103,10 +317,16 @@ func (m *MockClient) RemoveContainer(ctx context.Context, containerID string) er
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, exists := m.containers[containerID]; !exists {
+	c, exists := m.containers[containerID]
+	if !exists {
 		return fmt.Errorf("container %s not found", containerID)
 	}
 
+	// Force removal kills a running container
+	if c.Running {
+		c.markExited()
+	}
+	c.closeAttachments()
 	delete(m.containers, containerID)
 	return nil
 }
@@ -118,18 +338,26 @@ func (m *MockClient) Close() error {
 
 // AttachContainer returns a mock attachment (pipes for I/O)
 func (m *MockClient) AttachContainer(ctx context.Context, containerID string) (*AttachResult, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	if _, exists := m.containers[containerID]; !exists {
+	c, exists := m.containers[containerID]
+	if !exists {
 		return nil, fmt.Errorf("container %s not found", containerID)
 	}
 
 	// Create in-memory pipes for testing
 	pr, pw := io.Pipe()
+	c.attachments = append(c.attachments, pw)
 
 	resize := func(height, width uint) error {
-		// Mock resize - just log it
+		// Mock resize - record the size for assertions
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if c, exists := m.containers[containerID]; exists {
+			c.TTYHeight = height
+			c.TTYWidth = width
+		}
 		return nil
 	}
 
@@ -147,3 +375,111 @@ func (m *MockClient) GetContainer(containerID string) (*mockContainer, bool) {
 	c, exists := m.containers[containerID]
 	return c, exists
 }
+
+// GetTerminalSize returns the last TTY size set through an attachment's Resize
+func (m *MockClient) GetTerminalSize(containerID string) (height, width uint) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if c, exists := m.containers[containerID]; exists {
+		return c.TTYHeight, c.TTYWidth
+	}
+	return 0, 0
+}
+
+// CopyFromContainer returns a file previously written to a mock container
+func (m *MockClient) CopyFromContainer(ctx context.Context, containerID, filePath string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, exists := m.containers[containerID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrContainerNotFound, containerID)
+	}
+
+	data, exists := c.Files[filePath]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, filePath)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// CopyToContainer stores a file in a mock container
+func (m *MockClient) CopyToContainer(ctx context.Context, containerID, filePath string, data []byte, uid, gid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, exists := m.containers[containerID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrContainerNotFound, containerID)
+	}
+	if !c.writable(filePath) {
+		return fmt.Errorf("copy to %s: container rootfs is marked read-only", filePath)
+	}
+
+	c.Files[filePath] = append([]byte(nil), data...)
+	return nil
+}
+
+// mockStats is what a running mock container reports unless SetStats
+// overrides it, so tests can rely on the numbers
+var mockStats = ContainerStats{
+	MemoryUsageBytes: 12 << 20,
+	CPUPercent:       2.5,
+	PIDs:             3,
+	NetworkRxBytes:   1024,
+	NetworkTxBytes:   2048,
+	BlockReadBytes:   4096,
+	BlockWriteBytes:  8192,
+}
+
+// Stats reports fixed usage for a running mock container and none for a
+// stopped one. The memory limit is the container's, or the host's memory if
+// it has none, as Docker reports it.
+func (m *MockClient) Stats(ctx context.Context, containerID string) (*ContainerStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, exists := m.containers[containerID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrContainerNotFound, containerID)
+	}
+	if c.Stats != nil {
+		stats := *c.Stats
+		return &stats, nil
+	}
+
+	limit := uint64(m.host.MemoryBytes)
+	if c.Resources.MemoryBytes > 0 {
+		limit = uint64(c.Resources.MemoryBytes)
+	}
+	stats := ContainerStats{MemoryLimitBytes: limit}
+	if c.Running {
+		stats = mockStats
+		stats.MemoryLimitBytes = limit
+		stats.MemoryUsageBytes = min(stats.MemoryUsageBytes, limit)
+	}
+	return &stats, nil
+}
+
+// SetStats makes a mock container report the given stats
+func (m *MockClient) SetStats(containerID string, stats ContainerStats) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, exists := m.containers[containerID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrContainerNotFound, containerID)
+	}
+	c.Stats = &stats
+	return nil
+}
+
+// DeleteFile removes a file from a mock container (for simulating permadeath)
+func (m *MockClient) DeleteFile(containerID, filePath string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if c, exists := m.containers[containerID]; exists {
+		delete(c.Files, filePath)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shellcraft/server/internal/auth"
+)
+
+// accessCookiePrefix names the HttpOnly cookie carrying a session's access
+// token. The session ID is appended so a browser can hold several sessions.
+const accessCookiePrefix = "shellcraft_session_"
+
+// SetSigningKey sets the key session access tokens are signed with. Tokens
+// issued with the previous key stop working.
+func (s *Server) SetSigningKey(key []byte) {
+	s.tokens = auth.NewSigner(key, s.tokenTTL)
+}
+
+// accessToken returns the access token a request presents for a session:
+// an Authorization bearer token, or else the session's cookie
+func accessToken(r *http.Request, sessionID string) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if cookie, err := r.Cookie(accessCookiePrefix + sessionID); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// setAccessCookie binds an access token to the browser. It is HttpOnly so
+// page scripts can't read it, and sent along with the terminal's WebSocket.
+// Lax still keeps it off cross-site POSTs, but sends it when a player follows
+// a link to the terminal from another site.
+func setAccessCookie(w http.ResponseWriter, r *http.Request, sessionID, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessCookiePrefix + sessionID,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearAccessCookie removes a session's cookie from the browser
+func clearAccessCookie(w http.ResponseWriter, sessionID string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessCookiePrefix + sessionID,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+// requireSessionAccess rejects requests for /session/{id} routes that don't
+// present a valid access token for that session. The session ID alone shows
+// up in URLs and logs, so it grants nothing.
+func (s *Server) requireSessionAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionID := chi.URLParam(r, "id")
+
+		err := s.tokens.Verify(accessToken(r, sessionID), sessionID)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="shellcraft"`)
+			if errors.Is(err, auth.ErrExpiredToken) {
+				http.Error(w, "Access token expired", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "Invalid or missing access token", http.StatusUnauthorized)
+			}
+			log.Printf("Rejected %s %s: %v", r.Method, r.URL.Path, err)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleSetAccessCookie binds the access token a client presents in its
+// Authorization header to an HttpOnly cookie, so a browser admitted from
+// the waiting room (whose token arrived over server-sent events) can open
+// the terminal page
+func (s *Server) handleSetAccessCookie(w http.ResponseWriter, r *http.Request) {
+	sessionID := chi.URLParam(r, "id")
+
+	// A browser-session cookie; the token's own expiry still applies
+	setAccessCookie(w, r, sessionID, accessToken(r, sessionID), time.Time{})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shellcraft/server/internal/auth"
+	"github.com/shellcraft/server/internal/docker"
+)
+
+func TestCreateSession_IssuesAccessToken(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+
+	req := httptest.NewRequest(http.MethodPost, "/session", nil)
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	var response map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	sessionID := response["session_id"]
+	if err := srv.tokens.Verify(response["access_token"], sessionID); err != nil {
+		t.Errorf("expected a valid access token, got %v", err)
+	}
+	if expires, err := time.Parse(time.RFC3339, response["expires_at"]); err != nil || time.Until(expires) < 23*time.Hour {
+		t.Errorf("expected expiry in a day, got %q", response["expires_at"])
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected an access cookie, got %v", cookies)
+	}
+	cookie := cookies[0]
+	if cookie.Name != accessCookiePrefix+sessionID || cookie.Value != response["access_token"] {
+		t.Errorf("unexpected cookie %s=%s", cookie.Name, cookie.Value)
+	}
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("expected an HttpOnly SameSite=Lax cookie, got %+v", cookie)
+	}
+
+	// The cookie alone opens the terminal page
+	req = httptest.NewRequest(http.MethodGet, "/session/"+sessionID+"/connect", nil)
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d with cookie, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestSessionAccess_RejectsWithoutValidToken(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	sessionID, _ := createTestSession(t, srv)
+	otherID, _ := createTestSession(t, srv)
+
+	oldToken, _ := srv.tokens.Issue(sessionID)
+	key := auth.NewKey()
+	srv.SetSigningKey(key)
+	expiredToken, _ := auth.NewSigner(key, -time.Minute).Issue(sessionID)
+
+	otherToken, _ := srv.tokens.Issue(otherID)
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"no token", "", "missing"},
+		{"session ID as token", "Bearer " + sessionID, "Invalid"},
+		{"another session's token", "Bearer " + otherToken, "Invalid"},
+		{"expired token", "Bearer " + expiredToken, "expired"},
+		{"token signed with a replaced key", "Bearer " + oldToken, "Invalid"},
+		{"not a bearer token", "Basic " + otherToken, "Invalid"},
+	}
+
+	routes := []struct{ method, path string }{
+		{http.MethodDelete, "/session/" + sessionID},
+		{http.MethodGet, "/session/" + sessionID + "/status"},
+		{http.MethodGet, "/session/" + sessionID + "/ws"},
+		{http.MethodGet, "/session/" + sessionID + "/connect"},
+		{http.MethodPost, "/session/" + sessionID + "/cookie"},
+		{http.MethodPost, "/session/" + sessionID + "/view-token"},
+	}
+
+	for _, tt := range tests {
+		for _, route := range routes {
+			req := httptest.NewRequest(route.method, route.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			srv.Router().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("%s: %s %s: expected 401 mentioning %q, got %d %q", tt.name, route.method, route.path, tt.want, rec.Code, rec.Body.String())
+			}
+		}
+	}
+
+	if _, exists := srv.sessionManager.GetSession(sessionID); !exists {
+		t.Error("session should survive unauthorized requests")
+	}
+}
+
+func TestSessionAccess_CookieFromBearerToken(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	sessionID, _ := createTestSession(t, srv)
+
+	req := authorize(srv, httptest.NewRequest(http.MethodPost, "/session/"+sessionID+"/cookie", nil), sessionID)
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || srv.tokens.Verify(cookies[0].Value, sessionID) != nil {
+		t.Errorf("expected an HttpOnly cookie with the token, got %v", cookies)
+	}
+}
+
+func TestDeleteSession_ClearsAccessCookie(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	sessionID, _ := createTestSession(t, srv)
+
+	req := authorize(srv, httptest.NewRequest(http.MethodDelete, "/session/"+sessionID, nil), sessionID)
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != accessCookiePrefix+sessionID || cookies[0].MaxAge >= 0 {
+		t.Errorf("expected the access cookie to be cleared, got %v", cookies)
+	}
+}
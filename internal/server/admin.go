@@ -0,0 +1,305 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/shellcraft/server/internal/docker"
+	"github.com/shellcraft/server/internal/session"
+)
+
+// minAdminTokenLength keeps guessable admin tokens out
+const minAdminTokenLength = 16
+
+// maxIdleExtension bounds how far one request may push back an idle deadline
+const maxIdleExtension = 24 * time.Hour
+
+// SetAdminToken enables the admin API for requests bearing token
+func (s *Server) SetAdminToken(token string) error {
+	if len(token) < minAdminTokenLength {
+		return fmt.Errorf("admin token is %d characters, want at least %d", len(token), minAdminTokenLength)
+	}
+	s.adminToken = token
+	return nil
+}
+
+// adminActionKey is the context key of the request's *adminAction
+type adminActionKey struct{}
+
+// adminAction is what an admin handler reports for the audit log
+type adminAction struct {
+	name   string
+	detail string
+}
+
+// noteAdminAction names the action an admin request performed for its audit
+// entry, with any detail worth recording
+func noteAdminAction(r *http.Request, name, detail string) {
+	if action, ok := r.Context().Value(adminActionKey{}).(*adminAction); ok {
+		action.name, action.detail = name, detail
+	}
+}
+
+// auditAdmin writes an audit entry for every admin request once it has been
+// handled, unauthorized ones included. While the admin API is disabled
+// nothing is audited, so scanners can't fill the log.
+func (s *Server) auditAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		action := &adminAction{name: r.Method + " " + r.URL.Path}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), adminActionKey{}, action)))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		s.audit(auditEntry{
+			Time:      time.Now().UTC(),
+			Actor:     s.clientIP(r),
+			Action:    action.name,
+			SessionID: chi.URLParam(r, "id"),
+			Detail:    action.detail,
+			Status:    status,
+		})
+	})
+}
+
+// requireAdmin rejects requests without the admin bearer token. Without a
+// configured token the admin API doesn't exist.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !s.isAdmin(r) {
+			noteAdminAction(r, "unauthorized", r.Method+" "+r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="shellcraft-admin"`)
+			http.Error(w, "Invalid or missing admin token", http.StatusUnauthorized)
+			log.Printf("Rejected admin request %s %s from %s", r.Method, r.URL.Path, s.clientIP(r))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAdmin reports whether a request bears the admin token
+func (s *Server) isAdmin(r *http.Request) bool {
+	if s.adminToken == "" {
+		return false
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(s.adminToken)) == 1
+}
+
+// adminSession is a session as operators see it
+type adminSession struct {
+	ID             string    `json:"session_id"`
+	Image          string    `json:"image"`
+	Profile        string    `json:"profile,omitempty"`
+	ClientIP       string    `json:"client_ip,omitempty"`
+	ContainerID    string    `json:"container_id"`
+	ContainerState string    `json:"container_state"` // Docker's state, "missing" or "unknown"
+	Clients        int       `json:"clients"`         // connected terminals
+	CreatedAt      time.Time `json:"created_at"`
+	LastActivity   time.Time `json:"last_activity"`
+	IdleSeconds    int       `json:"idle_seconds"`
+	IdleDeadline   time.Time `json:"idle_deadline"` // when cleanup may remove it
+	EndReason      string    `json:"end_reason,omitempty"`
+}
+
+// idleDeadline returns when a session becomes eligible for idle cleanup
+func (s *Server) idleDeadline(sess *session.Session) time.Time {
+	deadline := sess.LastActivity.Add(s.idleTimeout)
+	if sess.IdleUntil.After(deadline) {
+		return sess.IdleUntil
+	}
+	return deadline
+}
+
+// terminalClients returns how many clients are connected to a session's terminal
+func (s *Server) terminalClients(sessionID string) int {
+	s.terminalsMu.Lock()
+	t, exists := s.terminals[sessionID]
+	s.terminalsMu.Unlock()
+	if !exists {
+		return 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.clients)
+}
+
+// handleAdminListSessions lists every session with its container's state
+func (s *Server) handleAdminListSessions(w http.ResponseWriter, r *http.Request) {
+	noteAdminAction(r, "list_sessions", "")
+
+	// One listing covers every container rather than an inspect per session
+	states := make(map[string]string)
+	containers, err := s.dockerClient.ListContainers(r.Context(), map[string]string{
+		docker.LabelManaged:  "true",
+		docker.LabelInstance: s.instanceID,
+	})
+	if err != nil {
+		log.Printf("Failed to list containers: %v", err)
+	}
+	for _, c := range containers {
+		states[c.ID] = c.State
+	}
+
+	now := time.Now()
+	sessions := []adminSession{}
+	for _, sess := range s.sessionManager.ListSessions() {
+		state, ok := states[sess.ContainerID]
+		switch {
+		case err != nil:
+			state = "unknown"
+		case !ok:
+			state = "missing"
+		}
+
+		sessions = append(sessions, adminSession{
+			ID:             sess.ID,
+			Image:          sess.Image,
+			Profile:        sess.Profile,
+			ClientIP:       sess.ClientIP,
+			ContainerID:    sess.ContainerID,
+			ContainerState: state,
+			Clients:        s.terminalClients(sess.ID),
+			CreatedAt:      sess.CreatedAt,
+			LastActivity:   sess.LastActivity,
+			IdleSeconds:    int(now.Sub(sess.LastActivity).Seconds()),
+			IdleDeadline:   s.idleDeadline(sess),
+			EndReason:      sess.EndReason,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessions": sessions,
+		"draining": s.Draining(),
+	})
+}
+
+// handleAdminTerminateSession force-terminates a session, saving its soul
+func (s *Server) handleAdminTerminateSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := chi.URLParam(r, "id")
+	noteAdminAction(r, "terminate_session", "")
+
+	if !s.terminateSession(context.Background(), sessionID) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("Admin terminated session %s", sessionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "terminated"})
+}
+
+// extendRequest is the JSON body of POST /admin/sessions/{id}/extend
+type extendRequest struct {
+	Duration string `json:"duration"` // such as "30m"
+}
+
+// handleAdminExtendSession pushes back a session's idle deadline so cleanup
+// leaves it alone for longer
+func (s *Server) handleAdminExtendSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := chi.URLParam(r, "id")
+
+	var req extendRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	noteAdminAction(r, "extend_session", "duration="+req.Duration)
+
+	extension, err := time.ParseDuration(req.Duration)
+	if err != nil || extension <= 0 || extension > maxIdleExtension {
+		http.Error(w, fmt.Sprintf("duration must be between 0 and %v", maxIdleExtension), http.StatusBadRequest)
+		return
+	}
+
+	sess, exists := s.sessionManager.GetSession(sessionID)
+	if !exists {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	// Extend from the current deadline, or from now if it has already passed
+	deadline := s.idleDeadline(sess)
+	if now := time.Now(); deadline.Before(now) {
+		deadline = now
+	}
+	deadline = deadline.Add(extension)
+	if err := s.sessionManager.SetIdleUntil(sessionID, deadline); err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("Admin extended session %s idle deadline to %s", sessionID, deadline.Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"session_id":    sessionID,
+		"idle_deadline": deadline.UTC().Format(time.RFC3339),
+	})
+}
+
+// drainRequest is the JSON body of POST /admin/drain. EndSessionsAfter, if
+// set, counts down (warning players) and then ends every session.
+type drainRequest struct {
+	Enabled          *bool  `json:"enabled"`
+	EndSessionsAfter string `json:"end_sessions_after"` // such as "5m"
+}
+
+// handleAdminDrainStatus reports whether the server is draining
+func (s *Server) handleAdminDrainStatus(w http.ResponseWriter, r *http.Request) {
+	noteAdminAction(r, "drain_status", "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"draining": s.Draining()})
+}
+
+// handleAdminSetDrain turns drain mode on or off, optionally ending every
+// session after a countdown
+func (s *Server) handleAdminSetDrain(w http.ResponseWriter, r *http.Request) {
+	var req drainRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	if req.Enabled == nil {
+		noteAdminAction(r, "set_drain", "")
+		http.Error(w, `body must set "enabled"`, http.StatusBadRequest)
+		return
+	}
+	detail := fmt.Sprintf("enabled=%t", *req.Enabled)
+	if req.EndSessionsAfter != "" {
+		detail += " end_sessions_after=" + req.EndSessionsAfter
+	}
+	noteAdminAction(r, "set_drain", detail)
+
+	if !*req.Enabled || req.EndSessionsAfter == "" {
+		s.SetDraining(*req.Enabled)
+	} else {
+		warning, err := time.ParseDuration(req.EndSessionsAfter)
+		if err != nil || warning < 0 {
+			http.Error(w, "end_sessions_after must be a non-negative duration", http.StatusBadRequest)
+			return
+		}
+		s.StartDrain(warning)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"draining": s.Draining()})
+}
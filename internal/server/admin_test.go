@@ -0,0 +1,288 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shellcraft/server/internal/docker"
+)
+
+const testAdminToken = "test-admin-token-0123456789"
+
+// newAdminServer returns a server with the admin API enabled, auditing to a
+// file it also returns
+func newAdminServer(t *testing.T, dockerClient docker.Client) (*Server, string) {
+	srv := NewWithDockerClient(dockerClient)
+	if err := srv.SetAdminToken(testAdminToken); err != nil {
+		t.Fatalf("SetAdminToken failed: %v", err)
+	}
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	if err := srv.SetAuditLog(auditPath); err != nil {
+		t.Fatalf("SetAuditLog failed: %v", err)
+	}
+	return srv, auditPath
+}
+
+// adminRequest makes an admin API request with the given token
+func adminRequest(srv *Server, method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+	return rec
+}
+
+// readAudit returns the entries in an audit log file
+func readAudit(t *testing.T, path string) []auditEntry {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	defer f.Close()
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("bad audit line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAdmin_DisabledWithoutToken(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	if err := srv.SetAuditLog(auditPath); err != nil {
+		t.Fatalf("SetAuditLog failed: %v", err)
+	}
+
+	if rec := adminRequest(srv, http.MethodGet, "/admin/sessions", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+	if entries := readAudit(t, auditPath); len(entries) != 0 {
+		t.Errorf("expected nothing audited while the admin API is disabled, got %+v", entries)
+	}
+	if err := srv.SetAdminToken("short"); err == nil {
+		t.Error("expected a short admin token to be refused")
+	}
+}
+
+func TestAdmin_RequiresToken(t *testing.T) {
+	srv, auditPath := newAdminServer(t, docker.NewMockClient())
+	sessionID, _ := createTestSession(t, srv)
+	accessToken, _ := srv.tokens.Issue(sessionID)
+
+	for _, token := range []string{"", "wrong-token-0123456789", accessToken} {
+		rec := adminRequest(srv, http.MethodDelete, "/admin/sessions/"+sessionID, "", token)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: expected status %d, got %d", token, http.StatusUnauthorized, rec.Code)
+		}
+	}
+	if _, exists := srv.sessionManager.GetSession(sessionID); !exists {
+		t.Error("session should survive unauthorized requests")
+	}
+
+	entries := readAudit(t, auditPath)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 audit entries, got %d", len(entries))
+	}
+	if entry := entries[0]; entry.Action != "unauthorized" || entry.Status != http.StatusUnauthorized || !strings.Contains(entry.Detail, sessionID) || entry.Actor == "" {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+}
+
+func TestAdmin_ListSessions(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv, auditPath := newAdminServer(t, mockDocker)
+	sessionID, containerID := createTestSession(t, srv)
+	goneID, goneContainer := createTestSession(t, srv)
+	mockDocker.RemoveContainer(t.Context(), goneContainer)
+	srv.sessionManager.SetLastActivity(sessionID, time.Now().Add(-5*time.Minute))
+
+	rec := adminRequest(srv, http.MethodGet, "/admin/sessions", "", testAdminToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response struct {
+		Sessions []adminSession `json:"sessions"`
+		Draining bool           `json:"draining"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+
+	byID := make(map[string]adminSession)
+	for _, sess := range response.Sessions {
+		byID[sess.ID] = sess
+	}
+	sess := byID[sessionID]
+	if sess.ContainerID != containerID || sess.ContainerState != "created" || sess.Image != srv.defaultImage {
+		t.Errorf("unexpected session %+v", sess)
+	}
+	if !strings.HasPrefix(sess.ClientIP, "10.") {
+		t.Errorf("expected the client IP, got %q", sess.ClientIP)
+	}
+	if sess.IdleSeconds < 299 || sess.IdleSeconds > 310 {
+		t.Errorf("expected about 300s idle, got %d", sess.IdleSeconds)
+	}
+	if want := sess.LastActivity.Add(srv.idleTimeout); !sess.IdleDeadline.Equal(want) {
+		t.Errorf("expected idle deadline %v, got %v", want, sess.IdleDeadline)
+	}
+	if state := byID[goneID].ContainerState; state != "missing" {
+		t.Errorf("expected a removed container to be missing, got %q", state)
+	}
+
+	if entries := readAudit(t, auditPath); len(entries) != 1 || entries[0].Action != "list_sessions" || entries[0].Status != http.StatusOK {
+		t.Errorf("unexpected audit entries %+v", entries)
+	}
+}
+
+func TestAdmin_TerminateSession(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv, auditPath := newAdminServer(t, mockDocker)
+	sessionID, containerID := createTestSession(t, srv)
+
+	rec := adminRequest(srv, http.MethodDelete, "/admin/sessions/"+sessionID, "", testAdminToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if _, exists := srv.sessionManager.GetSession(sessionID); exists {
+		t.Error("expected session to be destroyed")
+	}
+	if _, exists := mockDocker.GetContainer(containerID); exists {
+		t.Error("expected container to be removed")
+	}
+
+	if rec := adminRequest(srv, http.MethodDelete, "/admin/sessions/"+sessionID, "", testAdminToken); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for a gone session, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	entries := readAudit(t, auditPath)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d", len(entries))
+	}
+	if entry := entries[0]; entry.Action != "terminate_session" || entry.SessionID != sessionID || entry.Status != http.StatusOK {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+	if entries[1].Status != http.StatusNotFound {
+		t.Errorf("expected the failed attempt to be audited, got %+v", entries[1])
+	}
+}
+
+func TestAdmin_ExtendSession(t *testing.T) {
+	srv, auditPath := newAdminServer(t, docker.NewMockClient())
+	sessionID, _ := createTestSession(t, srv)
+	srv.sessionManager.SetLastActivity(sessionID, time.Now().Add(-time.Hour))
+
+	rec := adminRequest(srv, http.MethodPost, "/admin/sessions/"+sessionID+"/extend", `{"duration":"30m"}`, testAdminToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	// The deadline had passed, so the extension runs from now
+	sess, _ := srv.sessionManager.GetSession(sessionID)
+	if until := time.Until(sess.IdleUntil); until < 29*time.Minute || until > 31*time.Minute {
+		t.Errorf("expected idle deadline in 30m, got %v", until)
+	}
+	if n := srv.CleanupIdleSessions(srv.idleTimeout); n != 0 {
+		t.Errorf("expected extended session to survive cleanup, cleaned %d", n)
+	}
+
+	// A second extension adds to the first
+	adminRequest(srv, http.MethodPost, "/admin/sessions/"+sessionID+"/extend", `{"duration":"1h"}`, testAdminToken)
+	sess, _ = srv.sessionManager.GetSession(sessionID)
+	if until := time.Until(sess.IdleUntil); until < 89*time.Minute || until > 91*time.Minute {
+		t.Errorf("expected idle deadline in 90m, got %v", until)
+	}
+
+	for _, body := range []string{`{}`, `{"duration":"soon"}`, `{"duration":"-5m"}`, `{"duration":"48h"}`} {
+		if rec := adminRequest(srv, http.MethodPost, "/admin/sessions/"+sessionID+"/extend", body, testAdminToken); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", body, http.StatusBadRequest, rec.Code)
+		}
+	}
+	if rec := adminRequest(srv, http.MethodPost, "/admin/sessions/missing/extend", `{"duration":"5m"}`, testAdminToken); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	entries := readAudit(t, auditPath)
+	if entry := entries[0]; entry.Action != "extend_session" || entry.Detail != "duration=30m" || entry.SessionID != sessionID {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+}
+
+func TestAdmin_ToggleDrain(t *testing.T) {
+	srv, auditPath := newAdminServer(t, docker.NewMockClient())
+
+	rec := adminRequest(srv, http.MethodPost, "/admin/drain", `{"enabled":true}`, testAdminToken)
+	if rec.Code != http.StatusOK || !srv.Draining() {
+		t.Fatalf("expected draining, got %d %v", rec.Code, srv.Draining())
+	}
+
+	rec = adminRequest(srv, http.MethodGet, "/admin/drain", "", testAdminToken)
+	body, _ := io.ReadAll(rec.Body)
+	if !strings.Contains(string(body), `"draining":true`) {
+		t.Errorf("expected drain status, got %s", body)
+	}
+
+	if rec := adminRequest(srv, http.MethodPost, "/admin/drain", `{}`, testAdminToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d without enabled, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	adminRequest(srv, http.MethodPost, "/admin/drain", `{"enabled":false}`, testAdminToken)
+	if srv.Draining() {
+		t.Error("expected draining to stop")
+	}
+
+	entries := readAudit(t, auditPath)
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 audit entries, got %d", len(entries))
+	}
+	if entry := entries[0]; entry.Action != "set_drain" || entry.Detail != "enabled=true" {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+	if entry := entries[1]; entry.Action != "drain_status" {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+}
+
+func TestAdmin_DrainEndsSessions(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv, auditPath := newAdminServer(t, mockDocker)
+	_, containerID := createTestSession(t, srv)
+
+	rec := adminRequest(srv, http.MethodPost, "/admin/drain", `{"enabled":true,"end_sessions_after":"0s"}`, testAdminToken)
+	if rec.Code != http.StatusOK || !srv.Draining() {
+		t.Fatalf("expected draining, got %d", rec.Code)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.sessionManager.ListSessions()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(srv.sessionManager.ListSessions()); n != 0 {
+		t.Fatalf("expected every session ended, got %d", n)
+	}
+	if _, exists := mockDocker.GetContainer(containerID); exists {
+		t.Error("expected container to be removed")
+	}
+
+	if rec := adminRequest(srv, http.MethodPost, "/admin/drain", `{"enabled":true,"end_sessions_after":"later"}`, testAdminToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	if entry := readAudit(t, auditPath)[0]; entry.Detail != "enabled=true end_sessions_after=0s" {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+}
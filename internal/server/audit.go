@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditEntry records one admin request: who made it, what it did and how it
+// turned out
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor"` // client IP
+	Action    string    `json:"action"`
+	SessionID string    `json:"session_id,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	Status    int       `json:"status"`
+}
+
+// auditLog appends audit entries to a file as JSON lines
+type auditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// SetAuditLog appends admin audit entries to the file at path, creating it
+// if needed. Without one they go to the server log.
+func (s *Server) SetAuditLog(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	s.auditLog = &auditLog{w: f}
+	return nil
+}
+
+// audit records an admin request
+func (s *Server) audit(entry auditEntry) {
+	if s.auditLog == nil {
+		log.Printf("Audit: %s by %s (session %q, %s): %d", entry.Action, entry.Actor, entry.SessionID, entry.Detail, entry.Status)
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to encode audit entry: %v", err)
+		return
+	}
+
+	s.auditLog.mu.Lock()
+	defer s.auditLog.mu.Unlock()
+	if _, err := s.auditLog.w.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write audit entry %s: %v", line, err)
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shellcraft/server/internal/docker"
+)
+
+func TestAuditLog_AppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	for i := 0; i < 2; i++ {
+		srv := NewWithDockerClient(docker.NewMockClient())
+		if err := srv.SetAuditLog(path); err != nil {
+			t.Fatalf("SetAuditLog failed: %v", err)
+		}
+		srv.audit(auditEntry{
+			Time:      time.Now(),
+			Actor:     "203.0.113.7",
+			Action:    "terminate_session",
+			SessionID: "abc",
+			Status:    http.StatusOK,
+		})
+	}
+
+	// Entries from a restarted server are appended, not overwritten
+	entries := readAudit(t, path)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entry := entries[1]; entry.Actor != "203.0.113.7" || entry.Action != "terminate_session" || entry.SessionID != "abc" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	if err := NewWithDockerClient(docker.NewMockClient()).SetAuditLog(filepath.Join(path, "nested")); err == nil {
+		t.Error("expected an error for an unwritable path")
+	}
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/shellcraft/server/internal/docker"
+)
+
+// sessionCPUs is the CPU budgeted per session without a CPU quota. Such
+// containers only get CPU shares, and the game mostly idles waiting for
+// input, so this is an average rather than a limit.
+const sessionCPUs = 0.05
+
+// cpuEpsilon absorbs float rounding when summing CPU budgets
+const cpuEpsilon = 1e-9
+
+// sessionCost is the share of the host a session's resource profile takes
+type sessionCost struct {
+	memory int64
+	cpus   float64
+}
+
+// costOf returns what a session with the given resource profile costs: its
+// memory limit, and its CPU quota or sessionCPUs if it has none
+func costOf(resources docker.ResourceProfile) sessionCost {
+	cost := sessionCost{memory: resources.MemoryBytes, cpus: resources.CPUs}
+	if cost.cpus <= 0 {
+		cost.cpus = sessionCPUs
+	}
+	return cost
+}
+
+// capacity is the current session limit and how it was derived. Sessions are
+// admitted against the memory and CPU budget, weighted by their profile; the
+// limit is how many default-profile sessions fit in it.
+type capacity struct {
+	Limit     int    `json:"limit"`
+	LimitedBy string `json:"limited_by"` // memory, cpu or fallback
+	Reason    string `json:"reason"`
+
+	budget sessionCost // host resources left for sessions after the reserve
+}
+
+// computeCapacity derives the session budget on a host after the reserve,
+// and how many sessions of the default cost fit in it
+func computeCapacity(host *docker.HostResources, cost sessionCost, reserveMemory int64, reserveCPUs float64) capacity {
+	budget := sessionCost{
+		memory: max(host.MemoryBytes-reserveMemory, 0),
+		cpus:   max(float64(host.CPUs)-reserveCPUs, 0),
+	}
+	byMemory := int(budget.memory / cost.memory)
+	byCPU := int(budget.cpus/cost.cpus + cpuEpsilon)
+
+	reason := fmt.Sprintf("memory: (%d MiB - %d MiB reserve) / %d MiB per session = %d; cpu: (%d - %g reserve) / %g per session = %d",
+		host.MemoryBytes>>20, reserveMemory>>20, cost.memory>>20, byMemory,
+		host.CPUs, reserveCPUs, cost.cpus, byCPU)
+
+	if byCPU < byMemory {
+		return capacity{Limit: byCPU, LimitedBy: "cpu", Reason: reason, budget: budget}
+	}
+	return capacity{Limit: byMemory, LimitedBy: "memory", Reason: reason, budget: budget}
+}
+
+// fallbackCapacity is used until the host's resources are known: a budget of
+// limit sessions of the default cost
+func fallbackCapacity(limit int, cost sessionCost, err error) capacity {
+	return capacity{
+		Limit:     limit,
+		LimitedBy: "fallback",
+		Reason:    fmt.Sprintf("host resources unavailable (%v); using fallback of %d", err, limit),
+		budget:    sessionCost{memory: int64(limit) * cost.memory, cpus: float64(limit) * cost.cpus},
+	}
+}
+
+// SetCapacityReserve sets how much host memory and CPU is kept back from game
+// sessions, and recomputes capacity
+func (s *Server) SetCapacityReserve(memoryBytes int64, cpus float64) {
+	s.capacityMu.Lock()
+	s.reserveMemory = memoryBytes
+	s.reserveCPUs = cpus
+	s.capacityMu.Unlock()
+
+	s.RefreshCapacity()
+}
+
+// maxSessions returns the current session limit, in default-profile sessions
+func (s *Server) maxSessions() int {
+	s.capacityMu.RLock()
+	defer s.capacityMu.RUnlock()
+
+	return s.capacity.Limit
+}
+
+// currentCapacity returns the current session limit and its reason
+func (s *Server) currentCapacity() capacity {
+	s.capacityMu.RLock()
+	defer s.capacityMu.RUnlock()
+
+	return s.capacity
+}
+
+// profileCost returns the cost of a session of a catalog image and resource
+// profile, or of the default profile if either is unknown
+func (s *Server) profileCost(imageName, profile string) sessionCost {
+	if game, ok := s.resolveImage(imageName); ok {
+		if resources, ok := game.profile(profile); ok {
+			return costOf(resources)
+		}
+	}
+	return s.defaultCost
+}
+
+// sessionsCost returns the total cost of every session
+func (s *Server) sessionsCost() sessionCost {
+	var used sessionCost
+	for _, sess := range s.sessionManager.ListSessions() {
+		cost := s.profileCost(sess.Image, sess.Profile)
+		used.memory += cost.memory
+		used.cpus += cost.cpus
+	}
+	return used
+}
+
+// freeSlots returns how many more sessions of the given cost fit in the
+// budget alongside the current sessions
+func (s *Server) freeSlots(cost sessionCost) int {
+	budget := s.currentCapacity().budget
+	used := s.sessionsCost()
+
+	byMemory := max(budget.memory-used.memory, 0) / cost.memory
+	byCPU := max(budget.cpus-used.cpus, 0)/cost.cpus + cpuEpsilon
+	return int(min(float64(byMemory), byCPU))
+}
+
+// usagePercent returns how much of the session budget is in use, by
+// whichever of memory and CPU is most used
+func (s *Server) usagePercent() int {
+	budget := s.currentCapacity().budget
+	if budget.memory <= 0 || budget.cpus <= 0 {
+		return 100
+	}
+
+	used := s.sessionsCost()
+	byMemory := float64(used.memory) / float64(budget.memory)
+	byCPU := used.cpus / budget.cpus
+	return int(max(byMemory, byCPU)*100 + cpuEpsilon)
+}
+
+// RefreshCapacity recomputes the session limit from the Docker host's
+// resources. If they can't be read, the previous limit is kept (or the
+// fallback, if there is none yet).
+func (s *Server) RefreshCapacity() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	host, err := s.dockerClient.HostResources(ctx)
+
+	s.capacityMu.Lock()
+	previous := s.capacity
+	switch {
+	case err == nil:
+		s.capacity = computeCapacity(host, s.defaultCost, s.reserveMemory, s.reserveCPUs)
+	case previous.Reason == "":
+		s.capacity = fallbackCapacity(s.fallbackSessions, s.defaultCost, err)
+	default:
+		log.Printf("Failed to read host resources, keeping capacity %d: %v", previous.Limit, err)
+	}
+	current := s.capacity
+	s.capacityMu.Unlock()
+
+	if current.Limit != previous.Limit {
+		log.Printf("Session capacity is %d (%s)", current.Limit, current.Reason)
+	}
+
+	// More room: let waiting clients in
+	if current.Limit > previous.Limit && previous.Reason != "" {
+		s.admitWaiting()
+	}
+}
+
+// capacityMonitor periodically refreshes capacity
+type capacityMonitor struct {
+	ticker *time.Ticker
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// StartCapacityRefresh re-reads host resources every interval
+func (s *Server) StartCapacityRefresh(interval time.Duration) {
+	if s.capacityMonitor != nil {
+		log.Println("Capacity refresh already running")
+		return
+	}
+
+	m := &capacityMonitor{
+		ticker: time.NewTicker(interval),
+		done:   make(chan struct{}),
+	}
+	s.capacityMonitor = m
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for {
+			select {
+			case <-m.done:
+				m.ticker.Stop()
+				return
+			case <-m.ticker.C:
+				s.RefreshCapacity()
+			}
+		}
+	}()
+
+	log.Printf("Started capacity refresh (interval: %v)", interval)
+}
+
+// StopCapacityRefresh stops the capacity refresh goroutine
+func (s *Server) StopCapacityRefresh() {
+	if s.capacityMonitor == nil {
+		return
+	}
+
+	close(s.capacityMonitor.done)
+	s.capacityMonitor.wg.Wait()
+	s.capacityMonitor = nil
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shellcraft/server/internal/config"
+	"github.com/shellcraft/server/internal/docker"
+	"github.com/shellcraft/server/internal/session"
+)
+
+func TestComputeCapacity(t *testing.T) {
+	tests := []struct {
+		name      string
+		host      docker.HostResources
+		reserve   int64
+		cpus      float64
+		limit     int
+		limitedBy string
+	}{
+		{"memory bound", docker.HostResources{MemoryBytes: 2 << 30, CPUs: 8}, 512 << 20, 0.25, 30, "memory"},
+		{"cpu bound", docker.HostResources{MemoryBytes: 16 << 30, CPUs: 1}, 512 << 20, 0.25, 15, "cpu"},
+		{"reserve exceeds host", docker.HostResources{MemoryBytes: 256 << 20, CPUs: 4}, 512 << 20, 0.25, 0, "memory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computeCapacity(&tt.host, sessionCost{memory: 50 << 20, cpus: sessionCPUs}, tt.reserve, tt.cpus)
+			if got.Limit != tt.limit || got.LimitedBy != tt.limitedBy {
+				t.Errorf("expected %d (%s), got %d (%s)", tt.limit, tt.limitedBy, got.Limit, got.LimitedBy)
+			}
+			if got.Reason == "" {
+				t.Error("expected a reason")
+			}
+		})
+	}
+}
+
+func TestCapacity_FromHostResources(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	mockDocker.SetHostResources(docker.HostResources{MemoryBytes: 1 << 30, CPUs: 4}, nil)
+	srv := NewWithDockerClient(mockDocker)
+
+	// (1024 - 512) MiB / 50 MiB
+	if n := srv.maxSessions(); n != 10 {
+		t.Errorf("expected capacity 10, got %d", n)
+	}
+
+	srv.SetCapacityReserve(0, 0)
+	if n := srv.maxSessions(); n != 20 {
+		t.Errorf("expected capacity 20 with no reserve, got %d", n)
+	}
+}
+
+func TestCapacity_FallsBackWhenHostUnavailable(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	mockDocker.SetHostResources(docker.HostResources{}, errors.New("daemon unreachable"))
+	srv := NewWithDockerClient(mockDocker)
+
+	c := srv.currentCapacity()
+	if c.Limit != 40 || c.LimitedBy != "fallback" {
+		t.Errorf("expected fallback of 40, got %d (%s)", c.Limit, c.LimitedBy)
+	}
+
+	// Once known, a failed refresh keeps the last good limit
+	mockDocker.SetHostResources(docker.HostResources{MemoryBytes: 1 << 30, CPUs: 4}, nil)
+	srv.RefreshCapacity()
+	mockDocker.SetHostResources(docker.HostResources{}, errors.New("daemon unreachable"))
+	srv.RefreshCapacity()
+
+	if n := srv.maxSessions(); n != 10 {
+		t.Errorf("expected capacity 10 to be kept, got %d", n)
+	}
+}
+
+func TestCapacity_GrowthAdmitsWaiting(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	mockDocker.SetHostResources(docker.HostResources{MemoryBytes: 1 << 30, CPUs: 4}, nil)
+	srv := NewWithDockerClient(mockDocker)
+
+	fillToCapacity(srv)
+	queued := queueSession(t, srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	stream := openQueueStream(t, server.URL, queued)
+	defer stream.close()
+	stream.next(t, "position")
+
+	mockDocker.SetHostResources(docker.HostResources{MemoryBytes: 2 << 30, CPUs: 4}, nil)
+	srv.RefreshCapacity()
+
+	admitted := stream.next(t, "admitted")
+	if _, exists := srv.sessionManager.GetSession(admitted["session_id"].(string)); !exists {
+		t.Errorf("expected admitted session, got %v", admitted)
+	}
+}
+
+func TestMetrics_ReportsCapacity(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	mockDocker.SetHostResources(docker.HostResources{MemoryBytes: 16 << 30, CPUs: 1}, nil)
+	srv := NewWithDockerClient(mockDocker)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	var metrics ServerMetrics
+	if err := json.Unmarshal(rec.Body.Bytes(), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.MaxSessions != 15 {
+		t.Errorf("expected max_sessions 15, got %d", metrics.MaxSessions)
+	}
+	if metrics.CapacityLimitBy != "cpu" {
+		t.Errorf("expected capacity limited by cpu, got %q", metrics.CapacityLimitBy)
+	}
+	if !strings.Contains(metrics.CapacityReason, "per session") {
+		t.Errorf("unexpected capacity reason %q", metrics.CapacityReason)
+	}
+}
+
+func TestCapacity_WeightedByProfile(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	mockDocker.SetHostResources(docker.HostResources{MemoryBytes: 1 << 30, CPUs: 4}, nil)
+	cfg := config.Default()
+	cfg.Profiles = map[string]config.ProfileConfig{"large": {MemoryMB: 256, CPUShares: 1024}}
+	cfg.Games = []config.GameConfig{{Image: cfg.Image, Profiles: []string{"large"}}}
+	srv := NewWithConfig(cfg, mockDocker, session.NewManager())
+
+	// 512 MiB after the reserve: two large sessions take all of it
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/session", strings.NewReader(`{"profile": "large"}`))
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+	}
+
+	if n := srv.freeSlots(srv.defaultCost); n != 0 {
+		t.Errorf("expected no room left, got %d slots", n)
+	}
+	if p := srv.usagePercent(); p != 100 {
+		t.Errorf("expected 100%% usage, got %d", p)
+	}
+	// The limit is still reported in default-profile sessions
+	if n := srv.maxSessions(); n != 10 {
+		t.Errorf("expected capacity 10, got %d", n)
+	}
+
+	queued := queueSession(t, srv)
+	if queued["status"] != "queued" {
+		t.Errorf("expected a default session to be queued, got %v", queued)
+	}
+}
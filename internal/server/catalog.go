@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/shellcraft/server/internal/config"
+	"github.com/shellcraft/server/internal/docker"
+)
+
+// game is a catalog entry: an image players may start and the resource and
+// security profiles its containers get. Images not in the catalog are never
+// pulled or run.
+type game struct {
+	image        string
+	name         string
+	description  string
+	resources    docker.ResourceProfile            // used unless a session picks a profile
+	profiles     map[string]docker.ResourceProfile // named profiles sessions may pick
+	profileNames []string                          // in catalog order
+	security     docker.SecurityProfile
+}
+
+// catalog is the allowlist of game images
+type catalog struct {
+	games   []*game
+	byImage map[string]*game // keyed by normalized image reference
+}
+
+func newCatalog(entries []config.GameConfig, profiles map[string]config.ProfileConfig) *catalog {
+	c := &catalog{byImage: make(map[string]*game)}
+	for _, entry := range entries {
+		g := &game{
+			image:        entry.Image,
+			name:         entry.Name,
+			description:  entry.Description,
+			resources:    newResourceProfile(*entry.Resources),
+			profiles:     make(map[string]docker.ResourceProfile, len(entry.Profiles)),
+			profileNames: entry.Profiles,
+			security:     newSecurityProfile(entry.Security),
+		}
+		for _, name := range entry.Profiles {
+			g.profiles[name] = newResourceProfile(profiles[name])
+		}
+		c.games = append(c.games, g)
+		c.byImage[normalizeImage(entry.Image)] = g
+	}
+	return c
+}
+
+// newResourceProfile converts a configured resource profile for the Docker client
+func newResourceProfile(pc config.ProfileConfig) docker.ResourceProfile {
+	return docker.ResourceProfile{
+		MemoryBytes: pc.MemoryMB * 1024 * 1024,
+		SwapBytes:   pc.SwapMB * 1024 * 1024,
+		CPUShares:   pc.CPUShares,
+		CPUs:        pc.CPUs,
+		PidsLimit:   pc.PidsLimit,
+		DiskBytes:   pc.DiskMB * 1024 * 1024,
+		TmpfsBytes:  pc.TmpfsMB * 1024 * 1024,
+		Runtime:     pc.Runtime,
+	}
+}
+
+// profile returns the named resource profile, or the game's default if name
+// is empty. Profiles the game doesn't offer are not found.
+func (g *game) profile(name string) (docker.ResourceProfile, bool) {
+	if name == "" {
+		return g.resources, true
+	}
+	resources, exists := g.profiles[name]
+	return resources, exists
+}
+
+// newSecurityProfile converts a configured security profile for the Docker client
+func newSecurityProfile(sc *config.SecurityConfig) docker.SecurityProfile {
+	profile := docker.SecurityProfile{
+		NetworkMode:     sc.NetworkMode,
+		PidsLimit:       sc.PidsLimit,
+		CapDrop:         sc.CapDrop,
+		CapAdd:          sc.CapAdd,
+		NoNewPrivileges: sc.NoNewPrivileges,
+		ReadOnlyRootfs:  sc.ReadOnlyRootfs,
+	}
+
+	// Souls are copied in before the game starts and out after it stops,
+	// while a tmpfs isn't mounted, so one over the soul would hide it. That
+	// mount gets an anonymous volume instead, which lives with the container.
+	for mount, options := range sc.Tmpfs {
+		if docker.PathUnder(soulPath, mount) {
+			profile.Volumes = append(profile.Volumes, mount)
+			continue
+		}
+		if profile.Tmpfs == nil {
+			profile.Tmpfs = make(map[string]string)
+		}
+		profile.Tmpfs[mount] = options
+	}
+	sort.Strings(profile.Volumes)
+
+	// Sorted so containers get the same config every time
+	names := make([]string, 0, len(sc.Ulimits))
+	for name := range sc.Ulimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		u := sc.Ulimits[name]
+		profile.Ulimits = append(profile.Ulimits, docker.Ulimit{Name: name, Soft: u.Soft, Hard: u.Hard})
+	}
+
+	return profile
+}
+
+// lookup returns the catalog entry for an image
+func (c *catalog) lookup(imageName string) (*game, bool) {
+	g, exists := c.byImage[normalizeImage(imageName)]
+	return g, exists
+}
+
+// normalizeImage adds the implicit ":latest" tag so "alpine" and
+// "alpine:latest" name the same catalog entry
+func normalizeImage(imageName string) string {
+	if strings.Contains(imageName, "@") {
+		return imageName
+	}
+	if strings.Contains(imageName[strings.LastIndex(imageName, "/")+1:], ":") {
+		return imageName
+	}
+	return imageName + ":latest"
+}
+
+// resolveImage returns the catalog entry for a requested image, or for the
+// default image if none was requested
+func (s *Server) resolveImage(imageName string) (*game, bool) {
+	if imageName == "" {
+		imageName = s.defaultImage
+	}
+	return s.catalog.lookup(imageName)
+}
+
+// gameInfo is a catalog entry as listed by GET /games
+type gameInfo struct {
+	Image       string   `json:"image"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	MemoryMB    int64    `json:"memory_mb"`
+	CPUShares   int64    `json:"cpu_shares"`
+	Profiles    []string `json:"profiles,omitempty"` // may be passed to POST /session
+	Default     bool     `json:"default"`
+	Available   bool     `json:"available"` // pulled on the Docker host; otherwise the first session pulls it
+}
+
+// handleListGames lists the catalog and which images are available locally
+func (s *Server) handleListGames(w http.ResponseWriter, r *http.Request) {
+	images, err := s.dockerClient.ListImages(context.Background())
+	if err != nil {
+		http.Error(w, "Failed to list images", http.StatusInternalServerError)
+		log.Printf("Failed to list images: %v", err)
+		return
+	}
+
+	local := make(map[string]bool, len(images))
+	for _, imageName := range images {
+		local[normalizeImage(imageName)] = true
+	}
+
+	games := make([]gameInfo, 0, len(s.catalog.games))
+	for _, g := range s.catalog.games {
+		games = append(games, gameInfo{
+			Image:       g.image,
+			Name:        g.name,
+			Description: g.description,
+			MemoryMB:    g.resources.MemoryBytes / 1024 / 1024,
+			CPUShares:   g.resources.CPUShares,
+			Profiles:    g.profileNames,
+			Default:     normalizeImage(g.image) == normalizeImage(s.defaultImage),
+			Available:   local[normalizeImage(g.image)],
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(games)
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shellcraft/server/internal/config"
+	"github.com/shellcraft/server/internal/docker"
+	"github.com/shellcraft/server/internal/session"
+)
+
+// newServerWithGames returns a server whose catalog holds the default image
+// and the given images
+func newServerWithGames(mockDocker *docker.MockClient, images ...string) *Server {
+	cfg := config.Default()
+	cfg.Games = []config.GameConfig{{Image: cfg.Image, Name: "ShellCraft"}}
+	for _, imageName := range images {
+		cfg.Games = append(cfg.Games, config.GameConfig{Image: imageName})
+	}
+	return NewWithConfig(cfg, mockDocker, session.NewManager())
+}
+
+func TestCreateSession_RejectsImageNotInCatalog(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+
+	req := httptest.NewRequest(http.MethodPost, "/session", strings.NewReader(`{"image": "attacker/miner:latest"}`))
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if containers, _ := mockDocker.ListContainers(req.Context(), nil); len(containers) != 0 {
+		t.Errorf("expected no containers, got %d", len(containers))
+	}
+	if n := len(srv.sessionManager.ListSessions()); n != 0 {
+		t.Errorf("expected no sessions, got %d", n)
+	}
+}
+
+func TestCreateSession_UsesCatalogLimits(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	cfg := config.Default()
+	cfg.Games = []config.GameConfig{
+		{Image: cfg.Image},
+		{Image: "shellcraft/endgame", Resources: &config.ProfileConfig{MemoryMB: 128, CPUShares: 1024}},
+	}
+	srv := NewWithConfig(cfg, mockDocker, session.NewManager())
+
+	// The implicit :latest tag matches the catalog entry
+	req := httptest.NewRequest(http.MethodPost, "/session", strings.NewReader(`{"image": "shellcraft/endgame:latest"}`))
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	c, _ := mockDocker.GetContainer(response["container_id"])
+	if c.Image != "shellcraft/endgame" {
+		t.Errorf("expected catalog image, got %s", c.Image)
+	}
+	if c.Resources.MemoryBytes != 128<<20 || c.Resources.CPUShares != 1024 {
+		t.Errorf("expected catalog resources, got %+v", c.Resources)
+	}
+
+	// The default image gets the container defaults
+	_, containerID := createTestSession(t, srv)
+	if c, _ := mockDocker.GetContainer(containerID); c.Resources.MemoryBytes != 50<<20 || c.Resources.CPUShares != 512 {
+		t.Errorf("expected default resources, got %+v", c.Resources)
+	}
+}
+
+func TestListGames(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	mockDocker.AddImage("shellcraft/game:latest")
+	srv := newServerWithGames(mockDocker, "shellcraft/tutorial:v1")
+
+	req := httptest.NewRequest(http.MethodGet, "/games", nil)
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var games []gameInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &games); err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("expected 2 games, got %d", len(games))
+	}
+
+	if g := games[0]; g.Image != "shellcraft/game:latest" || !g.Default || !g.Available || g.MemoryMB != 50 {
+		t.Errorf("unexpected default game %+v", g)
+	}
+	if g := games[1]; g.Image != "shellcraft/tutorial:v1" || g.Name != "shellcraft/tutorial:v1" || g.Default || g.Available {
+		t.Errorf("unexpected tutorial game %+v", g)
+	}
+}
+
+func TestNormalizeImage(t *testing.T) {
+	tests := map[string]string{
+		"alpine":                         "alpine:latest",
+		"alpine:3.20":                    "alpine:3.20",
+		"localhost:5000/game":            "localhost:5000/game:latest",
+		"localhost:5000/game:v2":         "localhost:5000/game:v2",
+		"alpine@sha256:0123456789abcdef": "alpine@sha256:0123456789abcdef",
+	}
+	for in, want := range tests {
+		if got := normalizeImage(in); got != want {
+			t.Errorf("normalizeImage(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCreateSession_AppliesSecurityProfile(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	cfg := config.Default()
+	locked := cfg.Security
+	locked.ReadOnlyRootfs = true
+	locked.Tmpfs = map[string]string{"/tmp": "size=16m"}
+	cfg.Games = []config.GameConfig{
+		{Image: cfg.Image},
+		{Image: "shellcraft/arena:v1", Security: &locked},
+	}
+	srv := NewWithConfig(cfg, mockDocker, session.NewManager())
+	srv.StartWarmPool(1, false)
+	defer srv.StopWarmPool()
+	waitForWarm(t, srv, 1)
+
+	// Pool and session containers of the default image get the default profile
+	for _, containerID := range poolContainers(t, mockDocker) {
+		c, _ := mockDocker.GetContainer(containerID)
+		sec := c.Security
+		if sec.NetworkMode != "none" || sec.PidsLimit != 128 || !sec.NoNewPrivileges || sec.ReadOnlyRootfs {
+			t.Errorf("unexpected pool container security %+v", sec)
+		}
+		if len(sec.CapDrop) != 1 || sec.CapDrop[0] != "ALL" {
+			t.Errorf("expected all capabilities dropped, got %v", sec.CapDrop)
+		}
+		if len(sec.Ulimits) != 2 || sec.Ulimits[0].Name != "core" || sec.Ulimits[1].Name != "nofile" {
+			t.Errorf("expected sorted ulimits, got %v", sec.Ulimits)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/session", strings.NewReader(`{"image": "shellcraft/arena:v1"}`))
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	var response map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	c, _ := mockDocker.GetContainer(response["container_id"])
+	if !c.Security.ReadOnlyRootfs || c.Security.Tmpfs["/tmp"] != "size=16m" || c.Security.NetworkMode != "none" {
+		t.Errorf("expected the arena's read-only profile, got %+v", c.Security)
+	}
+}
+
+func TestCreateSession_SelectsProfile(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	cfg := config.Default()
+	cfg.Profiles = map[string]config.ProfileConfig{
+		"sandboxed": {MemoryMB: 128, CPUShares: 512, CPUs: 0.5, PidsLimit: 64, Runtime: "runsc"},
+	}
+	cfg.Games = []config.GameConfig{
+		{Image: cfg.Image, Profiles: []string{"sandboxed"}},
+		{Image: "shellcraft/tutorial:v1"},
+	}
+	srv := NewWithConfig(cfg, mockDocker, session.NewManager())
+
+	req := httptest.NewRequest(http.MethodPost, "/session", strings.NewReader(`{"profile": "sandboxed"}`))
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	c, _ := mockDocker.GetContainer(response["container_id"])
+	want := docker.ResourceProfile{MemoryBytes: 128 << 20, CPUShares: 512, CPUs: 0.5, PidsLimit: 64, Runtime: "runsc"}
+	if c.Resources != want {
+		t.Errorf("expected sandboxed profile %+v, got %+v", want, c.Resources)
+	}
+	if sess, _ := srv.sessionManager.GetSession(response["session_id"]); sess.Profile != "sandboxed" || sess.Image != cfg.Image {
+		t.Errorf("expected session to record its game, got image %q profile %q", sess.Image, sess.Profile)
+	}
+
+	// Profiles are offered per game
+	for _, body := range []string{`{"profile": "huge"}`, `{"image": "shellcraft/tutorial:v1", "profile": "sandboxed"}`} {
+		req := httptest.NewRequest(http.MethodPost, "/session", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", body, http.StatusBadRequest, rec.Code)
+		}
+	}
+	if n := len(srv.sessionManager.ListSessions()); n != 1 {
+		t.Errorf("expected 1 session, got %d", n)
+	}
+}
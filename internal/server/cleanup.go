@@ -5,6 +5,8 @@ import (
 	"log"
 	"sync"
 	"time"
+
+	"github.com/shellcraft/server/internal/docker"
 )
 
 // CleanupManager handles periodic cleanup of idle sessions
@@ -36,6 +38,7 @@ func (s *Server) StartCleanupWithTimeout(interval, idleTimeout time.Duration) {
 		done:        make(chan struct{}),
 		idleTimeout: idleTimeout,
 	}
+	s.idleTimeout = idleTimeout
 
 	s.cleanupManager.wg.Add(1)
 	go s.cleanupManager.run()
@@ -66,6 +69,10 @@ func (cm *CleanupManager) run() {
 			cm.ticker.Stop()
 			return
 		case <-cm.ticker.C:
+			// Activity is persisted here rather than on every message
+			if err := cm.server.sessionManager.FlushActivity(); err != nil {
+				log.Printf("Failed to persist session activity: %v", err)
+			}
 			count := cm.server.CleanupIdleSessions(cm.idleTimeout)
 			if count > 0 {
 				log.Printf("Cleaned up %d idle sessions", count)
@@ -74,15 +81,37 @@ func (cm *CleanupManager) run() {
 	}
 }
 
-// CleanupIdleSessions removes sessions that have been idle for longer than the timeout
+// endedSessionGrace is how long a session whose game exited is kept (so
+// reconnecting clients and the status endpoint can still see why) before its
+// container is removed and its slot freed
+const endedSessionGrace = time.Minute
+
+// CleanupIdleSessions removes sessions that have been idle for longer than the
+// timeout, and sessions whose game exited more than endedSessionGrace ago.
 // Returns the number of sessions cleaned up
 func (s *Server) CleanupIdleSessions(idleTimeout time.Duration) int {
 	ctx := context.Background()
 	idleSessions := s.sessionManager.GetIdleSessions(idleTimeout)
 
+	seen := make(map[string]bool, len(idleSessions))
+	for _, session := range idleSessions {
+		seen[session.ID] = true
+	}
+	for _, session := range s.sessionManager.GetEndedSessions(endedSessionGrace) {
+		if !seen[session.ID] {
+			idleSessions = append(idleSessions, session)
+		}
+	}
+
 	count := 0
 	for _, session := range idleSessions {
-		log.Printf("Cleaning up idle session %s (idle for %v)", session.ID, time.Since(session.LastActivity))
+		reason := cleanedIdle
+		if session.Ended() {
+			reason = cleanedEnded
+			log.Printf("Cleaning up ended session %s (%s)", session.ID, session.EndReason)
+		} else {
+			log.Printf("Cleaning up idle session %s (idle for %v)", session.ID, time.Since(session.LastActivity))
+		}
 
 		// Destroy session and get container ID
 		containerID, err := s.sessionManager.DestroySession(session.ID)
@@ -91,27 +120,98 @@ func (s *Server) CleanupIdleSessions(idleTimeout time.Duration) int {
 			continue
 		}
 
-		// Stop and remove container
-		if containerID != "" {
-			if err := s.dockerClient.StopContainer(ctx, containerID); err != nil {
-				log.Printf("Failed to stop container %s: %v", containerID, err)
-			}
-			if err := s.dockerClient.RemoveContainer(ctx, containerID); err != nil {
-				log.Printf("Failed to remove container %s: %v", containerID, err)
-			}
-		}
+		// Stop container, save soul, and remove container
+		session.ContainerID = containerID
+		s.teardownSession(ctx, session)
 
+		s.instruments.sessionsCleaned.WithLabelValues(reason).Inc()
 		count++
 	}
 
+	// Hand freed slots to clients in the waiting room
+	if count > 0 {
+		s.admitWaiting()
+	}
+
 	return count
 }
 
-// CleanupZombieContainers removes containers that exist in Docker but not in session manager
-// This can happen after a server restart
-func (s *Server) CleanupZombieContainers() error {
-	// TODO: Implement by listing all containers with a specific label
-	// and removing those not in the session manager
-	log.Println("Zombie container cleanup not yet implemented")
-	return nil
+// containerLabels returns the labels identifying a game container as ours
+func (s *Server) containerLabels(sessionID string) map[string]string {
+	return map[string]string{
+		docker.LabelManaged:  "true",
+		docker.LabelInstance: s.instanceID,
+		docker.LabelSession:  sessionID,
+	}
+}
+
+// CleanupZombieContainers reconciles Docker with the session manager on startup.
+// Containers labelled for this instance that still match a stored session are
+// adopted, and the session ended if its game exited meanwhile; all others
+// are force-removed. Stored sessions whose container no
+// longer exists are dropped. Returns the number of containers removed.
+func (s *Server) CleanupZombieContainers() (int, error) {
+	ctx := context.Background()
+
+	containers, err := s.dockerClient.ListContainers(ctx, map[string]string{
+		docker.LabelManaged:  "true",
+		docker.LabelInstance: s.instanceID,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Warm pool containers carry no session label; match them by ID
+	byContainer := make(map[string]string)
+	for _, sess := range s.sessionManager.ListSessions() {
+		if sess.ContainerID != "" {
+			byContainer[sess.ContainerID] = sess.ID
+		}
+	}
+
+	adopted := make(map[string]bool)
+	removed := 0
+	for _, c := range containers {
+		sessionID := c.Labels[docker.LabelSession]
+		if owner, ok := byContainer[c.ID]; ok {
+			sessionID = owner
+		}
+		sess, exists := s.sessionManager.GetSession(sessionID)
+		if exists && (sess.ContainerID == "" || sess.ContainerID == c.ID) {
+			if sess.ContainerID == "" {
+				s.sessionManager.AttachContainer(sessionID, c.ID)
+			}
+			adopted[sessionID] = true
+			log.Printf("Adopted container %s for session %s", c.ID, sessionID)
+
+			// The game may have ended while we were down; the session ends
+			// with it and is cleaned up, rather than restarted on reconnect
+			if !sess.Ended() {
+				if state, err := s.dockerClient.InspectContainer(ctx, c.ID); err != nil {
+					log.Printf("Failed to inspect container %s: %v", c.ID, err)
+				} else if exited(state) {
+					s.endExited(ctx, sessionID, c.ID, state)
+				}
+			}
+			continue
+		}
+
+		log.Printf("Removing zombie container %s (session %s)", c.ID, sessionID)
+		if err := s.dockerClient.RemoveContainer(ctx, c.ID); err != nil {
+			log.Printf("Failed to remove container %s: %v", c.ID, err)
+			continue
+		}
+		removed++
+	}
+
+	// Drop stored sessions whose container disappeared while we were down
+	for _, sess := range s.sessionManager.ListSessions() {
+		if !adopted[sess.ID] {
+			log.Printf("Dropping session %s: container %q no longer exists", sess.ID, sess.ContainerID)
+			s.sessionManager.DestroySession(sess.ID)
+		}
+	}
+
+	log.Printf("Container reconciliation: %d adopted, %d removed", len(adopted), removed)
+	return removed, nil
 }
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -142,3 +143,108 @@ func TestCleanupManager_CleanupMetrics(t *testing.T) {
 		t.Errorf("expected 2 sessions remaining, got %d", len(sessions))
 	}
 }
+
+func TestCleanupZombieContainers_AdoptsAndReaps(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	ctx := context.Background()
+
+	// A live session whose container should be adopted
+	sessionID, containerID := createTestSession(t, srv)
+
+	// An orphan from a previous run whose session is gone
+	orphanID, _ := mockDocker.CreateContainer(ctx, "shellcraft/game:latest",
+		docker.NewGameContainerConfig("shellcraft/game:latest", srv.containerLabels("gone-session")), docker.ResourceProfile{}, docker.SecurityProfile{})
+
+	// A container belonging to another server instance must be left alone
+	foreignLabels := srv.containerLabels("other-session")
+	foreignLabels[docker.LabelInstance] = "other-instance"
+	foreignID, _ := mockDocker.CreateContainer(ctx, "shellcraft/game:latest",
+		docker.NewGameContainerConfig("shellcraft/game:latest", foreignLabels), docker.ResourceProfile{}, docker.SecurityProfile{})
+
+	// A stored session whose container vanished
+	staleID := srv.sessionManager.NewSession()
+	srv.sessionManager.AttachContainer(staleID, "missing-container")
+
+	// Simulate restart: new server sharing the same Docker and session store
+	restarted := NewWithSessionManager(mockDocker, srv.sessionManager)
+	removed, err := restarted.CleanupZombieContainers()
+	if err != nil {
+		t.Fatalf("CleanupZombieContainers failed: %v", err)
+	}
+
+	if removed != 1 {
+		t.Errorf("expected 1 container removed, got %d", removed)
+	}
+	if _, exists := mockDocker.GetContainer(containerID); !exists {
+		t.Error("container with a live session should be adopted")
+	}
+	if _, exists := restarted.sessionManager.GetSession(sessionID); !exists {
+		t.Error("adopted session should remain")
+	}
+	if _, exists := mockDocker.GetContainer(orphanID); exists {
+		t.Error("orphan container should be removed")
+	}
+	if _, exists := mockDocker.GetContainer(foreignID); !exists {
+		t.Error("other instance's container should not be touched")
+	}
+	if _, exists := restarted.sessionManager.GetSession(staleID); exists {
+		t.Error("session without a container should be dropped")
+	}
+}
+
+func TestCleanupZombieContainers_AdoptsWarmPoolContainer(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	srv.StartWarmPool(2, false)
+	waitForWarm(t, srv, 2)
+
+	// Pool containers have no session label
+	sessionID, containerID := createTestSession(t, srv)
+
+	// Simulate a crash: refilling stops but nothing is cleaned up
+	close(srv.pool.done)
+	srv.pool.wg.Wait()
+
+	restarted := NewWithSessionManager(mockDocker, srv.sessionManager)
+	if _, err := restarted.CleanupZombieContainers(); err != nil {
+		t.Fatalf("CleanupZombieContainers failed: %v", err)
+	}
+
+	if _, exists := mockDocker.GetContainer(containerID); !exists {
+		t.Error("taken pool container should be adopted by its session")
+	}
+	if _, exists := restarted.sessionManager.GetSession(sessionID); !exists {
+		t.Error("session should remain")
+	}
+	if ids := poolContainers(t, mockDocker); len(ids) != 1 {
+		t.Errorf("unused pool containers from the previous run should be removed, got %v", ids)
+	}
+}
+
+func TestCleanupZombieContainers_EndsSessionsWhoseGameExited(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	ctx := context.Background()
+
+	// The game crashed while the server was down
+	crashedID, crashedContainer := createTestSession(t, srv)
+	mockDocker.StartContainer(ctx, crashedContainer)
+	mockDocker.SimulateExit(crashedContainer, 2, false)
+
+	// Created but never started: the player hasn't connected yet
+	waitingID, _ := createTestSession(t, srv)
+
+	restarted := NewWithSessionManager(mockDocker, srv.sessionManager)
+	if _, err := restarted.CleanupZombieContainers(); err != nil {
+		t.Fatalf("CleanupZombieContainers failed: %v", err)
+	}
+
+	sess := mustGetSession(t, restarted, crashedID)
+	if !sess.Ended() || sess.EndReason != endReasonCrashed || sess.ExitCode != 2 {
+		t.Errorf("expected the session to end as crashed with code 2, got %q (%d)", sess.EndReason, sess.ExitCode)
+	}
+	if sess := mustGetSession(t, restarted, waitingID); sess.Ended() {
+		t.Errorf("expected the unstarted session to carry on, got %q", sess.EndReason)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shellcraft/server/internal/docker"
+)
+
+// expectClose reads until the connection closes and checks the close code
+func expectClose(t *testing.T, ws *websocket.Conn, code int) {
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := ws.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, code) {
+			t.Errorf("expected close code %d, got %v", code, err)
+		}
+		return
+	}
+}
+
+func TestController_SecondConnectionRejected(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, _ := createTestSession(t, srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	first := dialTyped(t, srv, server.URL, sessionID)
+	defer first.Close()
+	readControl(t, first, msgStatus)
+
+	second := dialTyped(t, srv, server.URL, sessionID)
+	defer second.Close()
+	expectClose(t, second, closeControllerActive)
+
+	// The first connection keeps working
+	first.WriteJSON(clientMessage{Type: msgInput, Data: "help\r"})
+	readOutputContaining(t, first, "help\r")
+}
+
+func TestController_Takeover(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, _ := createTestSession(t, srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	first := dialTyped(t, srv, server.URL, sessionID)
+	defer first.Close()
+	readControl(t, first, msgStatus)
+
+	second := dialTypedQuery(t, srv, server.URL, sessionID, "takeover=1")
+	defer second.Close()
+	readControl(t, second, msgStatus)
+
+	expectClose(t, first, closeTakenOver)
+
+	second.WriteJSON(clientMessage{Type: msgInput, Data: "ls\r"})
+	readOutputContaining(t, second, "ls\r")
+}
+
+func TestController_ReleasedOnDisconnect(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, _ := createTestSession(t, srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	first := dialTyped(t, srv, server.URL, sessionID)
+	readControl(t, first, msgStatus)
+	first.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	first.Close()
+
+	// Once the server sees the close, a plain connection is accepted again
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		srv.terminalsMu.Lock()
+		term := srv.terminals[sessionID]
+		srv.terminalsMu.Unlock()
+		if term != nil && term.isController(nil) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	second := dialTyped(t, srv, server.URL, sessionID)
+	defer second.Close()
+	readControl(t, second, msgStatus)
+}
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// countdownSteps are the remaining times at which players are warned again
+// before a drain ends their sessions, besides when the countdown starts
+var countdownSteps = []time.Duration{
+	5 * time.Minute,
+	2 * time.Minute,
+	time.Minute,
+	30 * time.Second,
+	10 * time.Second,
+	5 * time.Second,
+}
+
+// gameExitTimeout bounds how long a game gets to save and quit after exit is
+// typed into it, before its container is stopped
+const gameExitTimeout = 10 * time.Second
+
+// exitCommand quits the game, which saves on the way out. ^U first clears
+// anything the player had half typed.
+const exitCommand = "\x15exit\n"
+
+// drainParallelism bounds how many sessions are torn down at once, so a
+// drain doesn't flood the Docker daemon
+const drainParallelism = 32
+
+// errDraining is returned when the server is draining and admits no new
+// sessions
+var errDraining = errors.New("server is draining")
+
+// errShuttingDown fails the waiting room's tickets when the server shuts down
+var errShuttingDown = errors.New("server is shutting down")
+
+// SetDraining starts or stops draining. A draining server turns away new
+// sessions and leaves the waiting room queued; running sessions carry on.
+// Stopping cancels a countdown started by StartDrain.
+func (s *Server) SetDraining(draining bool) {
+	if !draining {
+		s.cancelDrain()
+	}
+	if s.draining.Swap(draining) == draining {
+		return
+	}
+
+	if draining {
+		log.Println("Draining: no longer accepting new sessions")
+		return
+	}
+	log.Println("Stopped draining: accepting new sessions")
+
+	// Slots may have freed up while the waiting room was held
+	s.admitWaiting()
+}
+
+// Draining reports whether the server is draining
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
+
+// Drain stops admitting sessions, warns every connected player with a
+// countdown of warning, then ends every session: its game is told to exit so
+// it saves, its soul is copied to the vault, and its container is removed.
+// If ctx is cancelled during the countdown, sessions are left running. Once
+// they are being ended, only ctx's deadline cuts that short, and the error
+// says how many sessions were left.
+func (s *Server) Drain(ctx context.Context, warning time.Duration) error {
+	s.SetDraining(true)
+	return s.drain(ctx, warning)
+}
+
+// drain counts down and ends every session for Drain, once draining
+func (s *Server) drain(ctx context.Context, warning time.Duration) error {
+	// Nobody to warn, so nothing to wait for
+	if len(s.sessionManager.ListSessions()) == 0 {
+		log.Println("Draining: no sessions to end")
+		return nil
+	}
+	log.Printf("Draining: ending sessions in %v", warning)
+
+	if err := s.countdown(ctx, warning); err != nil {
+		log.Printf("Drain countdown cancelled: %v", err)
+		return err
+	}
+	return s.endSessions(ctx)
+}
+
+// StartDrain runs Drain in the background, allowing the shutdown timeout
+// after the warning. SetDraining(false) cancels it.
+func (s *Server) StartDrain(warning time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), warning+s.shutdownTimeout)
+
+	s.drainMu.Lock()
+	if s.drainCancel != nil {
+		s.drainCancel()
+	}
+	s.drainCancel = cancel
+	s.drainMu.Unlock()
+	s.SetDraining(true)
+
+	go func() {
+		defer cancel()
+		if err := s.drain(ctx, warning); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("Drain incomplete: %v", err)
+		}
+	}()
+}
+
+// cancelDrain stops a countdown started by StartDrain, if any
+func (s *Server) cancelDrain() {
+	s.drainMu.Lock()
+	defer s.drainMu.Unlock()
+
+	if s.drainCancel != nil {
+		s.drainCancel()
+		s.drainCancel = nil
+	}
+}
+
+// Shutdown prepares the server to exit: clients in the waiting room are
+// turned away, then either every session is ended by draining with the
+// configured warning, or, if sessions are kept, players are disconnected and
+// their containers left running for the next start to adopt. It returns once
+// that is done or ctx is.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.cancelDrain()
+	s.SetDraining(true)
+	s.waitingRoom.closeAll(errShuttingDown)
+
+	var err error
+	if s.keepSessions {
+		s.detachClients(ctx)
+	} else {
+		err = s.Drain(ctx, s.shutdownWarning)
+	}
+
+	// Keep the last activity of any session left behind
+	if err := s.sessionManager.FlushActivity(); err != nil {
+		log.Printf("Failed to persist session activity: %v", err)
+	}
+	return err
+}
+
+// countdown warns every connected player that their session ends after
+// warning, and again at each step on the way
+func (s *Server) countdown(ctx context.Context, warning time.Duration) error {
+	if warning <= 0 {
+		return nil
+	}
+
+	end := time.Now().Add(warning)
+	s.broadcastShutdown(warning)
+	for _, step := range countdownSteps {
+		if step >= warning {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(end.Add(-step))):
+			s.broadcastShutdown(step)
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(end)):
+		return nil
+	}
+}
+
+// broadcastShutdown tells every connected player how long their session has left
+func (s *Server) broadcastShutdown(remaining time.Duration) {
+	message := "The server is shutting down in " + formatCountdown(remaining) + "."
+	if s.vault != nil {
+		message += " Your progress will be saved."
+	}
+	msg := serverMessage{
+		Type:    msgShutdown,
+		Message: message,
+		Seconds: int(remaining.Round(time.Second).Seconds()),
+	}
+
+	terminals := s.liveTerminals()
+	for _, t := range terminals {
+		t.notify(msg)
+	}
+	log.Printf("Warned %d terminals: %s", len(terminals), message)
+}
+
+// detachClients tells every connected client the server is restarting and
+// disconnects it with a retryable code. The terminals and containers are
+// left running.
+func (s *Server) detachClients(ctx context.Context) {
+	terminals := s.liveTerminals()
+	log.Printf("Keeping %d sessions; disconnecting %d terminals", len(s.sessionManager.ListSessions()), len(terminals))
+
+	msg := serverMessage{
+		Type:    msgShutdown,
+		Message: "The server is restarting. Your session will resume when it is back.",
+	}
+	var wg sync.WaitGroup
+	for _, t := range terminals {
+		t.notify(msg)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.disconnect(websocket.CloseServiceRestart, "Server restarting")
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// liveTerminals returns every running terminal
+func (s *Server) liveTerminals() []*terminal {
+	s.terminalsMu.Lock()
+	defer s.terminalsMu.Unlock()
+
+	terminals := make([]*terminal, 0, len(s.terminals))
+	for _, t := range s.terminals {
+		terminals = append(terminals, t)
+	}
+	return terminals
+}
+
+// formatCountdown renders a countdown step such as "2 minutes" or "10 seconds"
+func formatCountdown(d time.Duration) string {
+	n, unit := int(d.Round(time.Second).Seconds()), "second"
+	if d >= time.Minute && d%time.Minute == 0 {
+		n, unit = int(d/time.Minute), "minute"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
+
+// endSessions tears down every session, a few at a time. The teardowns
+// aren't cancelled with ctx, only bounded by its deadline, so a cancelled
+// drain doesn't leave containers half removed.
+func (s *Server) endSessions(ctx context.Context) error {
+	sessions := s.sessionManager.ListSessions()
+	if len(sessions) == 0 {
+		return nil
+	}
+	log.Printf("Ending %d sessions", len(sessions))
+
+	teardownCtx := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		teardownCtx, cancel = context.WithDeadline(teardownCtx, deadline)
+		defer cancel()
+	}
+
+	var wg sync.WaitGroup
+	var ended atomic.Int64
+	slots := make(chan struct{}, drainParallelism)
+	for _, sess := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-teardownCtx.Done():
+				return
+			}
+			defer func() { <-slots }()
+
+			s.exitGame(teardownCtx, sess.ID)
+			s.terminateSession(teardownCtx, sess.ID)
+			ended.Add(1)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Printf("Ended %d sessions", len(sessions))
+		return nil
+	case <-teardownCtx.Done():
+		return fmt.Errorf("%d of %d sessions not ended: %w", len(sessions)-int(ended.Load()), len(sessions), teardownCtx.Err())
+	}
+}
+
+// exitGame types exit into a session's game so it saves and quits, and waits
+// for its container to stop, leaving at least half the time before ctx's
+// deadline to tear it down. A session without a terminal has no game running.
+func (s *Server) exitGame(ctx context.Context, sessionID string) {
+	t, exists := s.liveTerminal(sessionID)
+	if !exists {
+		return
+	}
+
+	t.mu.Lock()
+	t.closing = true // clients are told the server ended it, not the player
+	t.mu.Unlock()
+	if err := t.write([]byte(exitCommand)); err != nil {
+		log.Printf("Failed to exit game in session %s: %v", sessionID, err)
+		return
+	}
+
+	wait := gameExitTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		wait = min(wait, time.Until(deadline)/2)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	if _, err := s.dockerClient.WaitContainer(waitCtx, t.containerID); err != nil {
+		log.Printf("Game in session %s didn't exit, stopping it: %v", sessionID, err)
+	}
+}
@@ -0,0 +1,321 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shellcraft/server/internal/docker"
+	"github.com/shellcraft/server/internal/vault"
+)
+
+func TestDraining_RefusesNewSessions(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	sessionID, _ := createTestSession(t, srv)
+
+	srv.SetDraining(true)
+
+	rec := postSession(srv, playerAddr(), nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if n := len(srv.sessionManager.ListSessions()); n != 1 {
+		t.Errorf("expected only the existing session, got %d", n)
+	}
+
+	// Running sessions carry on
+	req := authorize(srv, httptest.NewRequest(http.MethodGet, "/session/"+sessionID+"/status", nil), sessionID)
+	rec = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var metrics ServerMetrics
+	json.Unmarshal(rec.Body.Bytes(), &metrics)
+	if !metrics.Draining || metrics.Status != "draining" {
+		t.Errorf("expected metrics to report draining, got %+v", metrics)
+	}
+
+	srv.SetDraining(false)
+	if rec := postSession(srv, playerAddr(), nil); rec.Code != http.StatusOK {
+		t.Errorf("expected sessions after draining stops, got %d", rec.Code)
+	}
+}
+
+func TestDraining_HoldsWaitingRoom(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	ids := fillToCapacity(srv)
+	queueSession(t, srv)
+
+	srv.SetDraining(true)
+	srv.sessionManager.DestroySession(ids[0])
+	srv.admitWaiting()
+	if n := srv.waitingRoom.length(); n != 1 {
+		t.Fatalf("expected the queued client to be held, got queue length %d", n)
+	}
+
+	// Leaving drain mode admits into the freed slot
+	srv.SetDraining(false)
+	if n := srv.waitingRoom.length(); n != 0 {
+		t.Errorf("expected the queued client to be admitted, got queue length %d", n)
+	}
+}
+
+// exitingGame is a mock game that quits when exit is typed, recording its
+// input and whether it was still running when stopped
+type exitingGame struct {
+	*docker.MockClient
+
+	mu     sync.Mutex
+	events []string
+}
+
+// gameInput passes input through to the mock container and quits on exit
+type gameInput struct {
+	io.WriteCloser
+	game        *exitingGame
+	containerID string
+}
+
+func (in *gameInput) Write(p []byte) (int, error) {
+	in.game.record("input " + strings.TrimLeft(string(p), "\x15"))
+	n, err := in.WriteCloser.Write(p)
+	if strings.HasSuffix(string(p), "exit\n") {
+		in.game.SimulateExit(in.containerID, 0, false)
+	}
+	return n, err
+}
+
+func (g *exitingGame) record(event string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.events = append(g.events, event)
+}
+
+func (g *exitingGame) recorded() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.events...)
+}
+
+func (g *exitingGame) AttachContainer(ctx context.Context, containerID string) (*docker.AttachResult, error) {
+	attach, err := g.MockClient.AttachContainer(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	attach.Writer = &gameInput{WriteCloser: attach.Writer, game: g, containerID: containerID}
+	return attach, nil
+}
+
+func (g *exitingGame) StopContainer(ctx context.Context, containerID string) error {
+	if state, err := g.InspectContainer(ctx, containerID); err == nil && state.Running {
+		g.record("stop running")
+	} else {
+		g.record("stop exited")
+	}
+	return g.MockClient.StopContainer(ctx, containerID)
+}
+
+func TestShutdown_WarnsPlayersThenSavesAndRemoves(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	game := &exitingGame{MockClient: mockDocker}
+	srv := NewWithDockerClient(game)
+	v := vault.NewMemoryVault()
+	srv.SetVault(v)
+	srv.shutdownWarning = 50 * time.Millisecond
+
+	created := createSessionWithToken(t, srv, "")
+	sessionID, containerID := created["session_id"], created["container_id"]
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	ws := dialTyped(t, srv, server.URL, sessionID)
+	defer ws.Close()
+	readControl(t, ws, msgStatus)
+
+	// The game saves as it goes
+	soul := []byte("SHC!level-up")
+	mockDocker.CopyToContainer(context.Background(), containerID, soulPath, soul, soulOwnerID, soulOwnerID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() { result <- srv.Shutdown(ctx) }()
+
+	warning := readControl(t, ws, msgShutdown)
+	if !strings.Contains(warning.Message, "shutting down") || !strings.Contains(warning.Message, "saved") {
+		t.Errorf("unexpected warning %q", warning.Message)
+	}
+	if msg := readControl(t, ws, msgExit); msg.Reason != endReasonShutdown {
+		t.Errorf("expected reason %q, got %q", endReasonShutdown, msg.Reason)
+	}
+	expectClose(t, ws, closeSessionEnded)
+
+	if err := <-result; err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if _, exists := srv.sessionManager.GetSession(sessionID); exists {
+		t.Error("expected session to be ended")
+	}
+	if _, exists := mockDocker.GetContainer(containerID); exists {
+		t.Error("expected container to be removed")
+	}
+	if saved, err := v.Load(created["player_token"]); err != nil || !bytes.Equal(saved, soul) {
+		t.Errorf("expected soul %q in the vault, got %q (%v)", soul, saved, err)
+	}
+	if rec := postSession(srv, playerAddr(), nil); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected no new sessions after shutdown, got %d", rec.Code)
+	}
+}
+
+func TestShutdown_ExitsGameBeforeStopping(t *testing.T) {
+	game := &exitingGame{MockClient: docker.NewMockClient()}
+	srv := NewWithDockerClient(game)
+	srv.shutdownWarning = 0
+	sessionID, _ := createTestSession(t, srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	ws := dialTyped(t, srv, server.URL, sessionID)
+	defer ws.Close()
+	readControl(t, ws, msgStatus)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	// The game saves on exit, so it must quit before it is stopped
+	want := []string{"input exit\n", "stop exited"}
+	if got := game.recorded(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestShutdown_KeepsSessions(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	srv.keepSessions = true
+	srv.shutdownWarning = time.Hour
+	sessionID, containerID := createTestSession(t, srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	ws := dialTyped(t, srv, server.URL, sessionID)
+	defer ws.Close()
+	readControl(t, ws, msgStatus)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() { result <- srv.Shutdown(ctx) }()
+
+	// No countdown: the player is told to expect a resume and may reconnect
+	if msg := readControl(t, ws, msgShutdown); !strings.Contains(msg.Message, "resume") {
+		t.Errorf("unexpected notice %q", msg.Message)
+	}
+	expectClose(t, ws, websocket.CloseServiceRestart)
+
+	if err := <-result; err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if _, exists := srv.sessionManager.GetSession(sessionID); !exists {
+		t.Error("expected session to be kept")
+	}
+	if c, exists := mockDocker.GetContainer(containerID); !exists || !c.Running {
+		t.Error("expected container to be left running")
+	}
+}
+
+func TestShutdown_TurnsAwayWaitingRoom(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	srv.shutdownWarning = 0
+	fillToCapacity(srv)
+	queued := queueSession(t, srv)
+
+	ticket, _ := srv.waitingRoom.get(queued["ticket"].(string))
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	select {
+	case <-ticket.done:
+		if !errors.Is(ticket.err, errShuttingDown) {
+			t.Errorf("expected %v, got %v", errShuttingDown, ticket.err)
+		}
+	default:
+		t.Fatal("expected the ticket to be failed")
+	}
+	if n := srv.waitingRoom.length(); n != 0 {
+		t.Errorf("expected an empty waiting room, got %d", n)
+	}
+	if n := len(srv.sessionManager.ListSessions()); n != 0 {
+		t.Errorf("expected every session ended, got %d", n)
+	}
+}
+
+func TestShutdown_NoSessionsSkipsCountdown(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	srv.shutdownWarning = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("expected an idle server to shut down at once, got %v", err)
+	}
+}
+
+func TestStartDrain_CancelledByUndraining(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	sessionID, _ := createTestSession(t, srv)
+
+	srv.StartDrain(time.Hour)
+	if !srv.Draining() {
+		t.Fatal("expected draining")
+	}
+
+	srv.SetDraining(false)
+	time.Sleep(50 * time.Millisecond)
+	if _, exists := srv.sessionManager.GetSession(sessionID); !exists {
+		t.Error("expected the session to survive a cancelled drain")
+	}
+	if srv.Draining() {
+		t.Error("expected draining to stop")
+	}
+}
+
+func TestFormatCountdown(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{5 * time.Minute, "5 minutes"},
+		{time.Minute, "1 minute"},
+		{90 * time.Second, "90 seconds"},
+		{time.Second, "1 second"},
+		{30 * time.Second, "30 seconds"},
+	}
+
+	for _, tt := range tests {
+		if got := formatCountdown(tt.d); got != tt.want {
+			t.Errorf("%v: expected %q, got %q", tt.d, tt.want, got)
+		}
+	}
+}
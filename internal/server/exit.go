@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shellcraft/server/internal/docker"
+	"github.com/shellcraft/server/internal/session"
+)
+
+// exitWaitTimeout bounds how long to wait for a container to stop after its
+// output stream ends
+const exitWaitTimeout = 5 * time.Second
+
+// errGameEnded is returned when opening a terminal finds the session's game
+// has already exited; it is not restarted
+var errGameEnded = errors.New("game has ended")
+
+// Reasons a session ended, sent in the exit message and kept on the session
+const (
+	endReasonExited     = "exited"     // the player quit the game
+	endReasonDied       = "died"       // permadeath: the game deleted soul.dat and exited
+	endReasonOOM        = "oom"        // the kernel killed the game for exceeding its memory limit
+	endReasonCrashed    = "crashed"    // the game exited with a non-zero code
+	endReasonTerminated = "terminated" // the server closed the session (deleted or idle)
+	endReasonShutdown   = "shutdown"   // the server ended the session while draining
+)
+
+// endReason classifies a container's final state. soulLost reports whether
+// soul.dat was gone after a clean exit, which is how the game signals death.
+func endReason(state *docker.ContainerState, soulLost bool) string {
+	switch {
+	case state.OOMKilled:
+		return endReasonOOM
+	case state.ExitCode != 0:
+		return endReasonCrashed
+	case soulLost:
+		return endReasonDied
+	default:
+		return endReasonExited
+	}
+}
+
+// endMessage is the text shown to the player for an end reason
+func endMessage(reason string, exitCode int) string {
+	switch reason {
+	case endReasonExited:
+		return "Session ended. Farewell, adventurer."
+	case endReasonDied:
+		return "Session ended. Your soul has dissipated."
+	case endReasonOOM:
+		return "Session ended: the game ran out of memory and was killed."
+	case endReasonCrashed:
+		return fmt.Sprintf("Session ended: the game exited with code %d.", exitCode)
+	case endReasonTerminated:
+		return "Session closed by the server."
+	case endReasonShutdown:
+		return "Session closed: the server is shutting down."
+	default:
+		return "Session ended."
+	}
+}
+
+// exitNotice builds the final message for a session whose container exited
+func exitNotice(reason string, exitCode int) serverMessage {
+	return serverMessage{
+		Type:     msgExit,
+		Status:   "ended",
+		Reason:   reason,
+		ExitCode: &exitCode,
+		Message:  endMessage(reason, exitCode),
+	}
+}
+
+// terminalExit works out why a terminal's output stream ended. If the
+// container exited on its own, the session is marked ended. ok is false if
+// the container could not be confirmed stopped, e.g. the attach stream broke
+// while the game kept running, in which case the client may reconnect.
+func (s *Server) terminalExit(t *terminal) (msg serverMessage, ok bool) {
+	if t.isClosing() {
+		reason := endReasonTerminated
+		if s.Draining() {
+			reason = endReasonShutdown
+		}
+		return serverMessage{
+			Type:    msgExit,
+			Status:  "ended",
+			Reason:  reason,
+			Message: endMessage(reason, 0),
+		}, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exitWaitTimeout)
+	defer cancel()
+
+	state, err := s.dockerClient.WaitContainer(ctx, t.containerID)
+	if err != nil {
+		log.Printf("Lost terminal for session %s: %v", t.sessionID, err)
+		return serverMessage{Type: msgError, Message: "Lost connection to the game"}, false
+	}
+
+	reason := s.endExited(ctx, t.sessionID, t.containerID, state)
+	return exitNotice(reason, state.ExitCode), true
+}
+
+// exited reports whether a container's game ran and has stopped, as opposed
+// to one created but not yet started
+func exited(state *docker.ContainerState) bool {
+	return state.Status == "exited" || state.Status == "dead"
+}
+
+// endExited marks a session ended after its container exited on its own,
+// working out why from the container's final state, and returns the reason.
+// Cleanup removes the container after endedSessionGrace.
+func (s *Server) endExited(ctx context.Context, sessionID, containerID string, state *docker.ContainerState) string {
+	soulLost := false
+	if !state.OOMKilled && state.ExitCode == 0 {
+		_, err := s.dockerClient.CopyFromContainer(ctx, containerID, soulPath)
+		soulLost = errors.Is(err, docker.ErrFileNotFound)
+	}
+
+	reason := endReason(state, soulLost)
+	log.Printf("Session %s ended: %s (exit code %d)", sessionID, reason, state.ExitCode)
+	if err := s.sessionManager.EndSession(sessionID, reason, state.ExitCode); err != nil {
+		log.Printf("Failed to mark session %s ended: %v", sessionID, err)
+	}
+	return reason
+}
+
+// closeEndedSession tells a client why its session's game ended and closes
+// the connection so the client doesn't reconnect
+func closeEndedSession(conn *terminalConn, sess *session.Session) {
+	conn.writeControl(exitNotice(sess.EndReason, sess.ExitCode))
+	conn.close(closeSessionEnded, endMessage(sess.EndReason, sess.ExitCode))
+}
+
+// closeEnded closes a connection once its terminal's output has ended, with
+// closeSessionEnded if the session is over or a retryable code otherwise
+func closeEnded(conn *terminalConn, t *terminal) {
+	msg, ended := t.exitMessage()
+	if !ended {
+		conn.close(websocket.CloseInternalServerErr, msg.Message)
+		return
+	}
+	conn.close(closeSessionEnded, msg.Message)
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shellcraft/server/internal/docker"
+)
+
+func TestEndReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    docker.ContainerState
+		soulLost bool
+		want     string
+	}{
+		{"quit", docker.ContainerState{ExitCode: 0}, false, endReasonExited},
+		{"permadeath", docker.ContainerState{ExitCode: 0}, true, endReasonDied},
+		{"oom", docker.ContainerState{ExitCode: 137, OOMKilled: true}, false, endReasonOOM},
+		{"crash", docker.ContainerState{ExitCode: 255}, false, endReasonCrashed},
+		{"crash without soul", docker.ContainerState{ExitCode: 2}, true, endReasonCrashed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := endReason(&tt.state, tt.soulLost); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestContainerExit_NotifiesAndClosesClient(t *testing.T) {
+	tests := []struct {
+		name      string
+		exitCode  int
+		oomKilled bool
+		keepSoul  bool
+		want      string
+	}{
+		{"quit", 0, false, true, endReasonExited},
+		{"permadeath", 0, false, false, endReasonDied},
+		{"oom", 137, true, true, endReasonOOM},
+		{"crash", 1, false, true, endReasonCrashed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDocker := docker.NewMockClient()
+			srv := NewWithDockerClient(mockDocker)
+			sessionID, containerID := createTestSession(t, srv)
+			if tt.keepSoul {
+				mockDocker.CopyToContainer(context.Background(), containerID, soulPath, []byte("SHC!"), soulOwnerID, soulOwnerID)
+			}
+
+			server := httptest.NewServer(srv.Router())
+			defer server.Close()
+
+			ws := dialTyped(t, srv, server.URL, sessionID)
+			defer ws.Close()
+			readControl(t, ws, msgStatus)
+
+			mockDocker.SimulateExit(containerID, tt.exitCode, tt.oomKilled)
+
+			msg := readControl(t, ws, msgExit)
+			if msg.Reason != tt.want {
+				t.Errorf("expected reason %q, got %q", tt.want, msg.Reason)
+			}
+			if msg.ExitCode == nil || *msg.ExitCode != tt.exitCode {
+				t.Errorf("expected exit code %d, got %v", tt.exitCode, msg.ExitCode)
+			}
+			expectClose(t, ws, closeSessionEnded)
+
+			sess := mustGetSession(t, srv, sessionID)
+			if !sess.Ended() || sess.EndReason != tt.want || sess.ExitCode != tt.exitCode {
+				t.Errorf("expected session ended with %q/%d, got %+v", tt.want, tt.exitCode, sess)
+			}
+		})
+	}
+}
+
+func TestContainerExit_ReconnectDoesNotRestart(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, containerID := createTestSession(t, srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	ws := dialTyped(t, srv, server.URL, sessionID)
+	readControl(t, ws, msgStatus)
+	mockDocker.SimulateExit(containerID, 137, true)
+	expectClose(t, ws, closeSessionEnded)
+	ws.Close()
+
+	ws = dialTypedQuery(t, srv, server.URL, sessionID, "takeover=1")
+	defer ws.Close()
+
+	msg := readControl(t, ws, msgExit)
+	if msg.Reason != endReasonOOM {
+		t.Errorf("expected reason %q, got %q", endReasonOOM, msg.Reason)
+	}
+	expectClose(t, ws, closeSessionEnded)
+
+	if c, _ := mockDocker.GetContainer(containerID); c.Running {
+		t.Error("ended session's container should not be restarted")
+	}
+}
+
+func TestContainerExit_WhileDetachedIsNotRestarted(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, containerID := createTestSession(t, srv)
+
+	// The game exits with no terminal attached, e.g. between a restart and
+	// the player reconnecting
+	mockDocker.StartContainer(context.Background(), containerID)
+	mockDocker.SimulateExit(containerID, 2, false)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	ws := dialTyped(t, srv, server.URL, sessionID)
+	defer ws.Close()
+
+	if msg := readControl(t, ws, msgExit); msg.Reason != endReasonCrashed {
+		t.Errorf("expected reason %q, got %q", endReasonCrashed, msg.Reason)
+	}
+	expectClose(t, ws, closeSessionEnded)
+
+	if c, _ := mockDocker.GetContainer(containerID); c.Running {
+		t.Error("exited container should not be restarted")
+	}
+	if sess := mustGetSession(t, srv, sessionID); !sess.Ended() {
+		t.Error("expected the session to be marked ended")
+	}
+}
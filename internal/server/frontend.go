@@ -13,7 +13,7 @@ const terminalHTML = `<!DOCTYPE html>
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>ShellCraft Terminal - Session {{.SessionID}}</title>
+    <title>{{.Title}}</title>
     <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/xterm@5.3.0/css/xterm.css" />
     <style>
         body {
@@ -52,13 +52,14 @@ const terminalHTML = `<!DOCTYPE html>
     <script src="https://cdn.jsdelivr.net/npm/xterm@5.3.0/lib/xterm.js"></script>
     <script src="https://cdn.jsdelivr.net/npm/xterm-addon-fit@0.8.0/lib/xterm-addon-fit.js"></script>
     <script>
-        const sessionId = '{{.SessionID}}';
+        const wsPath = '{{.WSPath}}';
+        const readOnly = {{.ReadOnly}};
         const wsProtocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
         // Extract base path from current URL (e.g., "/shellcraft" or "")
-        // Skip if path starts with /session (that's our own path, not a base)
+        // Skip if path starts with /session or /watch (that's our own path, not a base)
         const pathParts = window.location.pathname.split('/');
-        const basePath = (pathParts.length > 3 && pathParts[1] !== 'session') ? '/' + pathParts[1] : '';
-        const wsUrl = wsProtocol + '//' + window.location.host + basePath + '/session/' + sessionId + '/ws';
+        const basePath = (pathParts.length > 3 && pathParts[1] !== 'session' && pathParts[1] !== 'watch') ? '/' + pathParts[1] : '';
+        const wsUrl = wsProtocol + '//' + window.location.host + basePath + wsPath;
 
         console.log('WebSocket setup:', {
             pathname: window.location.pathname,
@@ -69,7 +70,8 @@ const terminalHTML = `<!DOCTYPE html>
 
         // Initialize terminal
         const term = new Terminal({
-            cursorBlink: true,
+            cursorBlink: !readOnly,
+            disableStdin: readOnly,
             fontSize: 14,
             fontFamily: 'Menlo, Monaco, "Courier New", monospace',
             theme: {
@@ -92,31 +94,118 @@ const terminalHTML = `<!DOCTYPE html>
         });
 
         // WebSocket connection
+        // Request the typed protocol; if the server doesn't accept it
+        // (ws.protocol is empty) fall back to raw mode
+        const protocolV1 = '{{.Protocol}}';
+        const closeControllerActive = {{.CloseControllerActive}};
+        const closeTakenOver = {{.CloseTakenOver}};
+        const closeSessionEnded = {{.CloseSessionEnded}};
+        let awaitingTakeover = false;
         let ws;
         let reconnectAttempts = 0;
         const maxReconnectAttempts = 5;
+        let pingTimer = null;
 
-        function connect() {
+        function typed() {
+            return ws && ws.protocol === protocolV1;
+        }
+
+        function send(message) {
+            if (ws && ws.readyState === WebSocket.OPEN) {
+                ws.send(JSON.stringify(message));
+            }
+        }
+
+        // Tell the server our dimensions so the container TTY matches
+        // (spectators never resize the player's TTY)
+        function sendResize() {
+            if (readOnly) {
+                return;
+            }
+            send({ type: 'resize', cols: term.cols, rows: term.rows });
+        }
+        term.onResize(sendResize);
+
+        // Send terminal input to WebSocket
+        term.onData(data => {
+            if (readOnly) {
+                return;
+            }
+            // Another window has the session: Enter takes control here
+            if (awaitingTakeover) {
+                if (data.includes('\r')) {
+                    awaitingTakeover = false;
+                    connect(true);
+                }
+                return;
+            }
+            if (!ws || ws.readyState !== WebSocket.OPEN) {
+                return;
+            }
+            if (typed()) {
+                send({ type: 'input', data: data });
+            } else {
+                ws.send(data);
+            }
+        });
+
+        // Handle a control message from the server (typed protocol only)
+        function handleControl(message) {
+            const statusEl = document.getElementById('status');
+            switch (message.type) {
+            case 'status':
+                statusEl.textContent = message.status.toUpperCase();
+                // Resuming: the server replays recent output, so start clean
+                if (message.resumed) {
+                    term.reset();
+                }
+                break;
+            case 'pong':
+                statusEl.textContent = 'CONNECTED · ' + (Date.now() - message.ts) + 'ms';
+                break;
+            case 'error':
+                term.write('\r\n\x1b[31m' + message.message + '\x1b[0m\r\n');
+                break;
+            case 'shutdown':
+                term.write('\r\n\x1b[1;33m*** ' + message.message + ' ***\x1b[0m\r\n');
+                break;
+            case 'exit':
+                term.write('\r\n\x1b[33m' + message.message + '\x1b[0m\r\n');
+                break;
+            }
+        }
+
+        // takeover asks the server to disconnect any other window controlling
+        // this session (used for reconnects, where that may be our own stale
+        // connection, and when the player explicitly takes control)
+        function connect(takeover) {
             const statusEl = document.getElementById('status');
             statusEl.textContent = 'CONNECTING...';
             statusEl.classList.remove('disconnected');
 
-            ws = new WebSocket(wsUrl);
+            ws = new WebSocket(wsUrl + (takeover ? '?takeover=1' : ''), [protocolV1]);
+            ws.binaryType = 'arraybuffer';
 
             ws.onopen = () => {
-                console.log('WebSocket connected');
+                console.log('WebSocket connected (protocol: ' + (ws.protocol || 'raw') + ')');
                 statusEl.textContent = 'CONNECTED';
                 reconnectAttempts = 0;
+                sendResize();
+
+                // Measure latency periodically
+                if (typed()) {
+                    pingTimer = setInterval(() => send({ type: 'ping', ts: Date.now() }), 10000);
+                }
             };
 
             ws.onmessage = (event) => {
                 if (typeof event.data === 'string') {
-                    term.write(event.data);
-                } else if (event.data instanceof Blob) {
-                    event.data.arrayBuffer().then(buffer => {
-                        term.write(new Uint8Array(buffer));
-                    });
-                } else if (event.data instanceof ArrayBuffer) {
+                    if (typed()) {
+                        handleControl(JSON.parse(event.data));
+                    } else {
+                        term.write(event.data);
+                    }
+                } else {
                     term.write(new Uint8Array(event.data));
                 }
             };
@@ -127,35 +216,44 @@ const terminalHTML = `<!DOCTYPE html>
                 statusEl.classList.add('disconnected');
             };
 
-            ws.onclose = () => {
-                console.log('WebSocket closed');
+            ws.onclose = (event) => {
+                console.log('WebSocket closed', event.code, event.reason);
                 statusEl.textContent = 'DISCONNECTED';
                 statusEl.classList.add('disconnected');
+                clearInterval(pingTimer);
+
+                // Session controlled from another window: don't fight over it
+                if (event.code === closeControllerActive || event.code === closeTakenOver) {
+                    statusEl.textContent = 'IN USE';
+                    term.write('\r\n\x1b[33m' + event.reason + '. Press Enter to take control here.\x1b[0m\r\n');
+                    awaitingTakeover = true;
+                    return;
+                }
+
+                // The game is over (quit, death, OOM kill): reconnecting won't help
+                if (event.code === closeSessionEnded) {
+                    statusEl.textContent = 'ENDED';
+                    term.write('\r\n\x1b[33mStart a new game from the home page.\x1b[0m\r\n');
+                    return;
+                }
 
                 // Attempt reconnection
                 if (reconnectAttempts < maxReconnectAttempts) {
                     reconnectAttempts++;
                     console.log('Reconnecting in 2 seconds... (attempt ' + reconnectAttempts + ')');
-                    setTimeout(connect, 2000);
+                    setTimeout(() => connect(true), 2000);
                 } else {
                     term.write('\r\n\x1b[31mConnection lost. Refresh the page to reconnect.\x1b[0m\r\n');
                 }
             };
-
-            // Send terminal input to WebSocket
-            term.onData(data => {
-                if (ws.readyState === WebSocket.OPEN) {
-                    ws.send(data);
-                }
-            });
         }
 
         // Initial connection
-        connect();
+        connect(false);
 
         // Welcome message
         term.write('\x1b[32m=== ShellCraft Terminal ===\x1b[0m\r\n');
-        term.write('Session: ' + sessionId + '\r\n');
+        term.write('{{.Label}}\r\n');
         term.write('Connecting to container...\r\n\r\n');
     </script>
 </body>
@@ -164,6 +262,14 @@ const terminalHTML = `<!DOCTYPE html>
 
 var terminalTemplate = template.Must(template.New("terminal").Parse(terminalHTML))
 
+// terminalPage holds the template data for the web terminal
+type terminalPage struct {
+	Title    string
+	Label    string // shown above the terminal output
+	WSPath   string // WebSocket path, relative to the server's base path
+	ReadOnly bool   // spectator mode: no input, no resize
+}
+
 // handleSessionConnect serves the web terminal interface
 func (s *Server) handleSessionConnect(w http.ResponseWriter, r *http.Request) {
 	sessionID := chi.URLParam(r, "id")
@@ -175,10 +281,25 @@ func (s *Server) handleSessionConnect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Render template
+	s.renderTerminal(w, terminalPage{
+		Title:  "ShellCraft Terminal - Session " + sessionID,
+		Label:  "Session: " + sessionID,
+		WSPath: "/session/" + sessionID + "/ws",
+	})
+}
+
+// renderTerminal renders the web terminal template
+func (s *Server) renderTerminal(w http.ResponseWriter, page terminalPage) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	data := map[string]string{
-		"SessionID": sessionID,
+	data := map[string]interface{}{
+		"Title":                 page.Title,
+		"Label":                 page.Label,
+		"WSPath":                page.WSPath,
+		"ReadOnly":              page.ReadOnly,
+		"Protocol":              ProtocolV1,
+		"CloseControllerActive": closeControllerActive,
+		"CloseTakenOver":        closeTakenOver,
+		"CloseSessionEnded":     closeSessionEnded,
 	}
 
 	if err := terminalTemplate.Execute(w, data); err != nil {
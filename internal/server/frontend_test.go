@@ -16,7 +16,7 @@ func TestGetSessionConnect(t *testing.T) {
 	sessionID, _ := createTestSession(t, srv)
 
 	// Request the connect page
-	req := httptest.NewRequest("GET", "/session/"+sessionID+"/connect", nil)
+	req := authorize(srv, httptest.NewRequest("GET", "/session/"+sessionID+"/connect", nil), sessionID)
 	rec := httptest.NewRecorder()
 
 	srv.Router().ServeHTTP(rec, req)
@@ -51,7 +51,7 @@ func TestGetSessionConnect_NotFound(t *testing.T) {
 	mockDocker := docker.NewMockClient()
 	srv := NewWithDockerClient(mockDocker)
 
-	req := httptest.NewRequest("GET", "/session/nonexistent/connect", nil)
+	req := authorize(srv, httptest.NewRequest("GET", "/session/nonexistent/connect", nil), "nonexistent")
 	rec := httptest.NewRecorder()
 
 	srv.Router().ServeHTTP(rec, req)
@@ -67,7 +67,7 @@ func TestGetSessionConnect_ContentType(t *testing.T) {
 
 	sessionID, _ := createTestSession(t, srv)
 
-	req := httptest.NewRequest("GET", "/session/"+sessionID+"/connect", nil)
+	req := authorize(srv, httptest.NewRequest("GET", "/session/"+sessionID+"/connect", nil), sessionID)
 	rec := httptest.NewRecorder()
 
 	srv.Router().ServeHTTP(rec, req)
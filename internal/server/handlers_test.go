@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 
 	"github.com/shellcraft/server/internal/docker"
@@ -42,7 +44,7 @@ func TestCreateSession(t *testing.T) {
 
 func TestCreateSessionWithCustomImage(t *testing.T) {
 	mockDocker := docker.NewMockClient()
-	srv := NewWithDockerClient(mockDocker)
+	srv := newServerWithGames(mockDocker, "busybox:latest")
 
 	body := map[string]string{"image": "busybox:latest"}
 	bodyBytes, _ := json.Marshal(body)
@@ -72,6 +74,28 @@ func TestCreateSessionWithCustomImage(t *testing.T) {
 	}
 }
 
+func TestCreateSession_LabelsContainer(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+
+	sessionID, containerID := createTestSession(t, srv)
+
+	container, exists := mockDocker.GetContainer(containerID)
+	if !exists {
+		t.Fatal("container should exist")
+	}
+
+	if container.Labels[docker.LabelManaged] != "true" {
+		t.Errorf("expected managed label, got %v", container.Labels)
+	}
+	if container.Labels[docker.LabelInstance] != srv.instanceID {
+		t.Errorf("expected instance label %q, got %q", srv.instanceID, container.Labels[docker.LabelInstance])
+	}
+	if container.Labels[docker.LabelSession] != sessionID {
+		t.Errorf("expected session label %q, got %q", sessionID, container.Labels[docker.LabelSession])
+	}
+}
+
 func TestDeleteSession(t *testing.T) {
 	mockDocker := docker.NewMockClient()
 	srv := NewWithDockerClient(mockDocker)
@@ -80,7 +104,7 @@ func TestDeleteSession(t *testing.T) {
 	sessionID, containerID := createTestSession(t, srv)
 
 	// Delete the session
-	req := httptest.NewRequest(http.MethodDelete, "/session/"+sessionID, nil)
+	req := authorize(srv, httptest.NewRequest(http.MethodDelete, "/session/"+sessionID, nil), sessionID)
 	rec := httptest.NewRecorder()
 
 	srv.Router().ServeHTTP(rec, req)
@@ -100,7 +124,7 @@ func TestDeleteSession_NotFound(t *testing.T) {
 	mockDocker := docker.NewMockClient()
 	srv := NewWithDockerClient(mockDocker)
 
-	req := httptest.NewRequest(http.MethodDelete, "/session/nonexistent", nil)
+	req := authorize(srv, httptest.NewRequest(http.MethodDelete, "/session/nonexistent", nil), "nonexistent")
 	rec := httptest.NewRecorder()
 
 	srv.Router().ServeHTTP(rec, req)
@@ -121,7 +145,7 @@ func TestGetSessionStatus(t *testing.T) {
 	mockDocker.StartContainer(context.Background(), containerID)
 
 	// Get status
-	req := httptest.NewRequest(http.MethodGet, "/session/"+sessionID+"/status", nil)
+	req := authorize(srv, httptest.NewRequest(http.MethodGet, "/session/"+sessionID+"/status", nil), sessionID)
 	rec := httptest.NewRecorder()
 
 	srv.Router().ServeHTTP(rec, req)
@@ -130,11 +154,69 @@ func TestGetSessionStatus(t *testing.T) {
 		t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
 	}
 
-	var response map[string]string
+	var response map[string]interface{}
 	json.Unmarshal(rec.Body.Bytes(), &response)
 
 	if response["status"] != "running" {
-		t.Errorf("expected status 'running', got %s", response["status"])
+		t.Errorf("expected status 'running', got %v", response["status"])
+	}
+	if response["running"] != true {
+		t.Errorf("expected running true, got %v", response["running"])
+	}
+	if _, ok := response["started_at"]; !ok {
+		t.Error("expected started_at in response")
+	}
+}
+
+func TestGetSessionStatus_OOMKilled(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+
+	sessionID, containerID := createTestSession(t, srv)
+	mockDocker.StartContainer(context.Background(), containerID)
+	mockDocker.SimulateExit(containerID, 137, true)
+
+	req := authorize(srv, httptest.NewRequest(http.MethodGet, "/session/"+sessionID+"/status", nil), sessionID)
+	rec := httptest.NewRecorder()
+
+	srv.Router().ServeHTTP(rec, req)
+
+	var state docker.ContainerState
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	if state.Status != "exited" {
+		t.Errorf("expected status 'exited', got %s", state.Status)
+	}
+	if !state.OOMKilled {
+		t.Error("expected oom_killed to be true")
+	}
+	if state.ExitCode != 137 {
+		t.Errorf("expected exit code 137, got %d", state.ExitCode)
+	}
+	if state.FinishedAt.IsZero() {
+		t.Error("expected finished_at to be set")
+	}
+}
+
+func TestGetSessionStatus_ContainerMissing(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+
+	sessionID, containerID := createTestSession(t, srv)
+	mockDocker.RemoveContainer(context.Background(), containerID)
+
+	req := authorize(srv, httptest.NewRequest(http.MethodGet, "/session/"+sessionID+"/status", nil), sessionID)
+	rec := httptest.NewRecorder()
+
+	srv.Router().ServeHTTP(rec, req)
+
+	var state docker.ContainerState
+	json.Unmarshal(rec.Body.Bytes(), &state)
+
+	if state.Status != "missing" {
+		t.Errorf("expected status 'missing', got %s", state.Status)
 	}
 }
 
@@ -142,7 +224,7 @@ func TestGetSessionStatus_NotFound(t *testing.T) {
 	mockDocker := docker.NewMockClient()
 	srv := NewWithDockerClient(mockDocker)
 
-	req := httptest.NewRequest(http.MethodGet, "/session/nonexistent/status", nil)
+	req := authorize(srv, httptest.NewRequest(http.MethodGet, "/session/nonexistent/status", nil), "nonexistent")
 	rec := httptest.NewRecorder()
 
 	srv.Router().ServeHTTP(rec, req)
@@ -152,9 +234,32 @@ func TestGetSessionStatus_NotFound(t *testing.T) {
 	}
 }
 
+// playerAddrs numbers test players so each gets its own client address
+var playerAddrs atomic.Uint32
+
+// playerAddr returns a new client address, so helpers creating many sessions
+// don't run into the per-client limits
+func playerAddr() string {
+	n := playerAddrs.Add(1)
+	return fmt.Sprintf("10.%d.%d.%d:1234", n>>16&0xff, n>>8&0xff, n&0xff)
+}
+
+// accessHeader returns an Authorization header carrying a session's access token
+func accessHeader(srv *Server, sessionID string) http.Header {
+	token, _ := srv.tokens.Issue(sessionID)
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+// authorize adds a session's access token to a request
+func authorize(srv *Server, req *http.Request, sessionID string) *http.Request {
+	req.Header.Set("Authorization", accessHeader(srv, sessionID).Get("Authorization"))
+	return req
+}
+
 // Helper function to create a test session
 func createTestSession(t *testing.T, srv *Server) (string, string) {
 	req := httptest.NewRequest(http.MethodPost, "/session", nil)
+	req.RemoteAddr = playerAddr()
 	rec := httptest.NewRecorder()
 
 	srv.Router().ServeHTTP(rec, req)
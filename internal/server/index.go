@@ -125,6 +125,13 @@ const indexHTML = `<!DOCTYPE html>
             <a href="#" id="playLink" class="button">▶️ Play Now</a>
         </div>
 
+        <div class="session-info" id="queueInfo">
+            <h3>⏳ Server Full - You're in Line</h3>
+            <p>Position: <code id="queuePosition">-</code></p>
+            <p>Estimated wait: <code id="queueEta">-</code></p>
+            <p>Keep this page open; your game starts automatically when a slot frees up.</p>
+        </div>
+
         <div class="status" id="status">
             <div class="metrics">
                 Active Sessions: <span id="activeSessions">-</span> / <span id="maxSessions">-</span>
@@ -159,11 +166,15 @@ const indexHTML = `<!DOCTYPE html>
             button.textContent = '⏳ Creating...';
 
             try {
+                // Send our player token so the server can restore our soul
                 const response = await fetch(basePath + '/session', {
                     method: 'POST',
                     headers: {
                         'Content-Type': 'application/json'
-                    }
+                    },
+                    body: JSON.stringify({
+                        player_token: localStorage.getItem('shellcraft_player_token') || ''
+                    })
                 });
 
                 if (response.status === 503) {
@@ -174,22 +185,24 @@ const indexHTML = `<!DOCTYPE html>
                     return;
                 }
 
-                const data = await response.json();
-
-                // Show session info
-                document.getElementById('sessionId').textContent = data.session_id;
-                document.getElementById('containerId').textContent = data.container_id;
-                document.getElementById('playLink').href = basePath + '/session/' + data.session_id + '/connect';
-                document.getElementById('sessionInfo').classList.add('active');
+                if (response.status === 429) {
+                    const error = await response.json();
+                    alert(error.error + '. Please try again in ' + error.retry_after_seconds + ' seconds.');
+                    button.disabled = false;
+                    button.textContent = '🎮 Start New Game';
+                    return;
+                }
 
-                // Update metrics
-                updateMetrics();
+                const data = await response.json();
 
-                // Auto-redirect after 2 seconds
-                setTimeout(() => {
-                    window.location.href = basePath + '/session/' + data.session_id + '/connect';
-                }, 2000);
+                // At capacity: wait in line until the server admits us
+                if (response.status === 202) {
+                    button.textContent = '⏳ Waiting for a slot...';
+                    waitInQueue(data, button);
+                    return;
+                }
 
+                startSession(data);
             } catch (err) {
                 alert('Failed to create session: ' + err);
                 button.disabled = false;
@@ -197,6 +210,77 @@ const indexHTML = `<!DOCTYPE html>
             }
         }
 
+        function formatWait(seconds) {
+            if (seconds < 60) {
+                return 'less than a minute';
+            }
+            const minutes = Math.round(seconds / 60);
+            return '~' + minutes + ' minute' + (minutes === 1 ? '' : 's');
+        }
+
+        function showPosition(position, etaSeconds) {
+            document.getElementById('queuePosition').textContent = '#' + position;
+            document.getElementById('queueEta').textContent = formatWait(etaSeconds);
+        }
+
+        // Follow our place in the waiting room; closing the page gives it up
+        function waitInQueue(ticket, button) {
+            showPosition(ticket.position, ticket.eta_seconds);
+            document.getElementById('queueInfo').classList.add('active');
+
+            const events = new EventSource(basePath + ticket.queue_url);
+            events.addEventListener('position', (event) => {
+                const data = JSON.parse(event.data);
+                showPosition(data.position, data.eta_seconds);
+            });
+            events.addEventListener('admitted', (event) => {
+                events.close();
+                document.getElementById('queueInfo').classList.remove('active');
+                startSession(JSON.parse(event.data));
+            });
+            events.addEventListener('error', (event) => {
+                // Server-sent error event, or the ticket is gone
+                if (event.data || events.readyState === EventSource.CLOSED) {
+                    events.close();
+                    document.getElementById('queueInfo').classList.remove('active');
+                    alert('Lost your place in line. Please try again.');
+                    button.disabled = false;
+                    button.textContent = '🎮 Start New Game';
+                }
+            });
+        }
+
+        // Show the new session and head to its terminal
+        async function startSession(data) {
+            if (data.player_token) {
+                localStorage.setItem('shellcraft_player_token', data.player_token);
+            }
+
+            // The terminal page and its WebSocket authenticate with an
+            // HttpOnly cookie. POST /session sets it directly; a session
+            // admitted from the waiting room binds its token here.
+            await fetch(basePath + '/session/' + data.session_id + '/cookie', {
+                method: 'POST',
+                headers: {
+                    'Authorization': 'Bearer ' + data.access_token
+                }
+            });
+
+            // Show session info
+            document.getElementById('sessionId').textContent = data.session_id;
+            document.getElementById('containerId').textContent = data.container_id;
+            document.getElementById('playLink').href = basePath + '/session/' + data.session_id + '/connect';
+            document.getElementById('sessionInfo').classList.add('active');
+
+            // Update metrics
+            updateMetrics();
+
+            // Auto-redirect after 2 seconds
+            setTimeout(() => {
+                window.location.href = basePath + '/session/' + data.session_id + '/connect';
+            }, 2000);
+        }
+
         // Update metrics every 5 seconds
         updateMetrics();
         setInterval(updateMetrics, 5000);
@@ -8,20 +8,34 @@ import (
 
 // ServerMetrics represents current server resource usage
 type ServerMetrics struct {
-	ActiveSessions   int    `json:"active_sessions"`
-	MaxSessions      int    `json:"max_sessions"`
-	CapacityPercent  int    `json:"capacity_percent"`
-	MemoryAllocMB    uint64 `json:"memory_alloc_mb"`
-	MemorySysMB      uint64 `json:"memory_sys_mb"`
-	NumGoroutines    int    `json:"num_goroutines"`
-	Status           string `json:"status"`
+	ActiveSessions  int    `json:"active_sessions"`
+	MaxSessions     int    `json:"max_sessions"`
+	CapacityPercent int    `json:"capacity_percent"`
+	MemoryAllocMB   uint64 `json:"memory_alloc_mb"`
+	MemorySysMB     uint64 `json:"memory_sys_mb"`
+	NumGoroutines   int    `json:"num_goroutines"`
+	WarmContainers  int    `json:"warm_containers"`
+	QueueLength     int    `json:"queue_length"`
+	CapacityLimitBy string `json:"capacity_limited_by"`
+	CapacityReason  string `json:"capacity_reason"`
+	Status          string `json:"status"`
+	Draining        bool   `json:"draining"`
+
+	// Requests refused with a 429
+	RateLimitedSessions   uint64 `json:"rate_limited_sessions"`
+	RateLimitedConnects   uint64 `json:"rate_limited_connects"`
+	ClientLimitRejections uint64 `json:"client_limit_rejections"`
+
+	// Resource usage summed over running containers; absent until collected
+	ContainerTotals *containerTotals `json:"container_totals,omitempty"`
 }
 
 // handleMetrics returns server metrics
 func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	sessions := s.sessionManager.ListSessions()
 	activeCount := len(sessions)
-	capacityPercent := (activeCount * 100) / MaxConcurrentSessions
+	capacity := s.currentCapacity()
+	capacityPercent := s.usagePercent()
 
 	// Get memory stats
 	var m runtime.MemStats
@@ -33,15 +47,29 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	} else if capacityPercent >= 75 {
 		status = "warning"
 	}
+	if s.Draining() {
+		status = "draining"
+	}
 
 	metrics := ServerMetrics{
-		ActiveSessions:   activeCount,
-		MaxSessions:      MaxConcurrentSessions,
-		CapacityPercent:  capacityPercent,
-		MemoryAllocMB:    m.Alloc / 1024 / 1024,
-		MemorySysMB:      m.Sys / 1024 / 1024,
-		NumGoroutines:    runtime.NumGoroutine(),
-		Status:           status,
+		ActiveSessions:  activeCount,
+		MaxSessions:     capacity.Limit,
+		CapacityPercent: capacityPercent,
+		MemoryAllocMB:   m.Alloc / 1024 / 1024,
+		MemorySysMB:     m.Sys / 1024 / 1024,
+		NumGoroutines:   runtime.NumGoroutine(),
+		WarmContainers:  s.warmContainers(),
+		QueueLength:     s.waitingRoom.length(),
+		CapacityLimitBy: capacity.LimitedBy,
+		CapacityReason:  capacity.Reason,
+		Status:          status,
+		Draining:        s.Draining(),
+
+		RateLimitedSessions:   counterValue(s.instruments.sessionsRejected.WithLabelValues(rejectRateLimited)),
+		RateLimitedConnects:   counterValue(s.instruments.connectsLimited),
+		ClientLimitRejections: counterValue(s.instruments.sessionsRejected.WithLabelValues(rejectClientLimit)),
+
+		ContainerTotals: s.currentTotals(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
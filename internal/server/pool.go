@@ -0,0 +1,356 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/shellcraft/server/internal/docker"
+)
+
+// poolRefillInterval is how often the pool tops itself up when nothing has
+// signalled it, e.g. to use capacity freed by sessions ending
+const poolRefillInterval = 10 * time.Second
+
+// warmPool keeps containers for the default image created (and optionally
+// started) ahead of time so new sessions don't wait on Docker. Pool containers
+// count toward session capacity: the pool only fills into capacity no
+// session is using.
+type warmPool struct {
+	server   *Server
+	size     int
+	prestart bool
+
+	fillMu sync.Mutex // serializes fill so concurrent calls don't overshoot
+
+	mu    sync.Mutex
+	ready []*pooledContainer
+	// attaches holds prestarted containers' attachments between a session
+	// taking the container and its terminal opening
+	attaches map[string]*docker.AttachResult
+
+	refill chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// pooledContainer is a ready container; attach is set if it was prestarted
+type pooledContainer struct {
+	id     string
+	attach *docker.AttachResult
+}
+
+// StartWarmPool keeps size containers of the default image ready for new
+// sessions. With prestart, they are also started and attached, with output
+// buffered until a player connects.
+func (s *Server) StartWarmPool(size int, prestart bool) {
+	if s.pool != nil {
+		log.Println("Warm pool already running")
+		return
+	}
+	if size <= 0 {
+		return
+	}
+
+	s.pool = &warmPool{
+		server:   s,
+		size:     size,
+		prestart: prestart,
+		attaches: make(map[string]*docker.AttachResult),
+		refill:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+
+	s.pool.wg.Add(1)
+	go s.pool.run()
+
+	log.Printf("Started warm pool (size: %d, prestart: %v)", size, prestart)
+}
+
+// StopWarmPool stops refilling and removes containers no session has taken
+func (s *Server) StopWarmPool() {
+	if s.pool == nil {
+		return
+	}
+
+	close(s.pool.done)
+	s.pool.wg.Wait()
+	s.pool.drain()
+	s.pool = nil
+
+	log.Println("Stopped warm pool")
+}
+
+// run refills the pool when signalled and periodically
+func (p *warmPool) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(poolRefillInterval)
+	defer ticker.Stop()
+
+	for {
+		p.fill()
+
+		select {
+		case <-p.done:
+			return
+		case <-p.refill:
+		case <-ticker.C:
+		}
+	}
+}
+
+// target is how many containers the pool should hold: its size, limited to
+// the capacity not taken by sessions, or none while draining
+func (p *warmPool) target() int {
+	if p.server.Draining() {
+		return 0
+	}
+	free := p.server.freeSlots(p.server.defaultCost)
+	return max(0, min(p.size, free))
+}
+
+// fill creates containers up to the target, or removes surplus ones if
+// sessions have since taken the capacity
+func (p *warmPool) fill() {
+	p.fillMu.Lock()
+	defer p.fillMu.Unlock()
+
+	ctx := context.Background()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		default:
+		}
+
+		p.mu.Lock()
+		have := len(p.ready)
+		var surplus *pooledContainer
+		if have > p.target() {
+			surplus = p.ready[0]
+			p.ready = p.ready[1:]
+		}
+		p.mu.Unlock()
+
+		if surplus != nil {
+			p.remove(ctx, surplus)
+			continue
+		}
+		if have >= p.target() {
+			return
+		}
+
+		pc, err := p.create(ctx)
+		if err != nil {
+			log.Printf("Failed to create warm container: %v", err)
+			return
+		}
+
+		p.mu.Lock()
+		p.ready = append(p.ready, pc)
+		p.mu.Unlock()
+	}
+}
+
+// create makes one pool container, starting and attaching it if prestarting
+func (p *warmPool) create(ctx context.Context) (*pooledContainer, error) {
+	s := p.server
+	game, ok := s.resolveImage("")
+	if !ok {
+		return nil, fmt.Errorf("default image %q not in catalog", s.defaultImage)
+	}
+	labels := map[string]string{
+		docker.LabelManaged:  "true",
+		docker.LabelInstance: s.instanceID,
+		docker.LabelPool:     "true",
+	}
+
+	config := docker.NewGameContainerConfig(game.image, labels)
+	containerID, err := s.dockerClient.CreateContainer(ctx, game.image, config, game.resources, game.security)
+	if err != nil {
+		return nil, err
+	}
+	pc := &pooledContainer{id: containerID}
+
+	if !p.prestart {
+		return pc, nil
+	}
+
+	// Attach before starting so the game's first output isn't missed
+	attach, err := s.dockerClient.AttachContainer(ctx, containerID)
+	if err != nil {
+		s.dockerClient.RemoveContainer(ctx, containerID)
+		return nil, err
+	}
+	if err := s.dockerClient.StartContainer(ctx, containerID); err != nil {
+		attach.Writer.Close()
+		s.dockerClient.RemoveContainer(ctx, containerID)
+		return nil, err
+	}
+
+	attach.Reader = newOutputBuffer(attach.Reader)
+	pc.attach = attach
+	return pc, nil
+}
+
+// take hands a ready container to a new session. A returning player whose
+// soul must be copied in before the game starts can't use a prestarted
+// container, so needsCreated skips the pool in that case.
+func (p *warmPool) take(needsCreated bool) *pooledContainer {
+	if p.prestart && needsCreated {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.ready) == 0 {
+		return nil
+	}
+
+	pc := p.ready[0]
+	p.ready = p.ready[1:]
+	if pc.attach != nil {
+		p.attaches[pc.id] = pc.attach
+	}
+
+	// Signal a refill without blocking
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+
+	return pc
+}
+
+// takeAttach returns the attachment of a prestarted container taken from
+// the pool, if its terminal hasn't been opened yet
+func (p *warmPool) takeAttach(containerID string) *docker.AttachResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	attach := p.attaches[containerID]
+	delete(p.attaches, containerID)
+	return attach
+}
+
+// readyCount returns how many containers are waiting in the pool
+func (p *warmPool) readyCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.ready)
+}
+
+// drain removes every ready container
+func (p *warmPool) drain() {
+	p.mu.Lock()
+	ready := p.ready
+	p.ready = nil
+	p.mu.Unlock()
+
+	ctx := context.Background()
+	for _, pc := range ready {
+		p.remove(ctx, pc)
+	}
+}
+
+// remove deletes a pool container no session took
+func (p *warmPool) remove(ctx context.Context, pc *pooledContainer) {
+	if pc.attach != nil {
+		pc.attach.Writer.Close()
+	}
+	if err := p.server.dockerClient.RemoveContainer(ctx, pc.id); err != nil {
+		log.Printf("Failed to remove warm container %s: %v", pc.id, err)
+	}
+}
+
+// takeWarmContainer returns a pool container for a new session of the given
+// image, or "" if the pool is disabled, empty, or doesn't serve that image
+func (s *Server) takeWarmContainer(imageName string, needsCreated bool) string {
+	if s.pool == nil || normalizeImage(imageName) != normalizeImage(s.defaultImage) {
+		return ""
+	}
+
+	pc := s.pool.take(needsCreated)
+	if pc == nil {
+		return ""
+	}
+	return pc.id
+}
+
+// takeWarmAttach returns the attachment of a prestarted pool container
+func (s *Server) takeWarmAttach(containerID string) *docker.AttachResult {
+	if s.pool == nil {
+		return nil
+	}
+	return s.pool.takeAttach(containerID)
+}
+
+// warmContainers returns how many pool containers are ready
+func (s *Server) warmContainers() int {
+	if s.pool == nil {
+		return 0
+	}
+	return s.pool.readyCount()
+}
+
+// outputBuffer holds a prestarted container's output until a session's
+// terminal reads it. Only the most recent scrollbackSize bytes are kept.
+type outputBuffer struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  []byte
+	err  error
+}
+
+func newOutputBuffer(r io.Reader) *outputBuffer {
+	b := &outputBuffer{}
+	b.cond = sync.NewCond(&b.mu)
+	go b.fill(r)
+	return b
+}
+
+// fill copies from r until it fails, waking readers as data arrives
+func (b *outputBuffer) fill(r io.Reader) {
+	chunk := make([]byte, 4096)
+	for {
+		n, err := r.Read(chunk)
+
+		b.mu.Lock()
+		b.buf = append(b.buf, chunk[:n]...)
+		if overflow := len(b.buf) - scrollbackSize; overflow > 0 {
+			b.buf = b.buf[overflow:]
+		}
+		if err != nil {
+			b.err = err
+		}
+		b.cond.Broadcast()
+		b.mu.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read returns buffered output, blocking until some is available
+func (b *outputBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(b.buf) == 0 && b.err == nil {
+		b.cond.Wait()
+	}
+	if len(b.buf) > 0 {
+		n := copy(p, b.buf)
+		b.buf = b.buf[n:]
+		return n, nil
+	}
+	return 0, b.err
+}
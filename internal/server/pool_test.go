@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shellcraft/server/internal/docker"
+	"github.com/shellcraft/server/internal/vault"
+)
+
+// waitForWarm waits until the pool holds n ready containers
+func waitForWarm(t *testing.T, srv *Server, n int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.warmContainers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d warm containers, have %d", n, srv.warmContainers())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// poolContainers returns the IDs of containers created for the pool
+func poolContainers(t *testing.T, mockDocker *docker.MockClient) []string {
+	infos, err := mockDocker.ListContainers(context.Background(), map[string]string{docker.LabelPool: "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 0, len(infos))
+	for _, info := range infos {
+		ids = append(ids, info.ID)
+	}
+	return ids
+}
+
+func TestWarmPool_SessionTakesReadyContainer(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	srv.StartWarmPool(2, false)
+	defer srv.StopWarmPool()
+	waitForWarm(t, srv, 2)
+
+	warm := poolContainers(t, mockDocker)
+	_, containerID := createTestSession(t, srv)
+
+	if containerID != warm[0] && containerID != warm[1] {
+		t.Errorf("expected a warm container, got %s (pool %v)", containerID, warm)
+	}
+	if c, _ := mockDocker.GetContainer(containerID); c.Running {
+		t.Error("pool container should not be started without prestart")
+	}
+
+	// The pool refills in the background
+	waitForWarm(t, srv, 2)
+}
+
+func TestWarmPool_CustomImageBypassesPool(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := newServerWithGames(mockDocker, "alpine:latest")
+	srv.StartWarmPool(1, false)
+	defer srv.StopWarmPool()
+	waitForWarm(t, srv, 1)
+
+	req := httptest.NewRequest(http.MethodPost, "/session", strings.NewReader(`{"image": "alpine:latest"}`))
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	var response map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	if c, _ := mockDocker.GetContainer(response["container_id"]); c.Image != "alpine:latest" {
+		t.Errorf("expected alpine container, got %s", c.Image)
+	}
+	if srv.warmContainers() != 1 {
+		t.Error("warm container should not be used for another image")
+	}
+}
+
+func TestWarmPool_CountsTowardCapacity(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	for i := 0; i < srv.maxSessions()-2; i++ {
+		srv.sessionManager.NewSession()
+	}
+
+	srv.StartWarmPool(5, false)
+	defer srv.StopWarmPool()
+	waitForWarm(t, srv, 2)
+
+	// Taking a warm container uses a slot; the pool can't refill into it
+	createTestSession(t, srv)
+	srv.pool.fill()
+	if n := srv.warmContainers(); n != 1 {
+		t.Errorf("expected 1 warm container with 1 slot free, got %d", n)
+	}
+
+	// Sessions created outside the pool shrink it
+	srv.sessionManager.NewSession()
+	srv.pool.fill()
+	if n := srv.warmContainers(); n != 0 {
+		t.Errorf("expected surplus warm container to be removed, got %d", n)
+	}
+	if ids := poolContainers(t, mockDocker); len(ids) != 1 {
+		t.Errorf("expected only the taken pool container to remain, got %v", ids)
+	}
+}
+
+func TestWarmPool_StopRemovesReadyContainers(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	srv.StartWarmPool(3, false)
+	waitForWarm(t, srv, 3)
+
+	_, taken := createTestSession(t, srv)
+	srv.StopWarmPool()
+
+	ids := poolContainers(t, mockDocker)
+	if len(ids) != 1 || ids[0] != taken {
+		t.Errorf("expected only the session's container %s to remain, got %v", taken, ids)
+	}
+}
+
+func TestWarmPool_Prestart(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	srv.StartWarmPool(1, true)
+	defer srv.StopWarmPool()
+	waitForWarm(t, srv, 1)
+
+	sessionID, containerID := createTestSession(t, srv)
+	if c, _ := mockDocker.GetContainer(containerID); !c.Running {
+		t.Fatal("prestarted pool container should be running")
+	}
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	ws := dialTyped(t, srv, server.URL, sessionID)
+	defer ws.Close()
+
+	// A fresh game, not a resumed one, even though the container was running
+	if msg := readControl(t, ws, msgStatus); msg.Resumed {
+		t.Error("first connection to a prestarted container should not be resumed")
+	}
+	readOutputContaining(t, ws, "You awaken")
+
+	ws.WriteJSON(clientMessage{Type: msgInput, Data: "help\r"})
+	readOutputContaining(t, ws, "help")
+}
+
+func TestWarmPool_PrestartSkippedForReturningSoul(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	v := vault.NewMemoryVault()
+	srv.SetVault(v)
+	token := vault.NewToken()
+	v.Save(token, []byte("SHC!saved"))
+
+	srv.StartWarmPool(1, true)
+	defer srv.StopWarmPool()
+	waitForWarm(t, srv, 1)
+
+	created := createSessionWithToken(t, srv, token)
+	if c, _ := mockDocker.GetContainer(created["container_id"]); c.Running {
+		t.Error("returning player should get a fresh container so the soul is restored before start")
+	}
+	soul, _ := mockDocker.CopyFromContainer(context.Background(), created["container_id"], soulPath)
+	if !bytes.Equal(soul, []byte("SHC!saved")) {
+		t.Errorf("expected soul to be restored, got %q", soul)
+	}
+	if srv.warmContainers() != 1 {
+		t.Error("prestarted warm container should be left for a new player")
+	}
+}
+
+func TestOutputBuffer(t *testing.T) {
+	pr, pw := io.Pipe()
+	b := newOutputBuffer(pr)
+
+	pw.Write([]byte("hello "))
+	pw.Write([]byte("world"))
+	pw.Close()
+
+	data, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if string(data) != "hello world" {
+		t.Errorf("expected buffered output, got %q", data)
+	}
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/shellcraft/server/internal/docker"
+)
+
+// Why a session request was refused, for shellcraft_sessions_rejected_total
+const (
+	rejectInvalid     = "invalid"      // unknown image or profile, or recording disabled
+	rejectQueueFull   = "queue_full"   // at capacity with a full waiting room
+	rejectRateLimited = "rate_limited" // too many requests from the client
+	rejectClientLimit = "client_limit" // too many sessions from the client
+	rejectDraining    = "draining"
+	rejectFailed      = "failed" // no container could be created
+)
+
+// Why cleanup removed a session, for shellcraft_sessions_cleaned_total
+const (
+	cleanedIdle  = "idle"
+	cleanedEnded = "ended"
+)
+
+// dockerBuckets extend the default latency buckets for image pulls
+var dockerBuckets = append(append([]float64{}, prometheus.DefBuckets...), 30, 60, 120)
+
+// sessionDurationBuckets are in seconds, from a minute to eight hours
+var sessionDurationBuckets = []float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800}
+
+// instruments are the server's Prometheus metrics
+type instruments struct {
+	handler http.Handler // serves the registry
+
+	sessionsCreated  prometheus.Counter
+	sessionsRejected *prometheus.CounterVec // by reason
+	sessionsCleaned  *prometheus.CounterVec // by reason
+	sessionDuration  prometheus.Histogram
+	connectsLimited  prometheus.Counter
+
+	dockerLatency *prometheus.HistogramVec // by operation
+	dockerErrors  *prometheus.CounterVec   // by operation
+
+	websocketBytes   *prometheus.CounterVec // by direction
+	connectedClients *prometheus.GaugeVec   // by kind
+}
+
+// newInstruments registers the server's metrics, reading gauges from s,
+// alongside the standard Go runtime and process collectors
+func newInstruments(s *Server) *instruments {
+	r := prometheus.NewRegistry()
+	m := &instruments{
+		handler: promhttp.HandlerFor(r, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+		sessionsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "shellcraft_sessions_created_total",
+			Help: "Sessions given a container.",
+		}),
+		sessionsRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shellcraft_sessions_rejected_total",
+			Help: "Session requests refused, by reason.",
+		}, []string{"reason"}),
+		sessionsCleaned: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shellcraft_sessions_cleaned_total",
+			Help: "Sessions removed by cleanup, by reason.",
+		}, []string{"reason"}),
+		sessionDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "shellcraft_session_duration_seconds",
+			Help:    "How long sessions lasted, from creation to teardown.",
+			Buckets: sessionDurationBuckets,
+		}),
+		connectsLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "shellcraft_websocket_connects_rate_limited_total",
+			Help: "WebSocket connects refused for exceeding the rate limit.",
+		}),
+		dockerLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "shellcraft_docker_operation_seconds",
+			Help:    "Docker API call latency, by operation.",
+			Buckets: dockerBuckets,
+		}, []string{"operation"}),
+		dockerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shellcraft_docker_errors_total",
+			Help: "Docker API calls that failed, by operation.",
+		}, []string{"operation"}),
+		websocketBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shellcraft_websocket_bytes_total",
+			Help: "WebSocket message bytes, by direction.",
+		}, []string{"direction"}),
+		connectedClients: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "shellcraft_connected_clients",
+			Help: "Connected WebSocket clients, by kind.",
+		}, []string{"kind"}),
+	}
+
+	// Labels known up front read zero rather than being absent
+	for _, reason := range []string{rejectInvalid, rejectQueueFull, rejectRateLimited, rejectClientLimit, rejectDraining, rejectFailed} {
+		m.sessionsRejected.WithLabelValues(reason)
+	}
+	for _, reason := range []string{cleanedIdle, cleanedEnded} {
+		m.sessionsCleaned.WithLabelValues(reason)
+	}
+	for _, op := range []string{"create_container", "start_container", "attach_container"} {
+		m.dockerLatency.WithLabelValues(op)
+	}
+	for _, direction := range []string{"in", "out"} {
+		m.websocketBytes.WithLabelValues(direction)
+	}
+	for _, kind := range []string{"player", "spectator"} {
+		m.connectedClients.WithLabelValues(kind)
+	}
+
+	r.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.sessionsCreated, m.sessionsRejected, m.sessionsCleaned, m.sessionDuration, m.connectsLimited,
+		m.dockerLatency, m.dockerErrors, m.websocketBytes, m.connectedClients,
+	)
+
+	gauge := func(name, help string, value func() float64) {
+		r.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, value))
+	}
+	gauge("shellcraft_active_sessions", "Sessions currently running.", func() float64 {
+		return float64(len(s.sessionManager.ListSessions()))
+	})
+	gauge("shellcraft_max_sessions", "Sessions the server has capacity for.", func() float64 {
+		return float64(s.maxSessions())
+	})
+	gauge("shellcraft_queue_length", "Clients in the waiting room.", func() float64 {
+		return float64(s.waitingRoom.length())
+	})
+	gauge("shellcraft_warm_containers", "Containers ready in the warm pool.", func() float64 {
+		return float64(s.warmContainers())
+	})
+	gauge("shellcraft_draining", "1 while the server is draining.", func() float64 {
+		if s.Draining() {
+			return 1
+		}
+		return 0
+	})
+	s.registerTotals(r)
+
+	return m
+}
+
+// counterValue reads a counter for the JSON metrics
+func counterValue(c prometheus.Counter) uint64 {
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		return 0
+	}
+	return uint64(m.GetCounter().GetValue())
+}
+
+// observeDocker records a Docker operation. A missing container or file is
+// an answer rather than a failure, so it isn't counted as an error.
+func (m *instruments) observeDocker(operation string, elapsed time.Duration, err error) {
+	m.dockerLatency.WithLabelValues(operation).Observe(elapsed.Seconds())
+	if err != nil && !errors.Is(err, docker.ErrContainerNotFound) && !errors.Is(err, docker.ErrFileNotFound) {
+		m.dockerErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// connectClient wraps an upgraded WebSocket of a player or spectator,
+// counting its bytes, and counts it as connected until disconnected is called,
+// which also stops its writer
+func (s *Server) connectClient(ws *websocket.Conn, kind string) (conn *terminalConn, disconnected func()) {
+	clients := s.instruments.connectedClients.WithLabelValues(kind)
+	clients.Inc()
+
+	conn = newTerminalConn(ws, s.instruments.websocketBytes.WithLabelValues("in"), s.instruments.websocketBytes.WithLabelValues("out"))
+	return conn, func() {
+		conn.stop()
+		clients.Dec()
+	}
+}
+
+// handlePrometheusMetrics serves the metrics in the Prometheus text format,
+// or OpenMetrics if the scraper asks for it
+func (s *Server) handlePrometheusMetrics(w http.ResponseWriter, r *http.Request) {
+	s.instruments.handler.ServeHTTP(w, r)
+}
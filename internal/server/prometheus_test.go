@@ -0,0 +1,177 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/shellcraft/server/internal/docker"
+)
+
+// scrape fetches the Prometheus metrics
+func scrape(t *testing.T, srv *Server) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics/prometheus", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	return rec.Body.String()
+}
+
+// expectSamples fails unless every sample line appears in the exposition
+func expectSamples(t *testing.T, exposition string, samples ...string) {
+	t.Helper()
+	for _, sample := range samples {
+		if !strings.Contains(exposition, "\n"+sample+"\n") {
+			t.Errorf("expected sample %q in:\n%s", sample, exposition)
+		}
+	}
+}
+
+func TestPrometheusMetrics_Parses(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	createTestSession(t, srv)
+
+	parser := expfmt.NewTextParser(model.LegacyValidation)
+	families, err := parser.TextToMetricFamilies(strings.NewReader(scrape(t, srv)))
+	if err != nil {
+		t.Fatalf("failed to parse exposition: %v", err)
+	}
+
+	for name, kind := range map[string]dto.MetricType{
+		"shellcraft_sessions_created_total":   dto.MetricType_COUNTER,
+		"shellcraft_docker_operation_seconds": dto.MetricType_HISTOGRAM,
+		"shellcraft_connected_clients":        dto.MetricType_GAUGE,
+		"shellcraft_active_sessions":          dto.MetricType_GAUGE,
+		"go_goroutines":                       dto.MetricType_GAUGE,
+		"process_start_time_seconds":          dto.MetricType_GAUGE,
+	} {
+		family, ok := families[name]
+		if !ok {
+			t.Errorf("expected %s in the exposition", name)
+			continue
+		}
+		if family.GetType() != kind {
+			t.Errorf("%s: expected type %v, got %v", name, kind, family.GetType())
+		}
+	}
+	if n := families["shellcraft_sessions_created_total"].GetMetric()[0].GetCounter().GetValue(); n != 1 {
+		t.Errorf("expected 1 session created, got %v", n)
+	}
+}
+
+func TestPrometheusMetrics_SessionLifecycle(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	sessionID, _ := createTestSession(t, srv)
+
+	req := httptest.NewRequest(http.MethodPost, "/session", strings.NewReader(`{"image":"not-in-catalog"}`))
+	req.RemoteAddr = playerAddr()
+	srv.Router().ServeHTTP(httptest.NewRecorder(), req)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	ws := dialTyped(t, srv, server.URL, sessionID)
+	readControl(t, ws, msgStatus)
+	ws.WriteJSON(clientMessage{Type: msgPing, Timestamp: 1})
+	readControl(t, ws, msgPong)
+
+	exposition := scrape(t, srv)
+	expectSamples(t, exposition,
+		"shellcraft_sessions_created_total 1",
+		`shellcraft_sessions_rejected_total{reason="invalid"} 1`,
+		`shellcraft_docker_operation_seconds_count{operation="create_container"} 1`,
+		`shellcraft_docker_operation_seconds_count{operation="start_container"} 1`,
+		`shellcraft_docker_operation_seconds_count{operation="attach_container"} 1`,
+		`shellcraft_connected_clients{kind="player"} 1`,
+		"shellcraft_active_sessions 1",
+	)
+	for _, direction := range []string{"in", "out"} {
+		if strings.Contains(exposition, `shellcraft_websocket_bytes_total{direction="`+direction+`"} 0`) {
+			t.Errorf("expected WebSocket bytes %s to be counted", direction)
+		}
+	}
+
+	ws.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for testutil.ToFloat64(srv.instruments.connectedClients.WithLabelValues("player")) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the player to be counted as disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !srv.terminateSession(t.Context(), sessionID) {
+		t.Fatal("expected the session to be terminated")
+	}
+	expectSamples(t, scrape(t, srv),
+		"shellcraft_session_duration_seconds_count 1",
+		"shellcraft_active_sessions 0",
+	)
+}
+
+func TestPrometheusMetrics_CleanupAndRejections(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	createTestSession(t, srv)
+
+	if n := srv.CleanupIdleSessions(0); n != 1 {
+		t.Fatalf("expected 1 session cleaned up, got %d", n)
+	}
+	srv.SetDraining(true)
+	postSession(srv, playerAddr(), nil)
+
+	expectSamples(t, scrape(t, srv),
+		`shellcraft_sessions_cleaned_total{reason="idle"} 1`,
+		`shellcraft_sessions_cleaned_total{reason="ended"} 0`,
+		`shellcraft_sessions_rejected_total{reason="draining"} 1`,
+		"shellcraft_draining 1",
+	)
+}
+
+func TestPrometheusMetrics_DockerErrors(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+
+	srv.instruments.observeDocker("stop_container", time.Millisecond, errors.New("daemon unavailable"))
+	srv.instruments.observeDocker("inspect_container", time.Millisecond, docker.ErrContainerNotFound)
+	srv.instruments.observeDocker("copy_from_container", time.Millisecond, docker.ErrFileNotFound)
+
+	exposition := scrape(t, srv)
+	expectSamples(t, exposition, `shellcraft_docker_errors_total{operation="stop_container"} 1`)
+	for _, op := range []string{"inspect_container", "copy_from_container"} {
+		if strings.Contains(exposition, `shellcraft_docker_errors_total{operation="`+op+`"}`) {
+			t.Errorf("expected %s not found errors not to count", op)
+		}
+	}
+}
+
+func TestPrometheusMetrics_OpenMetrics(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics/prometheus", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Errorf("expected OpenMetrics, got %q", ct)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "# TYPE shellcraft_sessions_created counter\n") || !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("unexpected OpenMetrics exposition:\n%s", body)
+	}
+
+	// The JSON metrics stay for the landing page
+	rec = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON metrics, got %q", ct)
+	}
+}
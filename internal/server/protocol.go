@@ -0,0 +1,352 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ProtocolV1 is the WebSocket subprotocol for the typed terminal protocol.
+// Clients that don't request it get raw mode: every frame is stdin (apart from
+// legacy resize messages) and output/notices are written as terminal text.
+//
+// In v1, client frames are JSON text messages (input, resize, ping). The server
+// sends terminal output as binary frames and control messages (status, pong,
+// error, shutdown, exit) as JSON text frames.
+const ProtocolV1 = "shellcraft.v1"
+
+// protocolVersion is sent in the initial status message
+const protocolVersion = 1
+
+// WebSocket close codes (private range) sent when the server ends a connection
+const (
+	// closeControllerActive rejects a connection because another client
+	// controls the session and takeover wasn't requested
+	closeControllerActive = 4001
+
+	// closeTakenOver tells a client another connection took over its session
+	closeTakenOver = 4002
+
+	// closeNotLive tells a spectator the session's terminal isn't running
+	closeNotLive = 4003
+
+	// closeSessionEnded tells a client the session's container has exited
+	// (or the session was closed) and reconnecting won't help
+	closeSessionEnded = 4004
+
+	// closeTooSlow disconnects a client that fell too far behind the
+	// session's output; it may reconnect and replay the scrollback
+	closeTooSlow = 4005
+)
+
+// Client -> server message types
+const (
+	msgInput  = "input"
+	msgResize = "resize"
+	msgPing   = "ping"
+)
+
+// Server -> client message types
+const (
+	msgStatus   = "status"
+	msgPong     = "pong"
+	msgError    = "error"
+	msgShutdown = "shutdown"
+	msgExit     = "exit"
+)
+
+// clientMessage is a message from the browser
+type clientMessage struct {
+	Type      string `json:"type"`
+	Data      string `json:"data,omitempty"` // input
+	Cols      uint   `json:"cols,omitempty"` // resize
+	Rows      uint   `json:"rows,omitempty"` // resize
+	Timestamp int64  `json:"ts,omitempty"`   // ping: client clock, echoed in pong
+}
+
+// serverMessage is a control message to the browser
+type serverMessage struct {
+	Type       string `json:"type"`
+	Version    int    `json:"version,omitempty"`
+	SessionID  string `json:"session_id,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Resumed    bool   `json:"resumed,omitempty"`
+	Message    string `json:"message,omitempty"`
+	Reason     string `json:"reason,omitempty"`    // exit: why the session ended
+	ExitCode   *int   `json:"exit_code,omitempty"` // exit: the container's exit code, if known
+	Seconds    int    `json:"seconds,omitempty"`   // shutdown: until the session is ended
+	Timestamp  int64  `json:"ts,omitempty"`
+	ServerTime int64  `json:"server_ts,omitempty"`
+}
+
+// sendQueueSize is how many frames a client may fall behind the session's
+// output before it is disconnected
+const sendQueueSize = 256
+
+// flushTimeout bounds how long closing a connection waits for its queued
+// frames to be written
+const flushTimeout = time.Second
+
+// frame is a queued WebSocket message
+type frame struct {
+	messageType int
+	data        []byte
+}
+
+// terminalConn wraps a WebSocket with the negotiated protocol and serializes
+// writes, since gorilla/websocket allows only one concurrent writer. Output
+// shared with other clients is queued and written by the connection's own
+// goroutine, so a slow client only holds up itself.
+type terminalConn struct {
+	ws       *websocket.Conn
+	protocol string
+	mu       sync.Mutex
+
+	queue    chan frame
+	stopOnce sync.Once
+	stopping chan struct{} // closed to flush the queue and stop the writer
+	stopped  chan struct{} // closed when the writer has returned
+
+	// Message bytes read and written
+	bytesIn  prometheus.Counter
+	bytesOut prometheus.Counter
+}
+
+// newTerminalConn wraps ws and starts its writer; stop or close it when done
+func newTerminalConn(ws *websocket.Conn, bytesIn, bytesOut prometheus.Counter) *terminalConn {
+	c := &terminalConn{
+		ws:       ws,
+		protocol: ws.Subprotocol(),
+		queue:    make(chan frame, sendQueueSize),
+		stopping: make(chan struct{}),
+		stopped:  make(chan struct{}),
+		bytesIn:  bytesIn,
+		bytesOut: bytesOut,
+	}
+	go c.writeQueued()
+	return c
+}
+
+// writeQueued writes queued frames until the connection is stopped, then
+// flushes what is left. A failed write closes the connection so its read
+// loop returns; frames queued after that are dropped.
+func (c *terminalConn) writeQueued() {
+	defer close(c.stopped)
+
+	for {
+		select {
+		case f := <-c.queue:
+			if err := c.writeFrame(f.messageType, f.data); err != nil {
+				c.ws.Close()
+				return
+			}
+		case <-c.stopping:
+			for {
+				select {
+				case f := <-c.queue:
+					if err := c.writeFrame(f.messageType, f.data); err != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// enqueue queues a frame without blocking. It fails if the client has fallen
+// sendQueueSize frames behind or the connection is stopping.
+func (c *terminalConn) enqueue(messageType int, data []byte) bool {
+	select {
+	case <-c.stopping:
+		return false
+	default:
+	}
+
+	select {
+	case c.queue <- frame{messageType, data}:
+		return true
+	default:
+		return false
+	}
+}
+
+// queueOutput queues terminal output
+func (c *terminalConn) queueOutput(data []byte) bool {
+	return c.enqueue(websocket.BinaryMessage, data)
+}
+
+// queueControl queues a control message, rendered as for writeControl
+func (c *terminalConn) queueControl(msg serverMessage) bool {
+	messageType, data, ok := c.controlFrame(msg)
+	if !ok {
+		return true
+	}
+	return c.enqueue(messageType, data)
+}
+
+// stop flushes queued frames, waiting up to flushTimeout, and stops the
+// writer. It is safe to call more than once.
+func (c *terminalConn) stop() {
+	c.stopOnce.Do(func() { close(c.stopping) })
+
+	select {
+	case <-c.stopped:
+	case <-time.After(flushTimeout):
+	}
+}
+
+// tooSlow disconnects a client whose queue is full without waiting on it
+func (c *terminalConn) tooSlow() {
+	go c.close(closeTooSlow, "Connection too slow")
+}
+
+// typed reports whether the client negotiated the v1 protocol
+func (c *terminalConn) typed() bool {
+	return c.protocol == ProtocolV1
+}
+
+// writeTimeout bounds how long a slow client can block a write
+const writeTimeout = 10 * time.Second
+
+// writeFrame writes a single frame under the write lock
+func (c *terminalConn) writeFrame(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := c.ws.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	c.bytesOut.Add(float64(len(data)))
+	return nil
+}
+
+// writeText sends terminal text (welcome banner etc.) in either mode
+func (c *terminalConn) writeText(text string) error {
+	messageType, data, _ := c.textFrame(text)
+	return c.writeFrame(messageType, data)
+}
+
+// writeControl sends a control message. Raw clients only see errors,
+// shutdown warnings and exit notices, rendered as terminal text; other
+// control messages are dropped.
+func (c *terminalConn) writeControl(msg serverMessage) error {
+	messageType, data, ok := c.controlFrame(msg)
+	if !ok {
+		return nil
+	}
+	return c.writeFrame(messageType, data)
+}
+
+// controlFrame renders a control message for the client's protocol; ok is
+// false if a raw client shouldn't see it
+func (c *terminalConn) controlFrame(msg serverMessage) (messageType int, data []byte, ok bool) {
+	if !c.typed() {
+		switch msg.Type {
+		case msgError:
+			return c.textFrame(msg.Message + "\r\n")
+		case msgShutdown:
+			return c.textFrame("\r\n*** " + msg.Message + " ***\r\n")
+		case msgExit:
+			return c.textFrame("\r\n" + msg.Message + "\r\n")
+		}
+		return 0, nil, false
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return 0, nil, false
+	}
+	return websocket.TextMessage, data, true
+}
+
+// textFrame renders terminal text as writeText sends it
+func (c *terminalConn) textFrame(text string) (messageType int, data []byte, ok bool) {
+	if c.typed() {
+		return websocket.BinaryMessage, []byte(text), true
+	}
+	return websocket.TextMessage, []byte(text), true
+}
+
+// writeError sends an error notice
+func (c *terminalConn) writeError(message string) error {
+	return c.writeControl(serverMessage{Type: msgError, Message: message})
+}
+
+// writePong answers a ping with the client's timestamp and the server clock
+func (c *terminalConn) writePong(clientTimestamp int64) error {
+	return c.writeControl(serverMessage{
+		Type:       msgPong,
+		Timestamp:  clientTimestamp,
+		ServerTime: time.Now().UnixMilli(),
+	})
+}
+
+// close flushes queued frames, sends a close frame with a code and reason,
+// then closes the connection
+func (c *terminalConn) close(code int, reason string) {
+	c.stop()
+	c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	c.ws.Close()
+}
+
+// writeKeepalive sends a WebSocket ping control frame
+func (c *terminalConn) writeKeepalive() error {
+	return c.ws.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second))
+}
+
+// readMessage reads the next client message, translating raw-mode frames into
+// input (or resize) messages
+func (c *terminalConn) readMessage() (clientMessage, error) {
+	messageType, data, err := c.ws.ReadMessage()
+	if err != nil {
+		return clientMessage{}, err
+	}
+	c.bytesIn.Add(float64(len(data)))
+
+	if !c.typed() {
+		if resize, ok := parseResizeMessage(data); ok {
+			return clientMessage{Type: msgResize, Cols: resize.Cols, Rows: resize.Rows}, nil
+		}
+		return clientMessage{Type: msgInput, Data: string(data)}, nil
+	}
+
+	return decodeClientMessage(messageType, data)
+}
+
+// decodeClientMessage parses and validates a v1 client frame
+func decodeClientMessage(messageType int, data []byte) (clientMessage, error) {
+	var msg clientMessage
+	if messageType != websocket.TextMessage {
+		return msg, &protocolError{"binary frames are not allowed in " + ProtocolV1}
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return msg, &protocolError{"malformed message: " + err.Error()}
+	}
+
+	switch msg.Type {
+	case msgInput, msgPing:
+	case msgResize:
+		if msg.Rows == 0 || msg.Cols == 0 || msg.Rows > maxTerminalRows || msg.Cols > maxTerminalCols {
+			return msg, &protocolError{fmt.Sprintf("invalid terminal size %dx%d", msg.Cols, msg.Rows)}
+		}
+	default:
+		return msg, &protocolError{fmt.Sprintf("unknown message type %q", msg.Type)}
+	}
+	return msg, nil
+}
+
+// protocolError is a recoverable client protocol violation; the message is
+// dropped and reported back to the client rather than closing the connection
+type protocolError struct {
+	message string
+}
+
+func (e *protocolError) Error() string {
+	return e.message
+}
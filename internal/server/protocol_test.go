@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shellcraft/server/internal/docker"
+)
+
+// dialTyped connects to a session's WebSocket requesting the v1 protocol
+func dialTyped(t *testing.T, srv *Server, serverURL, sessionID string) *websocket.Conn {
+	return dialTypedQuery(t, srv, serverURL, sessionID, "")
+}
+
+// dialTypedQuery is dialTyped with a query string (e.g. "takeover=1")
+func dialTypedQuery(t *testing.T, srv *Server, serverURL, sessionID, query string) *websocket.Conn {
+	dialer := websocket.Dialer{Subprotocols: []string{ProtocolV1}}
+	wsURL := "ws" + strings.TrimPrefix(serverURL, "http") + "/session/" + sessionID + "/ws"
+	if query != "" {
+		wsURL += "?" + query
+	}
+	ws, _, err := dialer.Dial(wsURL, accessHeader(srv, sessionID))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	return ws
+}
+
+// readControl reads frames until a control message of the given type arrives
+func readControl(t *testing.T, ws *websocket.Conn, msgType string) serverMessage {
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		frameType, data, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %q message: %v", msgType, err)
+		}
+		if frameType != websocket.TextMessage {
+			continue
+		}
+
+		var msg serverMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("control frame is not JSON: %q", data)
+		}
+		if msg.Type == msgType {
+			return msg
+		}
+	}
+}
+
+// readOutputContaining reads binary frames until one contains want
+func readOutputContaining(t *testing.T, ws *websocket.Conn, want string) {
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		frameType, data, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for output %q: %v", want, err)
+		}
+		if frameType == websocket.BinaryMessage && strings.Contains(string(data), want) {
+			return
+		}
+	}
+}
+
+func TestProtocolV1_Negotiation(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, _ := createTestSession(t, srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	ws := dialTyped(t, srv, server.URL, sessionID)
+	defer ws.Close()
+
+	if ws.Subprotocol() != ProtocolV1 {
+		t.Fatalf("expected subprotocol %q, got %q", ProtocolV1, ws.Subprotocol())
+	}
+
+	status := readControl(t, ws, msgStatus)
+	if status.Version != protocolVersion || status.SessionID != sessionID || status.Status != "running" {
+		t.Errorf("unexpected status message: %+v", status)
+	}
+}
+
+func TestProtocolV1_InputPingAndErrors(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, _ := createTestSession(t, srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	ws := dialTyped(t, srv, server.URL, sessionID)
+	defer ws.Close()
+	readControl(t, ws, msgStatus)
+
+	// Ping echoes the client timestamp
+	ws.WriteJSON(clientMessage{Type: msgPing, Timestamp: 12345})
+	pong := readControl(t, ws, msgPong)
+	if pong.Timestamp != 12345 || pong.ServerTime == 0 {
+		t.Errorf("unexpected pong: %+v", pong)
+	}
+
+	// Unknown types are reported but don't close the connection
+	ws.WriteJSON(clientMessage{Type: "teleport"})
+	if errMsg := readControl(t, ws, msgError); !strings.Contains(errMsg.Message, "teleport") {
+		t.Errorf("expected error about unknown type, got %q", errMsg.Message)
+	}
+
+	// Input reaches the container (the mock attachment echoes stdin)
+	ws.WriteJSON(clientMessage{Type: msgInput, Data: "status\r"})
+	readOutputContaining(t, ws, "status\r")
+}
+
+func TestProtocol_RawModeFallback(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, _ := createTestSession(t, srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/session/" + sessionID + "/ws"
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, accessHeader(srv, sessionID))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer ws.Close()
+
+	if ws.Subprotocol() != "" {
+		t.Errorf("expected raw mode, got subprotocol %q", ws.Subprotocol())
+	}
+
+	// A JSON-looking frame is plain stdin in raw mode
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"ping"}`))
+	readOutputContaining(t, ws, `{"type":"ping"}`)
+}
+
+func TestDecodeClientMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		frameType int
+		data      string
+		ok        bool
+	}{
+		{"input", websocket.TextMessage, `{"type":"input","data":"ls\r"}`, true},
+		{"resize", websocket.TextMessage, `{"type":"resize","cols":80,"rows":24}`, true},
+		{"ping", websocket.TextMessage, `{"type":"ping","ts":1}`, true},
+		{"bad resize", websocket.TextMessage, `{"type":"resize","cols":0,"rows":24}`, false},
+		{"unknown type", websocket.TextMessage, `{"type":"nope"}`, false},
+		{"malformed", websocket.TextMessage, `ls`, false},
+		{"binary", websocket.BinaryMessage, `{"type":"input","data":"ls"}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeClientMessage(tt.frameType, []byte(tt.data))
+			if (err == nil) != tt.ok {
+				t.Errorf("decodeClientMessage(%q) error = %v, want ok=%v", tt.data, err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,472 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Waiting room configuration
+const (
+	// defaultTicketGrace is how long a ticket survives without a client
+	// watching its queue stream (before the first connect, or across a reconnect)
+	defaultTicketGrace = 30 * time.Second
+
+	// defaultSlotInterval is the assumed time between freed slots until
+	// admissions have been observed
+	defaultSlotInterval = time.Minute
+
+	// queueKeepalive is how often the queue stream sends a comment to keep
+	// proxies from closing it, and re-checks for free capacity
+	queueKeepalive = 15 * time.Second
+)
+
+// ticketCookiePrefix names the HttpOnly cookie carrying a ticket's secret,
+// for browsers following the queue stream with EventSource
+const ticketCookiePrefix = "shellcraft_ticket_"
+
+// errQueueFull is returned when the server is at capacity and the waiting
+// room can take no more tickets
+var errQueueFull = errors.New("waiting room full")
+
+// ticket is a client's place in the waiting room. Its ID shows up in the
+// queue stream's URL; only the secret, handed to the client that queued,
+// lets a client follow the stream and collect the session.
+type ticket struct {
+	id     string
+	secret string
+	req    createSessionRequest
+
+	changed chan struct{} // signalled when the ticket's position may have moved
+	done    chan struct{} // closed once admitted (or admission failed)
+
+	// Guarded by waitingRoom.mu
+	watchers  int
+	dropTimer *time.Timer
+	response  map[string]string
+	err       error
+	delivered bool
+}
+
+// waitingRoom is a FIFO queue of clients waiting for session capacity
+type waitingRoom struct {
+	mu      sync.Mutex
+	queue   []*ticket
+	tickets map[string]*ticket // queued and admitted-but-undelivered tickets
+
+	maxLength int           // beyond it clients get a 503
+	grace     time.Duration // see defaultTicketGrace
+
+	// Estimated time between admissions, smoothed
+	slotInterval time.Duration
+	lastAdmit    time.Time
+
+	// onAbandon is called for an admitted ticket whose client never collected
+	// its session, so the session can be torn down
+	onAbandon func(response map[string]string)
+}
+
+func newWaitingRoom(maxLength int) *waitingRoom {
+	return &waitingRoom{
+		tickets:      make(map[string]*ticket),
+		maxLength:    maxLength,
+		grace:        defaultTicketGrace,
+		slotInterval: defaultSlotInterval,
+	}
+}
+
+// length returns the number of queued tickets
+func (q *waitingRoom) length() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.queue)
+}
+
+// enqueue adds a ticket at the back of the queue. Callers must hold the
+// server's admitMu so admission order matches queue order.
+func (q *waitingRoom) enqueue(req createSessionRequest) (*ticket, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.queue) >= q.maxLength {
+		return nil, errQueueFull
+	}
+
+	t := &ticket{
+		id:      uuid.New().String(),
+		secret:  rand.Text(),
+		req:     req,
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	if len(q.queue) == 0 {
+		q.lastAdmit = time.Now()
+	}
+	q.queue = append(q.queue, t)
+	q.tickets[t.id] = t
+	q.startDropTimer(t)
+
+	return t, nil
+}
+
+// countClient returns how many queued tickets a client holds
+func (q *waitingRoom) countClient(clientIP string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	for _, t := range q.queue {
+		if t.req.clientIP == clientIP {
+			n++
+		}
+	}
+	return n
+}
+
+// get returns a ticket by ID
+func (q *waitingRoom) get(id string) (*ticket, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	t, exists := q.tickets[id]
+	return t, exists
+}
+
+// position returns a ticket's 1-based place in line and estimated wait, or 0
+// once it has left the queue
+func (q *waitingRoom) position(t *ticket) (int, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, queued := range q.queue {
+		if queued == t {
+			eta := time.Duration(i+1)*q.slotInterval - time.Since(q.lastAdmit)
+			return i + 1, max(eta, 0)
+		}
+	}
+	return 0, 0
+}
+
+// pop removes the ticket at the front of the queue if its request fits, and
+// updates the estimate of how often slots free up
+func (q *waitingRoom) pop(fits func(createSessionRequest) bool) *ticket {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.queue) == 0 || !fits(q.queue[0].req) {
+		return nil
+	}
+
+	t := q.queue[0]
+	q.queue = q.queue[1:]
+
+	now := time.Now()
+	q.slotInterval = (4*q.slotInterval + now.Sub(q.lastAdmit)) / 5
+	q.lastAdmit = now
+
+	q.notifyAll()
+	return t
+}
+
+// closeAll removes every queued ticket, failing each with err
+func (q *waitingRoom) closeAll(err error) {
+	q.mu.Lock()
+	queued := q.queue
+	q.queue = nil
+	q.mu.Unlock()
+
+	for _, t := range queued {
+		q.admit(t, nil, err)
+	}
+}
+
+// admit records the outcome of a ticket's admission and wakes its watchers
+func (q *waitingRoom) admit(t *ticket, response map[string]string, err error) {
+	q.mu.Lock()
+	t.response, t.err = response, err
+	abandoned := q.tickets[t.id] != t
+	if !abandoned && t.watchers == 0 {
+		q.startDropTimer(t)
+	}
+	onAbandon := q.onAbandon
+	q.mu.Unlock()
+
+	close(t.done)
+
+	// The ticket was dropped while its session was being created
+	if abandoned && response != nil && onAbandon != nil {
+		onAbandon(response)
+	}
+}
+
+// watch registers a client streaming a ticket's progress
+func (q *waitingRoom) watch(t *ticket) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	t.watchers++
+	if t.dropTimer != nil {
+		t.dropTimer.Stop()
+		t.dropTimer = nil
+	}
+}
+
+// unwatch unregisters a client; the ticket is dropped if no client returns
+// within the grace period. delivered marks that the client received its session.
+func (q *waitingRoom) unwatch(t *ticket, delivered bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	t.watchers--
+	if delivered {
+		t.delivered = true
+		delete(q.tickets, t.id)
+		return
+	}
+	if t.watchers == 0 {
+		q.startDropTimer(t)
+	}
+}
+
+// startDropTimer drops the ticket after the grace period. Callers must hold q.mu.
+func (q *waitingRoom) startDropTimer(t *ticket) {
+	if t.dropTimer != nil {
+		t.dropTimer.Stop()
+	}
+	t.dropTimer = time.AfterFunc(q.grace, func() { q.drop(t) })
+}
+
+// drop removes an abandoned ticket. If it was already admitted, its session
+// is handed to onAbandon so the slot is freed.
+func (q *waitingRoom) drop(t *ticket) {
+	q.mu.Lock()
+	if t.watchers > 0 || t.delivered || q.tickets[t.id] != t {
+		q.mu.Unlock()
+		return
+	}
+
+	delete(q.tickets, t.id)
+	for i, queued := range q.queue {
+		if queued == t {
+			q.queue = append(q.queue[:i], q.queue[i+1:]...)
+			q.notifyAll()
+			break
+		}
+	}
+	response := t.response
+	onAbandon := q.onAbandon
+	q.mu.Unlock()
+
+	log.Printf("Dropped abandoned waiting room ticket %s", t.id)
+	if response != nil && onAbandon != nil {
+		onAbandon(response)
+	}
+}
+
+// notifyAll wakes every queued ticket's watchers. Callers must hold q.mu.
+func (q *waitingRoom) notifyAll() {
+	for _, t := range q.queue {
+		select {
+		case t.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// admitOrQueue reserves a session slot for a new request, returning the new
+// session's ID. If the server is at capacity, or others are already waiting,
+// the request is queued and its ticket returned instead. Clients at their
+// session cap get errClientLimit.
+func (s *Server) admitOrQueue(req createSessionRequest) (string, *ticket, error) {
+	s.admitMu.Lock()
+	defer s.admitMu.Unlock()
+
+	if s.draining.Load() {
+		return "", nil, errDraining
+	}
+
+	if s.maxPerClient > 0 && s.clientSessions(req.clientIP) >= s.maxPerClient {
+		return "", nil, errClientLimit
+	}
+
+	if s.waitingRoom.length() > 0 || s.freeSlots(s.profileCost(req.Image, req.Profile)) < 1 {
+		t, err := s.waitingRoom.enqueue(req)
+		return "", t, err
+	}
+
+	return s.newSession(req), nil, nil
+}
+
+// newSession creates a session for an admitted request, recording its game
+// so capacity counts its profile, and its client for the per-client cap.
+// Callers must hold admitMu.
+func (s *Server) newSession(req createSessionRequest) string {
+	sessionID := s.sessionManager.NewSession()
+	s.sessionManager.SetGame(sessionID, req.Image, req.Profile)
+	s.sessionManager.SetClientIP(sessionID, req.clientIP)
+	return sessionID
+}
+
+// admitWaiting admits queued clients in order while there is capacity. It is
+// called whenever a slot may have been freed. A client whose profile doesn't
+// fit yet holds up those behind it, so larger profiles aren't starved. While
+// draining, queued clients keep their place.
+func (s *Server) admitWaiting() {
+	for {
+		s.admitMu.Lock()
+		if s.draining.Load() {
+			s.admitMu.Unlock()
+			return
+		}
+		t := s.waitingRoom.pop(func(req createSessionRequest) bool {
+			return s.freeSlots(s.profileCost(req.Image, req.Profile)) >= 1
+		})
+		if t == nil {
+			s.admitMu.Unlock()
+			return
+		}
+		sessionID := s.newSession(t.req)
+		s.admitMu.Unlock()
+
+		log.Printf("Admitting waiting room ticket %s as session %s", t.id, sessionID)
+		go func() {
+			response, err := s.provisionSession(context.Background(), sessionID, t.req)
+			s.waitingRoom.admit(t, response, err)
+			if err != nil {
+				s.instruments.sessionsRejected.WithLabelValues(rejectFailed).Inc()
+				log.Printf("Failed to create session for ticket %s: %v", t.id, err)
+				s.admitWaiting()
+			}
+		}()
+	}
+}
+
+// abandonAdmitted tears down a session created for a client that left the
+// waiting room before collecting it
+func (s *Server) abandonAdmitted(response map[string]string) {
+	sessionID := response["session_id"]
+	sess, exists := s.sessionManager.GetSession(sessionID)
+	if !exists {
+		return
+	}
+	if _, err := s.sessionManager.DestroySession(sessionID); err != nil {
+		return
+	}
+
+	s.teardownSession(context.Background(), sess)
+	s.admitWaiting()
+}
+
+// setTicketCookie binds a ticket's secret to the browser that queued
+func setTicketCookie(w http.ResponseWriter, r *http.Request, t *ticket) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     ticketCookiePrefix + t.id,
+		Value:    t.secret,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// ticketSecret returns the secret a request presents for a ticket: an
+// Authorization bearer token, or else the ticket's cookie
+func ticketSecret(r *http.Request, ticketID string) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if secret, ok := strings.CutPrefix(header, "Bearer "); ok {
+			return strings.TrimSpace(secret)
+		}
+		return ""
+	}
+	if cookie, err := r.Cookie(ticketCookiePrefix + ticketID); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// writeEvent writes one server-sent event
+func writeEvent(w http.ResponseWriter, event string, data interface{}) {
+	payload, _ := json.Marshal(data)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// handleQueueStream streams a ticket's position and estimated wait as
+// server-sent events, ending with an "admitted" event carrying the session
+// (the same JSON POST /session returns) or an "error" event. The ticket is
+// dropped if the client stops listening. The admitted event carries the
+// session's access token, so the stream requires the ticket's secret.
+func (s *Server) handleQueueStream(w http.ResponseWriter, r *http.Request) {
+	t, exists := s.waitingRoom.get(chi.URLParam(r, "ticket"))
+	if !exists {
+		http.Error(w, "Ticket not found", http.StatusNotFound)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(ticketSecret(r, t.id)), []byte(t.secret)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="shellcraft"`)
+		http.Error(w, "Invalid or missing ticket secret", http.StatusUnauthorized)
+		log.Printf("Rejected %s %s: invalid ticket secret", r.Method, r.URL.Path)
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	s.waitingRoom.watch(t)
+	delivered := false
+	defer func() { s.waitingRoom.unwatch(t, delivered) }()
+
+	keepalive := time.NewTicker(queueKeepalive)
+	defer keepalive.Stop()
+
+	lastPosition := -1
+	for {
+		if position, eta := s.waitingRoom.position(t); position > 0 && position != lastPosition {
+			writeEvent(w, "position", map[string]int{
+				"position":    position,
+				"eta_seconds": int(eta.Seconds()),
+			})
+			lastPosition = position
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-t.done:
+			if errors.Is(t.err, errShuttingDown) {
+				writeEvent(w, "error", map[string]string{"error": "Server is shutting down"})
+			} else if t.err != nil {
+				writeEvent(w, "error", map[string]string{"error": "Failed to create session"})
+			} else {
+				writeEvent(w, "admitted", t.response)
+			}
+			delivered = true
+			return
+		case <-t.changed:
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+			s.admitWaiting()
+		}
+	}
+}
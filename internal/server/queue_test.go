@@ -0,0 +1,353 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/shellcraft/server/internal/docker"
+)
+
+// fillToCapacity creates sessions until the server is full and returns their IDs
+func fillToCapacity(srv *Server) []string {
+	var ids []string
+	for len(srv.sessionManager.ListSessions()) < srv.maxSessions() {
+		ids = append(ids, srv.sessionManager.NewSession())
+	}
+	return ids
+}
+
+// queueSession requests a session expecting to be queued
+func queueSession(t *testing.T, srv *Server) map[string]interface{} {
+	req := httptest.NewRequest(http.MethodPost, "/session", nil)
+	req.RemoteAddr = playerAddr()
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, rec.Code)
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	return response
+}
+
+// queueStream is a client reading a ticket's server-sent events
+type queueStream struct {
+	resp    *http.Response
+	scanner *bufio.Scanner
+}
+
+// openQueueStream follows a queued ticket's stream with its secret
+func openQueueStream(t *testing.T, serverURL string, queued map[string]interface{}) *queueStream {
+	req, _ := http.NewRequest(http.MethodGet, serverURL+queued["queue_url"].(string), nil)
+	req.Header.Set("Authorization", "Bearer "+queued["ticket_secret"].(string))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open queue stream: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	return &queueStream{resp: resp, scanner: bufio.NewScanner(resp.Body)}
+}
+
+// next reads events until one of the given type arrives and returns its data
+func (qs *queueStream) next(t *testing.T, event string) map[string]interface{} {
+	done := make(chan map[string]interface{}, 1)
+	go func() {
+		current := ""
+		for qs.scanner.Scan() {
+			line := qs.scanner.Text()
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				current = name
+			} else if data, ok := strings.CutPrefix(line, "data: "); ok && current == event {
+				var payload map[string]interface{}
+				json.Unmarshal([]byte(data), &payload)
+				done <- payload
+				return
+			}
+		}
+		close(done)
+	}()
+
+	select {
+	case payload, ok := <-done:
+		if !ok {
+			t.Fatalf("stream ended waiting for %q event", event)
+		}
+		return payload
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for %q event", event)
+		return nil
+	}
+}
+
+func (qs *queueStream) close() {
+	qs.resp.Body.Close()
+}
+
+func TestWaitingRoom_QueuesAtCapacity(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	fillToCapacity(srv)
+
+	first := queueSession(t, srv)
+	second := queueSession(t, srv)
+
+	if first["status"] != "queued" || first["position"] != float64(1) {
+		t.Errorf("expected first ticket at position 1, got %v", first)
+	}
+	if second["position"] != float64(2) {
+		t.Errorf("expected second ticket at position 2, got %v", second)
+	}
+	if first["ticket"] == second["ticket"] {
+		t.Error("tickets should be unique")
+	}
+	if len(srv.sessionManager.ListSessions()) != srv.maxSessions() {
+		t.Error("queued requests should not create sessions")
+	}
+}
+
+func TestWaitingRoom_AdmitsInOrderWhenSlotFrees(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessions := fillToCapacity(srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	first := openQueueStream(t, server.URL, queueSession(t, srv))
+	defer first.close()
+	second := openQueueStream(t, server.URL, queueSession(t, srv))
+	defer second.close()
+
+	if pos := first.next(t, "position"); pos["position"] != float64(1) {
+		t.Errorf("expected position 1, got %v", pos)
+	}
+	if pos := second.next(t, "position"); pos["position"] != float64(2) {
+		t.Errorf("expected position 2, got %v", pos)
+	}
+
+	// Deleting a session admits the front of the queue
+	req := authorize(srv, httptest.NewRequest(http.MethodDelete, "/session/"+sessions[0], nil), sessions[0])
+	srv.Router().ServeHTTP(httptest.NewRecorder(), req)
+
+	admitted := first.next(t, "admitted")
+	sess, exists := srv.sessionManager.GetSession(admitted["session_id"].(string))
+	if !exists || sess.ContainerID != admitted["container_id"] {
+		t.Fatalf("expected admitted session with its container, got %v", admitted)
+	}
+	if _, exists := mockDocker.GetContainer(sess.ContainerID); !exists {
+		t.Error("admitted session's container should exist")
+	}
+
+	// The next client moves up
+	if pos := second.next(t, "position"); pos["position"] != float64(1) {
+		t.Errorf("expected position 1 after admission, got %v", pos)
+	}
+
+	// Idle cleanup frees slots too
+	srv.sessionManager.SetLastActivity(sessions[1], time.Now().Add(-time.Hour))
+	srv.CleanupIdleSessions(time.Minute)
+	second.next(t, "admitted")
+
+	if n := len(srv.sessionManager.ListSessions()); n != srv.maxSessions() {
+		t.Errorf("expected %d sessions, got %d", srv.maxSessions(), n)
+	}
+}
+
+// failFirstCreate fails the first container creation once released
+type failFirstCreate struct {
+	docker.Client
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (c *failFirstCreate) CreateContainer(ctx context.Context, imageName string, config *container.Config, resources docker.ResourceProfile, security docker.SecurityProfile) (string, error) {
+	first := false
+	c.once.Do(func() { first = true })
+	if first {
+		close(c.entered)
+		<-c.release
+		return "", errors.New("daemon unavailable")
+	}
+	return c.Client.CreateContainer(ctx, imageName, config, resources, security)
+}
+
+func TestWaitingRoom_FailedCreationAdmitsWaiting(t *testing.T) {
+	failing := &failFirstCreate{
+		Client:  docker.NewMockClient(),
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	srv := NewWithDockerClient(failing)
+	sessions := fillToCapacity(srv)
+	srv.sessionManager.DestroySession(sessions[0])
+
+	// Takes the last slot, then fails while someone queues behind it
+	created := make(chan int, 1)
+	go func() { created <- postSession(srv, playerAddr(), nil).Code }()
+	<-failing.entered
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+	stream := openQueueStream(t, server.URL, queueSession(t, srv))
+	defer stream.close()
+	stream.next(t, "position")
+
+	close(failing.release)
+	if code := <-created; code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, code)
+	}
+
+	admitted := stream.next(t, "admitted")
+	if _, exists := srv.sessionManager.GetSession(admitted["session_id"].(string)); !exists {
+		t.Errorf("expected the queued client to get the freed slot, got %v", admitted)
+	}
+}
+
+func TestWaitingRoom_NewRequestsQueueBehindWaiting(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	sessions := fillToCapacity(srv)
+	queueSession(t, srv)
+
+	// A slot frees without admission running (e.g. a session dropped elsewhere)
+	srv.sessionManager.DestroySession(sessions[0])
+
+	// Someone is already waiting, so a newcomer must not jump the queue
+	if response := queueSession(t, srv); response["position"] != float64(2) {
+		t.Errorf("expected newcomer at position 2, got %v", response)
+	}
+}
+
+func TestWaitingRoom_DropsTicketWhenClientLeaves(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	srv.waitingRoom.grace = 20 * time.Millisecond
+	fillToCapacity(srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	// Never connects
+	queueSession(t, srv)
+
+	// Connects, then leaves
+	left := queueSession(t, srv)
+	stream := openQueueStream(t, server.URL, left)
+	stream.next(t, "position")
+	stream.close()
+
+	// Stays connected
+	stays := queueSession(t, srv)
+	kept := openQueueStream(t, server.URL, stays)
+	defer kept.close()
+
+	// The remaining client moves up as the others are dropped
+	for {
+		if pos := kept.next(t, "position"); pos["position"] == float64(1) {
+			break
+		}
+	}
+	if n := srv.waitingRoom.length(); n != 1 {
+		t.Errorf("expected 1 ticket left, got %d", n)
+	}
+
+	resp, _ := http.Get(server.URL + left["queue_url"].(string))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected dropped ticket to be gone, got status %d", resp.StatusCode)
+	}
+}
+
+func TestWaitingRoom_StreamRequiresTicketSecret(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	fillToCapacity(srv)
+
+	req := httptest.NewRequest(http.MethodPost, "/session", nil)
+	req.RemoteAddr = playerAddr()
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+	var queued map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &queued)
+	queueURL := queued["queue_url"].(string)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	for name, secret := range map[string]string{"missing": "", "wrong": "not-the-secret"} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+queueURL, nil)
+		if secret != "" {
+			req.Header.Set("Authorization", "Bearer "+secret)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to open queue stream: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s secret: expected status %d, got %d", name, http.StatusUnauthorized, resp.StatusCode)
+		}
+	}
+
+	// A browser follows the stream with the cookie set on the 202
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != queued["ticket_secret"] || !cookies[0].HttpOnly {
+		t.Fatalf("expected an HttpOnly cookie with the ticket secret, got %v", cookies)
+	}
+	req, _ = http.NewRequest(http.MethodGet, server.URL+queueURL, nil)
+	req.AddCookie(cookies[0])
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open queue stream: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status %d with the cookie, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestWaitingRoom_AbandonedAdmissionFreesSlot(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	srv.waitingRoom.grace = 50 * time.Millisecond
+	sessions := fillToCapacity(srv)
+
+	queueSession(t, srv)
+	req := authorize(srv, httptest.NewRequest(http.MethodDelete, "/session/"+sessions[0], nil), sessions[0])
+	srv.Router().ServeHTTP(httptest.NewRecorder(), req)
+
+	// Admitted, but nobody is listening to collect the session
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.sessionManager.ListSessions()) != srv.maxSessions()-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("abandoned session should be removed, have %d sessions", len(srv.sessionManager.ListSessions()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWaitingRoom_FullReturns503(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	fillToCapacity(srv)
+	for i := 0; i < srv.waitingRoom.maxLength; i++ {
+		queueSession(t, srv)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/session", nil)
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rateLimiterSweep is how often a rate limiter forgets clients whose bucket
+// has refilled, so idle clients don't accumulate
+const rateLimiterSweep = time.Minute
+
+// clientLimitRetry is the Retry-After sent to a client at its session cap.
+// Its sessions end when the player leaves, so this is only a hint.
+const clientLimitRetry = time.Minute
+
+// errClientLimit is returned when a client already has as many sessions
+// (running or queued) as it may
+var errClientLimit = errors.New("client session limit reached")
+
+// rateLimiter is a token bucket per client: each holds up to burst tokens,
+// refilled at rate per second, and every request takes one
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// tokenBucket is one client's tokens as of last
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing perMinute requests per client on
+// average and burst at once, or nil (no limit) if perMinute is 0
+func newRateLimiter(perMinute float64, burst int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:    perMinute / 60,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the client's bucket. If it is empty, it returns
+// false and how long until the next token.
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, exists := l.buckets[client]
+	if !exists {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep forgets buckets idle long enough to have refilled. Callers must hold l.mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimiterSweep {
+		return
+	}
+	l.lastSweep = now
+
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for client, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// clientIP returns the address of the client that made a request. Behind a
+// trusted proxy it is the nearest X-Forwarded-For hop that isn't another
+// trusted proxy; from anyone else the header could be forged, so it is ignored.
+func (s *Server) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+
+	if s.trustedProxy(addr) {
+		var hops []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(header, ",")...)
+		}
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			addr = hop.Unmap()
+			if !s.trustedProxy(addr) {
+				break
+			}
+		}
+	}
+
+	return addr.String()
+}
+
+// trustedProxy reports whether X-Forwarded-For from addr is believed
+func (s *Server) trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitRate refuses requests from clients over the limiter's rate with a
+// 429, counting them in refused. A nil limiter allows everything.
+func (s *Server) limitRate(l *rateLimiter, refused prometheus.Counter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if l != nil {
+				client := s.clientIP(r)
+				if ok, wait := l.allow(client); !ok {
+					refused.Inc()
+					writeTooManyRequests(w, "Too many requests", wait)
+					log.Printf("Rate limited %s %s from %s", r.Method, r.URL.Path, client)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeTooManyRequests sends a 429 telling the client when to retry
+func writeTooManyRequests(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	seconds := max(1, int(math.Ceil(retryAfter.Seconds())))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":               message,
+		"retry_after_seconds": seconds,
+	})
+}
+
+// clientSessions returns how many sessions a client has, running or queued.
+// Callers must hold admitMu.
+func (s *Server) clientSessions(clientIP string) int {
+	n := s.waitingRoom.countClient(clientIP)
+	for _, sess := range s.sessionManager.ListSessions() {
+		if sess.ClientIP == clientIP {
+			n++
+		}
+	}
+	return n
+}
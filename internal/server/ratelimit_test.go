@@ -0,0 +1,214 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shellcraft/server/internal/config"
+	"github.com/shellcraft/server/internal/docker"
+	"github.com/shellcraft/server/internal/session"
+)
+
+// newServerWithRateLimit returns a server with the given client limits
+func newServerWithRateLimit(rl config.RateLimitConfig) *Server {
+	cfg := config.Default()
+	cfg.RateLimit = rl
+	return NewWithConfig(cfg, docker.NewMockClient(), session.NewManager())
+}
+
+// postSession requests a session from a client address and returns the response
+func postSession(srv *Server, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/session", nil)
+	req.RemoteAddr = remoteAddr
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimiter_RefillsOverTime(t *testing.T) {
+	l := newRateLimiter(6, 2) // one token every 10 seconds
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("a"); !ok {
+			t.Fatalf("expected burst request %d to be allowed", i+1)
+		}
+	}
+	ok, wait := l.allow("a")
+	if ok || wait != 10*time.Second {
+		t.Errorf("expected refusal with 10s wait, got %v %v", ok, wait)
+	}
+	if ok, _ := l.allow("b"); !ok {
+		t.Error("expected another client to have its own bucket")
+	}
+
+	now = now.Add(10 * time.Second)
+	if ok, _ := l.allow("a"); !ok {
+		t.Error("expected a token after 10s")
+	}
+
+	// Refilled buckets are forgotten
+	now = now.Add(time.Hour)
+	l.allow("c")
+	if _, exists := l.buckets["a"]; exists {
+		t.Error("expected idle bucket to be swept")
+	}
+
+	if newRateLimiter(0, 5) != nil {
+		t.Error("expected a zero rate to disable the limiter")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	srv.trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct", "203.0.113.7:5000", "", "203.0.113.7"},
+		{"forged header ignored", "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:5000", "198.51.100.1", "198.51.100.1"},
+		{"client prepends a forged hop", "10.0.0.1:5000", "192.0.2.99, 198.51.100.1", "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.1:5000", "198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"malformed hop", "10.0.0.1:5000", "not-an-ip", "10.0.0.1"},
+		{"trusted proxy without header", "10.0.0.1:5000", "", "10.0.0.1"},
+		{"ipv4-mapped", "[::ffff:203.0.113.7]:5000", "", "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := srv.clientIP(req); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCreateSession_RateLimited(t *testing.T) {
+	srv := newServerWithRateLimit(config.RateLimitConfig{SessionsPerMinute: 1, SessionBurst: 2})
+
+	for i := 0; i < 2; i++ {
+		if rec := postSession(srv, "203.0.113.7:5000", nil); rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+	}
+
+	rec := postSession(srv, "203.0.113.7:5001", nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if retry, _ := strconv.Atoi(rec.Header().Get("Retry-After")); retry < 1 || retry > 60 {
+		t.Errorf("expected Retry-After within a minute, got %q", rec.Header().Get("Retry-After"))
+	}
+	if n := len(srv.sessionManager.ListSessions()); n != 2 {
+		t.Errorf("expected 2 sessions, got %d", n)
+	}
+
+	if rec := postSession(srv, "198.51.100.1:5000", nil); rec.Code != http.StatusOK {
+		t.Errorf("expected another client to be allowed, got %d", rec.Code)
+	}
+
+	metricsReq := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	metricsRec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(metricsRec, metricsReq)
+
+	var metrics ServerMetrics
+	json.Unmarshal(metricsRec.Body.Bytes(), &metrics)
+	if metrics.RateLimitedSessions != 1 {
+		t.Errorf("expected 1 rate limited session, got %d", metrics.RateLimitedSessions)
+	}
+}
+
+func TestCreateSession_ClientSessionCap(t *testing.T) {
+	srv := newServerWithRateLimit(config.RateLimitConfig{
+		MaxSessionsPerClient: 2,
+		TrustedProxies:       []string{"10.0.0.1"},
+	})
+	behindProxy := func(client string) http.Header {
+		return http.Header{"X-Forwarded-For": {client}}
+	}
+
+	var first map[string]string
+	for i := 0; i < 2; i++ {
+		rec := postSession(srv, "10.0.0.1:5000", behindProxy("203.0.113.7"))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		if i == 0 {
+			json.Unmarshal(rec.Body.Bytes(), &first)
+		}
+	}
+
+	rec := postSession(srv, "10.0.0.1:5000", behindProxy("203.0.113.7"))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected status %d with Retry-After, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if n := testutil.ToFloat64(srv.instruments.sessionsRejected.WithLabelValues(rejectClientLimit)); n != 1 {
+		t.Errorf("expected 1 client limit rejection, got %v", n)
+	}
+
+	// Another player behind the same proxy has their own cap
+	if rec := postSession(srv, "10.0.0.1:5000", behindProxy("198.51.100.1")); rec.Code != http.StatusOK {
+		t.Errorf("expected another client to be allowed, got %d", rec.Code)
+	}
+
+	// Ending a session frees a place
+	req := authorize(srv, httptest.NewRequest(http.MethodDelete, "/session/"+first["session_id"], nil), first["session_id"])
+	srv.Router().ServeHTTP(httptest.NewRecorder(), req)
+	if rec := postSession(srv, "10.0.0.1:5000", behindProxy("203.0.113.7")); rec.Code != http.StatusOK {
+		t.Errorf("expected a session after deleting one, got %d", rec.Code)
+	}
+}
+
+func TestCreateSession_ClientSessionCapCountsQueued(t *testing.T) {
+	srv := newServerWithRateLimit(config.RateLimitConfig{MaxSessionsPerClient: 1})
+	fillToCapacity(srv)
+
+	if rec := postSession(srv, "203.0.113.7:5000", nil); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, rec.Code)
+	}
+	if rec := postSession(srv, "203.0.113.7:5000", nil); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+}
+
+func TestWebSocket_RateLimited(t *testing.T) {
+	srv := newServerWithRateLimit(config.RateLimitConfig{ConnectsPerMinute: 1, ConnectBurst: 1})
+
+	// Terminal and spectator connects share the client's bucket
+	req := authorize(srv, httptest.NewRequest(http.MethodGet, "/session/missing/ws", nil), "missing")
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected first connect to reach the handler, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/watch/missing/ws", nil)
+	rec = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if n := testutil.ToFloat64(srv.instruments.connectsLimited); n != 1 {
+		t.Errorf("expected 1 rate limited connect, got %v", n)
+	}
+}
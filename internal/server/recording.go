@@ -0,0 +1,314 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Default terminal size written to a new recording's header; the client's
+// first resize follows immediately as an "r" event
+const (
+	recordingDefaultWidth  = 80
+	recordingDefaultHeight = 24
+)
+
+// castHeader is the first line of an asciicast v2 file
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     uint              `json:"width"`
+	Height    uint              `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	SessionID string            `json:"session_id,omitempty"` // whose access token may fetch it
+}
+
+// recorder appends a session's terminal output and resizes to an asciicast
+// v2 file. Event times are relative to the header timestamp, so reopening a
+// recording (e.g. after a server restart) continues the same timeline.
+type recorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	start   time.Time
+	pending []byte // incomplete UTF-8 sequence carried to the next output event
+}
+
+// SetRecordingsDir enables session recording. Sessions created with
+// "record": true save their terminal output to dir as asciicast v2 files.
+func (s *Server) SetRecordingsDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	s.recordingsDir = dir
+	return nil
+}
+
+// recordingPath returns the file for a recording ID, rejecting malformed IDs
+// so they cannot escape the recordings directory
+func (s *Server) recordingPath(recordingID string) (string, error) {
+	if _, err := uuid.Parse(recordingID); err != nil {
+		return "", fmt.Errorf("invalid recording ID %q", recordingID)
+	}
+	return filepath.Join(s.recordingsDir, recordingID+".cast"), nil
+}
+
+// openRecorder opens a session's recording for appending, writing the
+// header if new
+func (s *Server) openRecorder(recordingID, sessionID string) (*recorder, error) {
+	path, err := s.recordingPath(recordingID)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := readCastHeader(path)
+	if os.IsNotExist(err) {
+		header = &castHeader{
+			Version:   2,
+			Width:     recordingDefaultWidth,
+			Height:    recordingDefaultHeight,
+			Timestamp: time.Now().Unix(),
+			Title:     "ShellCraft",
+			Env:       map[string]string{"TERM": "xterm-256color", "SHELL": "/usr/local/bin/shellcraft.pl"},
+			SessionID: sessionID,
+		}
+		data, _ := json.Marshal(header)
+		if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &recorder{
+		file:  file,
+		start: time.Unix(header.Timestamp, 0),
+	}, nil
+}
+
+// readCastHeader parses the header line of a recording
+func readCastHeader(path string) (*castHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read recording header: %w", err)
+	}
+
+	var header castHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		return nil, fmt.Errorf("decode recording header: %w", err)
+	}
+	return &header, nil
+}
+
+// event appends one [time, type, data] line
+func (r *recorder) event(eventType, data string) {
+	elapsed := time.Since(r.start).Seconds()
+	line, _ := json.Marshal([]interface{}{elapsed, eventType, data})
+	r.file.Write(append(line, '\n'))
+}
+
+// output records terminal output. Reads can split a multi-byte character, so
+// an incomplete trailing sequence is held back until the next chunk.
+func (r *recorder) output(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data = append(r.pending, data...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+
+	r.pending = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		r.event("o", string(data[:cut]))
+	}
+}
+
+// resize records a terminal size change
+func (r *recorder) resize(cols, rows uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// close flushes any held-back bytes and closes the file
+func (r *recorder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) > 0 {
+		r.event("o", string(r.pending))
+		r.pending = nil
+	}
+	r.file.Close()
+}
+
+// recordingInfo describes a recording in listings
+type recordingInfo struct {
+	ID        string    `json:"id"`
+	StartedAt time.Time `json:"started_at"`
+	SizeBytes int64     `json:"size_bytes"`
+}
+
+// listRecordings returns all recordings, newest first
+func (s *Server) listRecordings() ([]recordingInfo, error) {
+	entries, err := os.ReadDir(s.recordingsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	recordings := make([]recordingInfo, 0, len(entries))
+	for _, entry := range entries {
+		recordingID, ok := strings.CutSuffix(entry.Name(), ".cast")
+		if !ok {
+			continue
+		}
+		path, err := s.recordingPath(recordingID)
+		if err != nil {
+			continue
+		}
+		header, err := readCastHeader(path)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		recordings = append(recordings, recordingInfo{
+			ID:        recordingID,
+			StartedAt: time.Unix(header.Timestamp, 0).UTC(),
+			SizeBytes: info.Size(),
+		})
+	}
+
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].StartedAt.After(recordings[j].StartedAt)
+	})
+	return recordings, nil
+}
+
+// handleListRecordings returns the saved recordings to an operator
+func (s *Server) handleListRecordings(w http.ResponseWriter, r *http.Request) {
+	noteAdminAction(r, "list_recordings", "")
+
+	if s.recordingsDir == "" {
+		http.Error(w, "Recording is not enabled on this server", http.StatusNotFound)
+		return
+	}
+
+	recordings, err := s.listRecordings()
+	if err != nil {
+		log.Printf("Failed to list recordings: %v", err)
+		http.Error(w, "Failed to list recordings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recordings": recordings,
+	})
+}
+
+// requireRecordingAccess rejects requests for /recordings/{id} routes
+// without the admin token or an access token for the session the recording
+// was made in. An unknown recording is refused the same way, so recording
+// IDs can't be probed.
+func (s *Server) requireRecordingAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.isAdmin(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sessionID := s.recordingSession(chi.URLParam(r, "id"))
+		if sessionID == "" || s.tokens.Verify(accessToken(r, sessionID), sessionID) != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="shellcraft"`)
+			http.Error(w, "Invalid or missing access token", http.StatusUnauthorized)
+			log.Printf("Rejected %s %s from %s", r.Method, r.URL.Path, s.clientIP(r))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recordingSession returns the session a recording was made in, or "" if
+// the recording doesn't exist or predates sessions being recorded in it
+func (s *Server) recordingSession(recordingID string) string {
+	if s.recordingsDir == "" {
+		return ""
+	}
+	path, err := s.recordingPath(recordingID)
+	if err != nil {
+		return ""
+	}
+	header, err := readCastHeader(path)
+	if err != nil {
+		return ""
+	}
+	return header.SessionID
+}
+
+// recordingFromRequest resolves the {id} URL parameter to an existing
+// recording file, writing a 404 if there is none
+func (s *Server) recordingFromRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if s.recordingsDir == "" {
+		http.Error(w, "Recording is not enabled on this server", http.StatusNotFound)
+		return "", false
+	}
+
+	path, err := s.recordingPath(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return "", false
+	}
+	if _, err := os.Stat(path); err != nil {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return "", false
+	}
+	return path, true
+}
+
+// handleDownloadRecording serves a recording as an asciicast v2 file
+func (s *Server) handleDownloadRecording(w http.ResponseWriter, r *http.Request) {
+	path, ok := s.recordingFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shellcraft/server/internal/docker"
+)
+
+// readCast decodes a recording into its header and events
+func readCast(t *testing.T, data []byte) (castHeader, [][]interface{}) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if !scanner.Scan() {
+		t.Fatal("recording is empty")
+	}
+
+	var header castHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		t.Fatalf("invalid header %q: %v", scanner.Bytes(), err)
+	}
+
+	var events [][]interface{}
+	for scanner.Scan() {
+		var event []interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || len(event) != 3 {
+			t.Fatalf("invalid event %q: %v", scanner.Bytes(), err)
+		}
+		events = append(events, event)
+	}
+	return header, events
+}
+
+func TestRecorder_HoldsBackSplitUTF8(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	if err := srv.SetRecordingsDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	recordingID := uuid.New().String()
+
+	rec, err := srv.openRecorder(recordingID, "session-1")
+	if err != nil {
+		t.Fatalf("openRecorder: %v", err)
+	}
+	block := []byte("█")
+	rec.output(append([]byte("a"), block[:1]...))
+	rec.output(block[1:])
+	rec.resize(120, 40)
+	rec.close()
+
+	// Reopening appends to the same timeline
+	rec, err = srv.openRecorder(recordingID, "session-1")
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	rec.output([]byte("b"))
+	rec.close()
+
+	path, _ := srv.recordingPath(recordingID)
+	data, _ := os.ReadFile(path)
+	header, events := readCast(t, data)
+
+	if header.Version != 2 || header.Width != recordingDefaultWidth || header.Height != recordingDefaultHeight || header.SessionID != "session-1" {
+		t.Errorf("unexpected header: %+v", header)
+	}
+
+	want := [][2]string{{"o", "a"}, {"o", "█"}, {"r", "120x40"}, {"o", "b"}}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %v", len(want), events)
+	}
+	for i, event := range events {
+		if event[1] != want[i][0] || event[2] != want[i][1] {
+			t.Errorf("event %d: expected %v, got %v", i, want[i], event)
+		}
+	}
+}
+
+func TestRecordingPath_RejectsInvalidIDs(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	srv.SetRecordingsDir(t.TempDir())
+
+	for _, id := range []string{"", "..", "../../etc/passwd", "not-a-uuid"} {
+		if _, err := srv.recordingPath(id); err == nil {
+			t.Errorf("expected %q to be rejected", id)
+		}
+	}
+}
+
+func TestCreateSession_RecordingDisabled(t *testing.T) {
+	srv, _ := newAdminServer(t, docker.NewMockClient())
+
+	req := httptest.NewRequest(http.MethodPost, "/session", strings.NewReader(`{"record": true}`))
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if len(srv.sessionManager.ListSessions()) != 0 {
+		t.Error("no session should be created")
+	}
+
+	if rec := adminRequest(srv, http.MethodGet, "/admin/recordings", "", testAdminToken); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestRecording_EndToEnd(t *testing.T) {
+	srv, _ := newAdminServer(t, docker.NewMockClient())
+	srv.SetRecordingsDir(t.TempDir())
+
+	req := httptest.NewRequest(http.MethodPost, "/session", strings.NewReader(`{"record": true}`))
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	var created map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	recordingID := created["recording_id"]
+	if _, err := uuid.Parse(recordingID); err != nil {
+		t.Fatalf("expected a recording ID, got %q", recordingID)
+	}
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	ws := dialTyped(t, srv, server.URL, created["session_id"])
+	defer ws.Close()
+	readControl(t, ws, msgStatus)
+
+	ws.WriteJSON(clientMessage{Type: msgResize, Cols: 100, Rows: 30})
+	ws.WriteJSON(clientMessage{Type: msgInput, Data: "look\r"})
+	readOutputContaining(t, ws, "look")
+
+	// Listed for operators
+	rec = adminRequest(srv, http.MethodGet, "/admin/recordings", "", testAdminToken)
+	var listing struct {
+		Recordings []recordingInfo `json:"recordings"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &listing)
+	if len(listing.Recordings) != 1 || listing.Recordings[0].ID != recordingID {
+		t.Fatalf("expected recording %s to be listed, got %+v", recordingID, listing.Recordings)
+	}
+
+	// Downloaded as asciicast v2 by the player
+	req = authorize(srv, httptest.NewRequest(http.MethodGet, "/recordings/"+recordingID, nil), created["session_id"])
+	rec = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-asciicast" {
+		t.Errorf("expected asciicast content type, got %q", ct)
+	}
+
+	_, events := readCast(t, rec.Body.Bytes())
+	var output strings.Builder
+	resized := false
+	for _, event := range events {
+		switch event[1] {
+		case "o":
+			output.WriteString(event[2].(string))
+		case "r":
+			resized = resized || event[2] == "100x30"
+		}
+	}
+	if !strings.Contains(output.String(), "You awaken") {
+		t.Error("recording should include the welcome screen")
+	}
+	if !strings.Contains(output.String(), "look") {
+		t.Error("recording should include container output")
+	}
+	if !resized {
+		t.Error("recording should include the resize")
+	}
+
+	// Replay page
+	req = authorize(srv, httptest.NewRequest(http.MethodGet, "/recordings/"+recordingID+"/play", nil), created["session_id"])
+	rec = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), recordingID) {
+		t.Errorf("expected replay page for %s, got status %d", recordingID, rec.Code)
+	}
+}
+
+func TestRecording_NotFound(t *testing.T) {
+	srv, _ := newAdminServer(t, docker.NewMockClient())
+	srv.SetRecordingsDir(t.TempDir())
+
+	for _, path := range []string{"/recordings/" + uuid.New().String(), "/recordings/nope/play"} {
+		rec := adminRequest(srv, http.MethodGet, path, "", testAdminToken)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusNotFound, rec.Code)
+		}
+	}
+}
+
+func TestRecording_RequiresAccess(t *testing.T) {
+	srv, _ := newAdminServer(t, docker.NewMockClient())
+	srv.SetRecordingsDir(t.TempDir())
+
+	sessionID, _ := createTestSession(t, srv)
+	recordingID := uuid.New().String()
+	rec, err := srv.openRecorder(recordingID, sessionID)
+	if err != nil {
+		t.Fatalf("openRecorder: %v", err)
+	}
+	rec.output([]byte("password123"))
+	rec.close()
+	other, _ := createTestSession(t, srv)
+	playerToken, _ := srv.tokens.Issue(sessionID)
+	otherToken, _ := srv.tokens.Issue(other)
+
+	for _, path := range []string{"/recordings/" + recordingID, "/recordings/" + recordingID + "/play", "/recordings/" + uuid.New().String()} {
+		// No token, another session's token, or a session token for an unknown recording
+		for _, token := range []string{"", otherToken} {
+			if rec := adminRequest(srv, http.MethodGet, path, "", token); rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s with token %q: expected status %d, got %d", path, token, http.StatusUnauthorized, rec.Code)
+			}
+		}
+	}
+
+	// The listing is for operators only
+	for _, token := range []string{"", playerToken} {
+		if rec := adminRequest(srv, http.MethodGet, "/admin/recordings", "", token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("listing with token %q: expected status %d, got %d", token, http.StatusUnauthorized, rec.Code)
+		}
+	}
+	if rec := adminRequest(srv, http.MethodGet, "/recordings", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected no public listing, got status %d", rec.Code)
+	}
+
+	// Operators may fetch any recording
+	if rec := adminRequest(srv, http.MethodGet, "/recordings/"+recordingID, "", testAdminToken); rec.Code != http.StatusOK {
+		t.Errorf("expected the admin to download the recording, got status %d", rec.Code)
+	}
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const replayHTML = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>ShellCraft - Replay {{.RecordingID}}</title>
+    <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/xterm@5.3.0/css/xterm.css" />
+    <style>
+        body {
+            margin: 0;
+            padding: 0;
+            background: #000;
+            color: #0f0;
+            font-family: monospace;
+        }
+        #controls {
+            padding: 8px 12px;
+            border-bottom: 1px solid #0f0;
+            font-size: 12px;
+        }
+        #controls button, #controls select {
+            background: #000;
+            color: #0f0;
+            border: 1px solid #0f0;
+            border-radius: 4px;
+            font-family: monospace;
+            margin-right: 8px;
+            cursor: pointer;
+        }
+        #terminal-container {
+            padding: 8px;
+        }
+    </style>
+</head>
+<body>
+    <div id="controls">
+        <button id="playPause">PAUSE</button>
+        <button id="restart">RESTART</button>
+        <select id="speed">
+            <option value="0.5">0.5x</option>
+            <option value="1" selected>1x</option>
+            <option value="2">2x</option>
+            <option value="4">4x</option>
+        </select>
+        <a id="download" style="color: #0f0;">Download .cast</a>
+        <span id="progress" style="float: right;">LOADING...</span>
+    </div>
+    <div id="terminal-container"></div>
+
+    <script src="https://cdn.jsdelivr.net/npm/xterm@5.3.0/lib/xterm.js"></script>
+    <script>
+        // The page lives at .../recordings/{id}/play, the file at .../recordings/{id}
+        const castUrl = '../{{.RecordingID}}';
+        // Long pauses (the player thinking) are shortened during playback
+        const maxIdle = 2;
+
+        document.getElementById('download').href = castUrl;
+
+        let term;
+        let events = [];
+        let index = 0;
+        let clock = 0;
+        let timer = null;
+        let playing = false;
+
+        function formatTime(seconds) {
+            const m = Math.floor(seconds / 60);
+            const s = Math.floor(seconds % 60);
+            return m + ':' + (s < 10 ? '0' : '') + s;
+        }
+
+        function apply(event) {
+            const [, type, data] = event;
+            if (type === 'o') {
+                term.write(data);
+            } else if (type === 'r') {
+                const [cols, rows] = data.split('x').map(Number);
+                if (cols > 0 && rows > 0) {
+                    term.resize(cols, rows);
+                }
+            }
+        }
+
+        function scheduleNext() {
+            if (!playing) {
+                return;
+            }
+            if (index >= events.length) {
+                playing = false;
+                document.getElementById('playPause').textContent = 'PLAY';
+                document.getElementById('progress').textContent = 'END · ' + formatTime(clock);
+                return;
+            }
+
+            const event = events[index];
+            const speed = Number(document.getElementById('speed').value);
+            const delay = Math.min(Math.max(event[0] - clock, 0), maxIdle) / speed;
+
+            timer = setTimeout(() => {
+                clock = event[0];
+                apply(event);
+                index++;
+                document.getElementById('progress').textContent = formatTime(clock);
+                scheduleNext();
+            }, delay * 1000);
+        }
+
+        function play() {
+            playing = true;
+            document.getElementById('playPause').textContent = 'PAUSE';
+            scheduleNext();
+        }
+
+        function pause() {
+            playing = false;
+            clearTimeout(timer);
+            document.getElementById('playPause').textContent = 'PLAY';
+        }
+
+        document.getElementById('playPause').addEventListener('click', () => {
+            if (playing) {
+                pause();
+            } else {
+                if (index >= events.length) {
+                    restart();
+                    return;
+                }
+                play();
+            }
+        });
+
+        function restart() {
+            pause();
+            term.reset();
+            index = 0;
+            clock = 0;
+            play();
+        }
+        document.getElementById('restart').addEventListener('click', restart);
+
+        fetch(castUrl)
+            .then(response => {
+                if (!response.ok) {
+                    throw new Error('HTTP ' + response.status);
+                }
+                return response.text();
+            })
+            .then(text => {
+                const lines = text.split('\n').filter(line => line.trim() !== '');
+                const header = JSON.parse(lines[0]);
+                events = lines.slice(1).map(line => JSON.parse(line));
+
+                term = new Terminal({
+                    cols: header.width,
+                    rows: header.height,
+                    disableStdin: true,
+                    fontSize: 14,
+                    fontFamily: 'Menlo, Monaco, "Courier New", monospace',
+                    theme: {
+                        background: '#000000',
+                        foreground: '#ffffff',
+                    }
+                });
+                term.open(document.getElementById('terminal-container'));
+                play();
+            })
+            .catch(err => {
+                document.getElementById('progress').textContent = 'FAILED TO LOAD: ' + err.message;
+            });
+    </script>
+</body>
+</html>
+`
+
+var replayTemplate = template.Must(template.New("replay").Parse(replayHTML))
+
+// handleReplayRecording serves a page that plays a recording back in xterm.js
+func (s *Server) handleReplayRecording(w http.ResponseWriter, r *http.Request) {
+	path, ok := s.recordingFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	data := map[string]interface{}{
+		"RecordingID": strings.TrimSuffix(filepath.Base(path), ".cast"),
+	}
+
+	if err := replayTemplate.Execute(w, data); err != nil {
+		log.Printf("Failed to render replay: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
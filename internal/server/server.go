@@ -3,21 +3,25 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/shellcraft/server/internal/auth"
+	"github.com/shellcraft/server/internal/config"
 	"github.com/shellcraft/server/internal/docker"
 	"github.com/shellcraft/server/internal/session"
-)
-
-// Configuration constants
-const (
-	// MaxConcurrentSessions limits total active sessions based on available server RAM
-	// With 3GB available and 50MB per container, safe limit is ~40 players
-	MaxConcurrentSessions = 40
+	"github.com/shellcraft/server/internal/vault"
 )
 
 // Server represents the ShellCraft orchestration server
@@ -26,33 +30,178 @@ type Server struct {
 	dockerClient   docker.Client
 	sessionManager *session.Manager
 	defaultImage   string
+	catalog        *catalog
+	instanceID     string
+	vault          vault.Vault
+	recordingsDir  string
 	cleanupManager *CleanupManager
+	pool           *warmPool
+	instruments    *instruments // Prometheus metrics
+
+	// Resource totals of the managed containers, for the metrics
+	statsMu         sync.Mutex
+	containerTotals *containerTotals // nil until first collected
+	statsCollector  *statsCollector
+
+	// Session access tokens
+	tokens   *auth.Signer
+	tokenTTL time.Duration
+
+	// Operator API; disabled without a token
+	adminToken  string
+	auditLog    *auditLog
+	idleTimeout time.Duration // for reporting and extending idle deadlines
+
+	// While draining, no new sessions are admitted
+	draining        atomic.Bool
+	drainMu         sync.Mutex
+	drainCancel     context.CancelFunc // of a drain started by StartDrain
+	shutdownWarning time.Duration
+	shutdownTimeout time.Duration
+	keepSessions    bool // on shutdown, leave containers running to be adopted
+
+	// Session capacity, derived from the Docker host's resources
+	capacityMu       sync.RWMutex
+	capacity         capacity
+	defaultCost      sessionCost // of a session with the container defaults
+	fallbackSessions int         // limit when host resources can't be read
+	reserveMemory    int64
+	reserveCPUs      float64
+	capacityMonitor  *capacityMonitor
+
+	// Per-client throttling; a nil limiter doesn't limit
+	trustedProxies []netip.Prefix
+	sessionLimiter *rateLimiter
+	connectLimiter *rateLimiter
+	maxPerClient   int // concurrent sessions, 0 for no cap
+
+	// admitMu serializes capacity checks with session creation and the
+	// waiting room so admission stays in queue order
+	admitMu     sync.Mutex
+	waitingRoom *waitingRoom
+
+	terminalsMu      sync.Mutex
+	terminals        map[string]*terminal
+	openingTerminals map[string]*openingTerminal
 }
 
 // New creates a new Server instance with routes configured
-func New() *Server {
+func New(cfg *config.Config) *Server {
 	dockerClient, err := docker.NewDockerClient()
 	if err != nil {
 		log.Fatalf("Failed to create Docker client: %v", err)
 	}
 
-	return NewWithDockerClient(dockerClient)
+	// Use the on-disk session store if configured so sessions survive restarts
+	sessionManager := session.NewManager()
+	if cfg.SessionFile != "" {
+		store, err := session.NewFileStore(cfg.SessionFile)
+		if err != nil {
+			log.Fatalf("Failed to open session store: %v", err)
+		}
+		sessionManager = session.NewManagerWithStore(store)
+		log.Printf("Using on-disk session store %s", cfg.SessionFile)
+	}
+
+	s := NewWithConfig(cfg, dockerClient, sessionManager)
+
+	// Keep souls between sessions if a vault directory is configured
+	if cfg.VaultDir != "" {
+		v, err := vault.NewDirVault(cfg.VaultDir)
+		if err != nil {
+			log.Fatalf("Failed to open soul vault: %v", err)
+		}
+		s.SetVault(v)
+		log.Printf("Using soul vault %s", cfg.VaultDir)
+	}
+
+	// Keep the token signing key across restarts if a key file is configured
+	if cfg.Auth.KeyFile != "" {
+		key, err := auth.LoadOrCreateKey(cfg.Auth.KeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load signing key: %v", err)
+		}
+		s.SetSigningKey(key)
+		log.Printf("Using signing key %s", cfg.Auth.KeyFile)
+	}
+
+	// Enable the admin API if a token file is configured
+	if cfg.Admin.TokenFile != "" {
+		token, err := os.ReadFile(cfg.Admin.TokenFile)
+		if err != nil {
+			log.Fatalf("Failed to read admin token: %v", err)
+		}
+		if err := s.SetAdminToken(strings.TrimSpace(string(token))); err != nil {
+			log.Fatalf("Failed to set admin token: %v", err)
+		}
+		log.Printf("Admin API enabled with token from %s", cfg.Admin.TokenFile)
+	}
+	if cfg.Admin.AuditLog != "" {
+		if err := s.SetAuditLog(cfg.Admin.AuditLog); err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		log.Printf("Writing admin audit log to %s", cfg.Admin.AuditLog)
+	}
+
+	// Allow sessions to opt in to recording if a directory is configured
+	if cfg.RecordingsDir != "" {
+		if err := s.SetRecordingsDir(cfg.RecordingsDir); err != nil {
+			log.Fatalf("Failed to open recordings directory: %v", err)
+		}
+		log.Printf("Saving recordings to %s", cfg.RecordingsDir)
+	}
+
+	return s
 }
 
 // NewWithDockerClient creates a new Server with a custom Docker client (for testing)
 func NewWithDockerClient(dockerClient docker.Client) *Server {
-	// Get default image from environment or use game image
-	defaultImage := os.Getenv("SHELLCRAFT_IMAGE")
-	if defaultImage == "" {
-		defaultImage = "shellcraft/game:latest"
+	return NewWithSessionManager(dockerClient, session.NewManager())
+}
+
+// NewWithSessionManager creates a new Server with a custom Docker client and
+// session manager, and the default configuration
+func NewWithSessionManager(dockerClient docker.Client, sessionManager *session.Manager) *Server {
+	return NewWithConfig(config.Default(), dockerClient, sessionManager)
+}
+
+// NewWithConfig creates a new Server from a configuration with a custom Docker
+// client and session manager
+func NewWithConfig(cfg *config.Config, dockerClient docker.Client, sessionManager *session.Manager) *Server {
+	trustedProxies, err := cfg.RateLimit.ParseTrustedProxies()
+	if err != nil {
+		log.Printf("Ignoring trusted proxies: %v", err)
 	}
 
 	s := &Server{
-		router:         chi.NewRouter(),
-		dockerClient:   dockerClient,
-		sessionManager: session.NewManager(),
-		defaultImage:   defaultImage,
+		router:           chi.NewRouter(),
+		dockerClient:     dockerClient,
+		sessionManager:   sessionManager,
+		defaultImage:     cfg.Image,
+		catalog:          newCatalog(cfg.Catalog(), cfg.Profiles),
+		instanceID:       cfg.Instance,
+		terminals:        make(map[string]*terminal),
+		openingTerminals: make(map[string]*openingTerminal),
+		waitingRoom:      newWaitingRoom(cfg.Queue.MaxLength),
+		defaultCost:      costOf(newResourceProfile(cfg.Container)),
+		fallbackSessions: cfg.Capacity.FallbackSessions,
+		reserveMemory:    cfg.Capacity.ReserveMemoryMB * 1024 * 1024,
+		reserveCPUs:      cfg.Capacity.ReserveCPUs,
+		trustedProxies:   trustedProxies,
+		sessionLimiter:   newRateLimiter(cfg.RateLimit.SessionsPerMinute, cfg.RateLimit.SessionBurst),
+		connectLimiter:   newRateLimiter(cfg.RateLimit.ConnectsPerMinute, cfg.RateLimit.ConnectBurst),
+		maxPerClient:     cfg.RateLimit.MaxSessionsPerClient,
+		tokens:           auth.NewSigner(auth.NewKey(), time.Duration(cfg.Auth.TokenTTL)),
+		tokenTTL:         time.Duration(cfg.Auth.TokenTTL),
+		idleTimeout:      time.Duration(cfg.Cleanup.IdleTimeout),
+		shutdownWarning:  time.Duration(cfg.Shutdown.Warning),
+		keepSessions:     cfg.KeepSessionsOnShutdown(),
+		shutdownTimeout:  time.Duration(cfg.Shutdown.Timeout),
 	}
+	s.instruments = newInstruments(s)
+	s.dockerClient = docker.NewInstrumentedClient(dockerClient, s.instruments.observeDocker)
+	s.RefreshCapacity()
+	s.waitingRoom.onAbandon = s.abandonAdmitted
 
 	// Add middleware
 	s.router.Use(middleware.Logger)
@@ -71,14 +220,50 @@ func (s *Server) Router() *chi.Mux {
 
 // registerRoutes sets up all HTTP routes
 func (s *Server) registerRoutes() {
+	limitSessions := s.limitRate(s.sessionLimiter, s.instruments.sessionsRejected.WithLabelValues(rejectRateLimited))
+	limitConnects := s.limitRate(s.connectLimiter, s.instruments.connectsLimited)
+
 	s.router.Get("/", s.handleIndex)
 	s.router.Get("/healthz", s.handleHealthCheck)
 	s.router.Get("/metrics", s.handleMetrics)
-	s.router.Post("/session", s.handleCreateSession)
-	s.router.Delete("/session/{id}", s.handleDeleteSession)
-	s.router.Get("/session/{id}/status", s.handleGetSessionStatus)
-	s.router.Get("/session/{id}/ws", s.handleWebSocket)
-	s.router.Get("/session/{id}/connect", s.handleSessionConnect)
+	s.router.Get("/metrics/prometheus", s.handlePrometheusMetrics)
+	s.router.Get("/games", s.handleListGames)
+	s.router.With(limitSessions).Post("/session", s.handleCreateSession)
+	s.router.Get("/queue/{ticket}", s.handleQueueStream)
+
+	// Everything about a session requires its access token
+	s.router.Group(func(r chi.Router) {
+		r.Use(s.requireSessionAccess)
+		r.Delete("/session/{id}", s.handleDeleteSession)
+		r.Get("/session/{id}/status", s.handleGetSessionStatus)
+		r.Get("/session/{id}/stats", s.handleSessionStats)
+		r.With(limitConnects).Get("/session/{id}/ws", s.handleWebSocket)
+		r.Get("/session/{id}/connect", s.handleSessionConnect)
+		r.Post("/session/{id}/cookie", s.handleSetAccessCookie)
+		r.Post("/session/{id}/view-token", s.handleCreateViewToken)
+	})
+
+	s.router.Get("/watch/{token}", s.handleWatch)
+	s.router.With(limitConnects).Get("/watch/{token}/ws", s.handleSpectatorWebSocket)
+
+	// Recordings hold everything a player typed, so only the player and
+	// operators may fetch one
+	s.router.Group(func(r chi.Router) {
+		r.Use(s.requireRecordingAccess)
+		r.Get("/recordings/{id}", s.handleDownloadRecording)
+		r.Get("/recordings/{id}/play", s.handleReplayRecording)
+	})
+
+	// Operator endpoints require the admin token, and every request is audited
+	s.router.Route("/admin", func(r chi.Router) {
+		r.Use(s.auditAdmin, s.requireAdmin)
+		r.Get("/sessions", s.handleAdminListSessions)
+		r.Delete("/sessions/{id}", s.handleAdminTerminateSession)
+		r.Post("/sessions/{id}/extend", s.handleAdminExtendSession)
+		r.Get("/drain", s.handleAdminDrainStatus)
+		r.Post("/drain", s.handleAdminSetDrain)
+		r.Get("/recordings", s.handleListRecordings)
+	})
 }
 
 // handleHealthCheck returns a simple OK response
@@ -87,91 +272,237 @@ func (s *Server) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("ok"))
 }
 
-// handleCreateSession creates a new session and container
+// createSessionRequest is the optional JSON body of POST /session: a catalog
+// image and one of its resource profiles, a returning player's token, and
+// whether to record the session
+type createSessionRequest struct {
+	Image       string `json:"image"`
+	Profile     string `json:"profile"`
+	PlayerToken string `json:"player_token"`
+	Record      bool   `json:"record"`
+
+	clientIP string // set by the server, for the per-client cap
+}
+
+// handleCreateSession creates a new session and container, or queues the
+// client in the waiting room if the server is at capacity
 func (s *Server) handleCreateSession(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 
+	var req createSessionRequest
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&req)
+	}
+	req.clientIP = s.clientIP(r)
+
+	// Only catalog images may be pulled and run
+	game, ok := s.resolveImage(req.Image)
+	if !ok {
+		s.instruments.sessionsRejected.WithLabelValues(rejectInvalid).Inc()
+		http.Error(w, "Image not in catalog", http.StatusBadRequest)
+		log.Printf("Rejected session for image %q: not in catalog", req.Image)
+		return
+	}
+	req.Image = game.image
+	if _, ok := game.profile(req.Profile); !ok {
+		s.instruments.sessionsRejected.WithLabelValues(rejectInvalid).Inc()
+		http.Error(w, "Profile not available for this game", http.StatusBadRequest)
+		log.Printf("Rejected session for image %q: no profile %q", req.Image, req.Profile)
+		return
+	}
+
+	if req.Record && s.recordingsDir == "" {
+		s.instruments.sessionsRejected.WithLabelValues(rejectInvalid).Inc()
+		http.Error(w, "Recording is not enabled on this server", http.StatusBadRequest)
+		return
+	}
+
 	// Check server capacity before creating new session
-	activeSessions := s.sessionManager.ListSessions()
-	if len(activeSessions) >= MaxConcurrentSessions {
+	sessionID, ticket, err := s.admitOrQueue(req)
+	if errors.Is(err, errDraining) {
+		s.instruments.sessionsRejected.WithLabelValues(rejectDraining).Inc()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":   "Server is draining",
+			"message": "The server is not starting new games right now; please try again later",
+		})
+		log.Printf("Rejected session creation: server is draining")
+		return
+	}
+	if errors.Is(err, errClientLimit) {
+		s.instruments.sessionsRejected.WithLabelValues(rejectClientLimit).Inc()
+		writeTooManyRequests(w, "Too many sessions from this client", clientLimitRetry)
+		log.Printf("Rejected session creation: %s already has %d sessions", req.clientIP, s.maxPerClient)
+		return
+	}
+	if errors.Is(err, errQueueFull) {
+		s.instruments.sessionsRejected.WithLabelValues(rejectQueueFull).Inc()
+		activeSessions := len(s.sessionManager.ListSessions())
+		maxSessions := s.maxSessions()
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"error":           "Server at capacity",
-			"active_sessions": len(activeSessions),
-			"max_sessions":    MaxConcurrentSessions,
+			"active_sessions": activeSessions,
+			"max_sessions":    maxSessions,
 			"message":         "Please try again later or wait for a slot to open",
 		})
-		log.Printf("Rejected session creation: %d/%d sessions active", len(activeSessions), MaxConcurrentSessions)
+		log.Printf("Rejected session creation: %d/%d sessions active, waiting room full", activeSessions, maxSessions)
 		return
 	}
-
-	// Parse request body for optional image name
-	var req struct {
-		Image string `json:"image"`
-	}
-	if r.Body != nil {
-		json.NewDecoder(r.Body).Decode(&req)
-	}
-
-	imageName := req.Image
-	if imageName == "" {
-		imageName = s.defaultImage
+	if ticket != nil {
+		position, eta := s.waitingRoom.position(ticket)
+		setTicketCookie(w, r, ticket)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":        "queued",
+			"ticket":        ticket.id,
+			"ticket_secret": ticket.secret,
+			"position":      position,
+			"eta_seconds":   int(eta.Seconds()),
+			"queue_url":     "/queue/" + ticket.id,
+		})
+		log.Printf("Queued session request at position %d", position)
+		return
 	}
 
-	// Create session
-	sessionID := s.sessionManager.NewSession()
-
-	// Create container (but don't start yet - wait for WebSocket connection)
-	containerID, err := s.dockerClient.CreateContainer(ctx, imageName, nil)
+	response, err := s.provisionSession(ctx, sessionID, req)
 	if err != nil {
+		s.instruments.sessionsRejected.WithLabelValues(rejectFailed).Inc()
 		http.Error(w, "Failed to create container", http.StatusInternalServerError)
-		log.Printf("Failed to create container: %v", err)
+		log.Printf("Failed to create session: %v", err)
+
+		// The session was destroyed, so its slot goes to the waiting room
+		s.admitWaiting()
 		return
 	}
+	setAccessCookie(w, r, sessionID, response["access_token"], time.Now().Add(s.tokenTTL))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// provisionSession creates (or takes from the warm pool) the container for a
+// newly admitted session and returns the session info for the client. The
+// session is destroyed if no container can be created.
+func (s *Server) provisionSession(ctx context.Context, sessionID string, req createSessionRequest) (map[string]string, error) {
+	game, ok := s.resolveImage(req.Image)
+	if !ok {
+		s.sessionManager.DestroySession(sessionID)
+		return nil, fmt.Errorf("image %q not in catalog", req.Image)
+	}
+	resources, ok := game.profile(req.Profile)
+	if !ok {
+		s.sessionManager.DestroySession(sessionID)
+		return nil, fmt.Errorf("profile %q not available for image %q", req.Profile, req.Image)
+	}
+
+	// A returning player's soul is restored before the game starts
+	token := ""
+	hasSoul := false
+	if s.vault != nil {
+		token = req.PlayerToken
+		if !vault.ValidToken(token) {
+			token = vault.NewToken()
+		} else if _, err := s.vault.Load(token); err == nil {
+			hasSoul = true
+		}
+	}
 
-	// Note: Container is created but NOT started
-	// It will be started when the WebSocket connects in handleWebSocket()
+	// Take a ready container from the warm pool, or create one (but don't
+	// start it yet - wait for WebSocket connection). Pool containers have the
+	// default profile.
+	containerID := ""
+	if req.Profile == "" {
+		containerID = s.takeWarmContainer(game.image, hasSoul)
+	}
+	if containerID == "" {
+		config := docker.NewGameContainerConfig(game.image, s.containerLabels(sessionID))
+		var err error
+		containerID, err = s.dockerClient.CreateContainer(ctx, game.image, config, resources, game.security)
+		if err != nil {
+			s.sessionManager.DestroySession(sessionID)
+			return nil, fmt.Errorf("create container: %w", err)
+		}
+	}
 
 	// Attach container to session
 	if err := s.sessionManager.AttachContainer(sessionID, containerID); err != nil {
-		http.Error(w, "Failed to attach container", http.StatusInternalServerError)
-		log.Printf("Failed to attach container: %v", err)
-		return
+		s.dockerClient.RemoveContainer(ctx, containerID)
+		return nil, fmt.Errorf("attach container: %w", err)
 	}
 
-	// Return session info
+	// Return session info, with the access token every other request for
+	// the session must present
+	access, expires := s.tokens.Issue(sessionID)
 	response := map[string]string{
 		"session_id":   sessionID,
 		"container_id": containerID,
+		"access_token": access,
+		"expires_at":   expires.UTC().Format(time.RFC3339),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	// Restore a returning player's soul before the container starts
+	if s.vault != nil {
+		if hasSoul {
+			if err := s.restoreSoul(ctx, token, containerID); err != nil {
+				log.Printf("Failed to restore soul for session %s: %v", sessionID, err)
+			}
+		}
+		s.sessionManager.SetPlayerToken(sessionID, token)
+		response["player_token"] = token
+	}
+
+	if req.Record {
+		recordingID := uuid.New().String()
+		s.sessionManager.SetRecordingID(sessionID, recordingID)
+		response["recording_id"] = recordingID
+	}
+
+	s.instruments.sessionsCreated.Inc()
+	return response, nil
 }
 
 // handleDeleteSession destroys a session and its container
 func (s *Server) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
 	sessionID := chi.URLParam(r, "id")
 
-	// Destroy session and get container ID
-	containerID, err := s.sessionManager.DestroySession(sessionID)
-	if err != nil {
+	if !s.terminateSession(context.Background(), sessionID) {
 		http.Error(w, "Session not found", http.StatusNotFound)
 		return
 	}
 
-	// Stop and remove container
-	if containerID != "" {
-		s.dockerClient.StopContainer(ctx, containerID)
-		s.dockerClient.RemoveContainer(ctx, containerID)
-	}
-
+	clearAccessCookie(w, sessionID)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
 }
 
+// terminateSession destroys a session, stops and removes its container
+// (saving the soul first) and hands its slot to the waiting room. It returns
+// false if the session doesn't exist.
+func (s *Server) terminateSession(ctx context.Context, sessionID string) bool {
+	sess, exists := s.sessionManager.GetSession(sessionID)
+	if !exists {
+		return false
+	}
+
+	// Destroy session and get container ID
+	containerID, err := s.sessionManager.DestroySession(sessionID)
+	if err != nil {
+		return false
+	}
+
+	// Stop container, save soul, and remove container
+	sess.ContainerID = containerID
+	s.teardownSession(ctx, sess)
+
+	// Hand the freed slot to the next client in the waiting room
+	s.admitWaiting()
+	return true
+}
+
 // handleGetSessionStatus returns the status of a session's container
 func (s *Server) handleGetSessionStatus(w http.ResponseWriter, r *http.Request) {
 	sessionID := chi.URLParam(r, "id")
@@ -183,28 +514,23 @@ func (s *Server) handleGetSessionStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Determine container status
-	status := "unknown"
+	w.Header().Set("Content-Type", "application/json")
+
 	if sess.ContainerID == "" {
-		status = "missing"
-	} else {
-		// For mock client, check if container exists and is running
-		if mockClient, ok := s.dockerClient.(*docker.MockClient); ok {
-			container, exists := mockClient.GetContainer(sess.ContainerID)
-			if !exists {
-				status = "missing"
-			} else if container.Running {
-				status = "running"
-			} else {
-				status = "stopped"
-			}
-		} else {
-			// For real Docker client, we'd inspect the container
-			// For now, assume running if container ID exists
-			status = "running"
+		json.NewEncoder(w).Encode(docker.ContainerState{Status: "missing"})
+		return
+	}
+
+	state, err := s.dockerClient.InspectContainer(r.Context(), sess.ContainerID)
+	if err != nil {
+		if errors.Is(err, docker.ErrContainerNotFound) {
+			json.NewEncoder(w).Encode(docker.ContainerState{Status: "missing"})
+			return
 		}
+		log.Printf("Failed to inspect container %s: %v", sess.ContainerID, err)
+		http.Error(w, "Failed to inspect container", http.StatusBadGateway)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": status})
+	json.NewEncoder(w).Encode(state)
 }
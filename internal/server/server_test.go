@@ -4,11 +4,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/shellcraft/server/internal/config"
 )
 
 func TestHealthCheck(t *testing.T) {
 	// Create a new server instance
-	srv := New()
+	srv := New(config.Default())
 
 	// Create a test request to the health check endpoint
 	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
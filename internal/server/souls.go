@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/shellcraft/server/internal/docker"
+	"github.com/shellcraft/server/internal/session"
+	"github.com/shellcraft/server/internal/vault"
+)
+
+const (
+	// soulPath is where the game keeps the player's save file
+	soulPath = "/home/soul.dat"
+
+	// soulOwnerID is the uid/gid of the "player" user in the game image
+	// (first user created by adduser); the game must be able to rewrite soul.dat
+	soulOwnerID = 1000
+)
+
+// SetVault enables the soul save vault. Souls are extracted from containers
+// before removal and restored into new containers for returning players.
+func (s *Server) SetVault(v vault.Vault) {
+	s.vault = v
+}
+
+// restoreSoul copies a player's saved soul into a created (not yet started) container
+func (s *Server) restoreSoul(ctx context.Context, token, containerID string) error {
+	soul, err := s.vault.Load(token)
+	if errors.Is(err, vault.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.dockerClient.CopyToContainer(ctx, containerID, soulPath, soul, soulOwnerID, soulOwnerID); err != nil {
+		return err
+	}
+
+	log.Printf("Restored soul (%d bytes) into container %s", len(soul), containerID)
+	return nil
+}
+
+// saveSoul copies the soul out of a container into the vault. A missing soul
+// means the player died (permadeath deletes soul.dat), so the vault entry is
+// dropped as well.
+func (s *Server) saveSoul(ctx context.Context, token, containerID string) error {
+	soul, err := s.dockerClient.CopyFromContainer(ctx, containerID, soulPath)
+	if errors.Is(err, docker.ErrFileNotFound) {
+		log.Printf("No soul in container %s, clearing vault entry", containerID)
+		return s.vault.Delete(token)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.vault.Save(token, soul)
+}
+
+// teardownSession stops a destroyed session's container, saves the player's
+// soul to the vault if configured, and removes the container
+func (s *Server) teardownSession(ctx context.Context, sess *session.Session) {
+	s.closeTerminal(sess.ID)
+	s.instruments.sessionDuration.Observe(time.Since(sess.CreatedAt).Seconds())
+
+	if sess.ContainerID == "" {
+		return
+	}
+
+	// A prestarted pool container whose terminal was never opened
+	if attach := s.takeWarmAttach(sess.ContainerID); attach != nil {
+		attach.Writer.Close()
+	}
+
+	if err := s.dockerClient.StopContainer(ctx, sess.ContainerID); err != nil {
+		log.Printf("Failed to stop container %s: %v", sess.ContainerID, err)
+	}
+
+	// Copy the soul out after stopping so the file is no longer being written
+	if s.vault != nil && sess.PlayerToken != "" {
+		if err := s.saveSoul(ctx, sess.PlayerToken, sess.ContainerID); err != nil {
+			log.Printf("Failed to save soul for session %s: %v", sess.ID, err)
+		}
+	}
+
+	if err := s.dockerClient.RemoveContainer(ctx, sess.ContainerID); err != nil {
+		log.Printf("Failed to remove container %s: %v", sess.ContainerID, err)
+	}
+}
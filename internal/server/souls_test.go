@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shellcraft/server/internal/config"
+	"github.com/shellcraft/server/internal/docker"
+	"github.com/shellcraft/server/internal/session"
+	"github.com/shellcraft/server/internal/vault"
+)
+
+// createSessionWithToken creates a session presenting a player token
+func createSessionWithToken(t *testing.T, srv *Server, token string) map[string]string {
+	body, _ := json.Marshal(map[string]string{"player_token": token})
+	req := httptest.NewRequest(http.MethodPost, "/session", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	srv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	return response
+}
+
+func TestSoulVault_SaveOnDeleteAndRestoreOnResume(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	v := vault.NewMemoryVault()
+	srv.SetVault(v)
+	ctx := context.Background()
+
+	first := createSessionWithToken(t, srv, "")
+	token := first["player_token"]
+	if !vault.ValidToken(token) {
+		t.Fatalf("expected a new player token, got %q", token)
+	}
+
+	// The game writes its progress
+	soul := []byte("SHC!level-up")
+	mockDocker.CopyToContainer(ctx, first["container_id"], soulPath, soul, soulOwnerID, soulOwnerID)
+
+	req := authorize(srv, httptest.NewRequest(http.MethodDelete, "/session/"+first["session_id"], nil), first["session_id"])
+	srv.Router().ServeHTTP(httptest.NewRecorder(), req)
+
+	saved, err := v.Load(token)
+	if err != nil {
+		t.Fatalf("soul should be in vault: %v", err)
+	}
+	if !bytes.Equal(saved, soul) {
+		t.Errorf("expected vault soul %q, got %q", soul, saved)
+	}
+
+	// Resume with the same token
+	second := createSessionWithToken(t, srv, token)
+	if second["player_token"] != token {
+		t.Errorf("expected token %s to be kept, got %s", token, second["player_token"])
+	}
+
+	restored, err := mockDocker.CopyFromContainer(ctx, second["container_id"], soulPath)
+	if err != nil {
+		t.Fatalf("soul should be restored into new container: %v", err)
+	}
+	if !bytes.Equal(restored, soul) {
+		t.Errorf("expected restored soul %q, got %q", soul, restored)
+	}
+
+	if c, _ := mockDocker.GetContainer(second["container_id"]); c.Running {
+		t.Error("container should not be started before the WebSocket connects")
+	}
+}
+
+func TestSoulVault_RestoreUnderReadOnlyRootfs(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	cfg := config.Default()
+	cfg.Security.ReadOnlyRootfs = true
+	cfg.Security.Tmpfs = map[string]string{"/home": "", "/tmp": "size=16m"}
+	srv := NewWithConfig(cfg, mockDocker, session.NewManager())
+	v := vault.NewMemoryVault()
+	srv.SetVault(v)
+
+	token := vault.NewToken()
+	soul := []byte("SHC!level-up")
+	v.Save(token, soul)
+	created := createSessionWithToken(t, srv, token)
+	sessionID, containerID := created["session_id"], created["container_id"]
+
+	c, _ := mockDocker.GetContainer(containerID)
+	if len(c.Security.Volumes) != 1 || c.Security.Volumes[0] != "/home" || len(c.Security.Tmpfs) != 1 || c.Security.Tmpfs["/tmp"] != "size=16m" {
+		t.Errorf("expected a volume on /home and a tmpfs on /tmp, got %+v", c.Security)
+	}
+
+	// Starting the game mustn't hide the restored soul
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+	ws := dialTyped(t, srv, server.URL, sessionID)
+	defer ws.Close()
+	readControl(t, ws, msgStatus)
+
+	restored, err := mockDocker.CopyFromContainer(context.Background(), containerID, soulPath)
+	if err != nil || !bytes.Equal(restored, soul) {
+		t.Fatalf("expected soul %q in the running container, got %q (%v)", soul, restored, err)
+	}
+
+	// And it can still be saved once the game stops
+	progress := []byte("SHC!level-two")
+	mockDocker.CopyToContainer(context.Background(), containerID, soulPath, progress, soulOwnerID, soulOwnerID)
+	srv.terminateSession(context.Background(), sessionID)
+	if saved, err := v.Load(token); err != nil || !bytes.Equal(saved, progress) {
+		t.Errorf("expected soul %q in the vault, got %q (%v)", progress, saved, err)
+	}
+}
+
+func TestSoulVault_SaveOnIdleCleanup(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	v := vault.NewMemoryVault()
+	srv.SetVault(v)
+
+	resp := createSessionWithToken(t, srv, "")
+	mockDocker.CopyToContainer(context.Background(), resp["container_id"], soulPath, []byte("SHC!"), soulOwnerID, soulOwnerID)
+	srv.sessionManager.SetLastActivity(resp["session_id"], time.Now().Add(-20*time.Minute))
+
+	srv.CleanupIdleSessions(15 * time.Minute)
+
+	if _, err := v.Load(resp["player_token"]); err != nil {
+		t.Errorf("idle cleanup should save soul: %v", err)
+	}
+}
+
+func TestSoulVault_PermadeathClearsVault(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	v := vault.NewMemoryVault()
+	srv.SetVault(v)
+
+	token := vault.NewToken()
+	v.Save(token, []byte("SHC!old-soul"))
+
+	resp := createSessionWithToken(t, srv, token)
+
+	// The player dies: the game deletes soul.dat
+	mockDocker.DeleteFile(resp["container_id"], soulPath)
+
+	req := authorize(srv, httptest.NewRequest(http.MethodDelete, "/session/"+resp["session_id"], nil), resp["session_id"])
+	srv.Router().ServeHTTP(httptest.NewRecorder(), req)
+
+	if _, err := v.Load(token); !errors.Is(err, vault.ErrNotFound) {
+		t.Errorf("expected vault entry to be cleared after death, got %v", err)
+	}
+}
+
+func TestSoulVault_DisabledByDefault(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+
+	resp := createSessionWithToken(t, srv, vault.NewToken())
+	if _, exists := resp["player_token"]; exists {
+		t.Error("player_token should not be issued without a vault")
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+)
+
+// newViewToken returns an unguessable spectator token
+func newViewToken() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// liveTerminal returns a session's terminal if a player has started it
+func (s *Server) liveTerminal(sessionID string) (*terminal, bool) {
+	s.terminalsMu.Lock()
+	defer s.terminalsMu.Unlock()
+
+	t, exists := s.terminals[sessionID]
+	return t, exists
+}
+
+// handleCreateViewToken issues a spectator token for a session. Issuing a new
+// token revokes the previous one.
+func (s *Server) handleCreateViewToken(w http.ResponseWriter, r *http.Request) {
+	sessionID := chi.URLParam(r, "id")
+
+	token := newViewToken()
+	if err := s.sessionManager.SetViewToken(sessionID, token); err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"view_token": token,
+		"watch_url":  "/watch/" + token,
+	})
+}
+
+// handleWatch serves the read-only spectator terminal
+func (s *Server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	if _, exists := s.sessionManager.GetSessionByViewToken(token); !exists {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	s.renderTerminal(w, terminalPage{
+		Title:    "ShellCraft - Spectating",
+		Label:    "Spectating",
+		WSPath:   "/watch/" + token + "/ws",
+		ReadOnly: true,
+	})
+}
+
+// handleSpectatorWebSocket streams a session's output to a spectator. All
+// input is dropped; spectators never control the session or its TTY size.
+func (s *Server) handleSpectatorWebSocket(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	sess, exists := s.sessionManager.GetSessionByViewToken(token)
+	if !exists {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade to WebSocket: %v", err)
+		return
+	}
+	defer ws.Close()
+	conn, disconnected := s.connectClient(ws, "spectator")
+	defer disconnected()
+
+	// Spectators never start a container; wait for the player to connect
+	term, live := s.liveTerminal(sess.ID)
+	if !live {
+		conn.close(closeNotLive, "Session is not live yet")
+		return
+	}
+
+	conn.writeControl(serverMessage{
+		Type:      msgStatus,
+		Version:   protocolVersion,
+		SessionID: sess.ID,
+		Status:    "spectating",
+		Resumed:   true,
+	})
+	term.subscribe(conn)
+	defer term.unsubscribe(conn)
+	log.Printf("Spectator joined session %s", sess.ID)
+
+	// Close when the session's output ends so the read loop below returns
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-term.done:
+				closeEnded(conn, term)
+				return
+			case <-ticker.C:
+				if err := conn.writeKeepalive(); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	// Drop everything the spectator sends except latency pings
+	for {
+		msg, err := conn.readMessage()
+		if err != nil {
+			var protoErr *protocolError
+			if errors.As(err, &protoErr) {
+				continue
+			}
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("Spectator read error: %v", err)
+			}
+			break
+		}
+		if msg.Type == msgPing {
+			conn.writePong(msg.Timestamp)
+		}
+	}
+
+	log.Printf("Spectator left session %s", sess.ID)
+}
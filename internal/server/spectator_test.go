@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/shellcraft/server/internal/docker"
+)
+
+// issueViewToken requests a spectator token for a session
+func issueViewToken(t *testing.T, srv *Server, sessionID string) string {
+	req := authorize(srv, httptest.NewRequest(http.MethodPost, "/session/"+sessionID+"/view-token", nil), sessionID)
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	if response["view_token"] == "" || response["watch_url"] != "/watch/"+response["view_token"] {
+		t.Fatalf("unexpected view token response: %v", response)
+	}
+	return response["view_token"]
+}
+
+// dialSpectator connects to the spectator WebSocket for a view token
+func dialSpectator(t *testing.T, serverURL, token string) *websocket.Conn {
+	dialer := websocket.Dialer{Subprotocols: []string{ProtocolV1}}
+	wsURL := "ws" + strings.TrimPrefix(serverURL, "http") + "/watch/" + token + "/ws"
+	ws, _, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect spectator: %v", err)
+	}
+	return ws
+}
+
+func TestSpectator_WatchesWithoutControl(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, containerID := createTestSession(t, srv)
+	token := issueViewToken(t, srv, sessionID)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	player := dialTyped(t, srv, server.URL, sessionID)
+	defer player.Close()
+	readControl(t, player, msgStatus)
+
+	spectator := dialSpectator(t, server.URL, token)
+	defer spectator.Close()
+	if status := readControl(t, spectator, msgStatus); status.Status != "spectating" {
+		t.Errorf("expected spectating status, got %q", status.Status)
+	}
+
+	// Spectator input and resizes are dropped
+	spectator.WriteJSON(clientMessage{Type: msgInput, Data: "rm soul.dat\r"})
+	spectator.WriteJSON(clientMessage{Type: msgResize, Cols: 20, Rows: 5})
+
+	// Player output fans out to the spectator
+	player.WriteJSON(clientMessage{Type: msgInput, Data: "ls\r"})
+	readOutputContaining(t, spectator, "ls\r")
+
+	if height, width := mockDocker.GetTerminalSize(containerID); height == 5 || width == 20 {
+		t.Error("spectator should not resize the player's terminal")
+	}
+
+	// The player's echo contains only their own input
+	player.WriteJSON(clientMessage{Type: msgPing, Timestamp: 1})
+	readControl(t, player, msgPong)
+	if term, _ := srv.liveTerminal(sessionID); strings.Contains(string(term.scrollback.Bytes()), "rm soul.dat") {
+		t.Error("spectator input should never reach the container")
+	}
+
+	// A spectator doesn't take control away from the player
+	if term, _ := srv.liveTerminal(sessionID); term.isController(nil) {
+		t.Error("player should remain in control")
+	}
+}
+
+func TestSpectator_SessionIDIsNotAViewToken(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, _ := createTestSession(t, srv)
+	issueViewToken(t, srv, sessionID)
+
+	for _, path := range []string{"/watch/" + sessionID, "/watch/" + sessionID + "/ws"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusNotFound, rec.Code)
+		}
+	}
+}
+
+func TestSpectator_NotLive(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, containerID := createTestSession(t, srv)
+	token := issueViewToken(t, srv, sessionID)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	spectator := dialSpectator(t, server.URL, token)
+	defer spectator.Close()
+	expectClose(t, spectator, closeNotLive)
+
+	if c, _ := mockDocker.GetContainer(containerID); c.Running {
+		t.Error("a spectator must not start the container")
+	}
+}
+
+func TestWatchPage(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, _ := createTestSession(t, srv)
+	token := issueViewToken(t, srv, sessionID)
+
+	req := httptest.NewRequest(http.MethodGet, "/watch/"+token, nil)
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	body := rec.Body.String()
+	if strings.Contains(body, sessionID) {
+		t.Error("watch page should not reveal the session ID")
+	}
+	if !regexp.MustCompile(`readOnly =\s*true`).MatchString(body) {
+		t.Error("watch page should be read-only")
+	}
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shellcraft/server/internal/docker"
+)
+
+// statsParallelism bounds how many containers are sampled at once; each
+// sample holds a Docker API call open for a second or two
+const statsParallelism = 8
+
+// statsTimeout bounds sampling one container
+const statsTimeout = 10 * time.Second
+
+// sessionStats is the JSON response of GET /session/{id}/stats
+type sessionStats struct {
+	SessionID   string `json:"session_id"`
+	ContainerID string `json:"container_id"`
+	docker.ContainerStats
+}
+
+// handleSessionStats returns the resource usage of a session's container
+func (s *Server) handleSessionStats(w http.ResponseWriter, r *http.Request) {
+	sessionID := chi.URLParam(r, "id")
+
+	sess, exists := s.sessionManager.GetSession(sessionID)
+	if !exists {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if sess.ContainerID == "" {
+		http.Error(w, "No container attached to session", http.StatusNotFound)
+		return
+	}
+
+	stats, err := s.dockerClient.Stats(r.Context(), sess.ContainerID)
+	if err != nil {
+		if errors.Is(err, docker.ErrContainerNotFound) {
+			http.Error(w, "Container not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to read stats of container %s: %v", sess.ContainerID, err)
+		http.Error(w, "Failed to read container stats", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessionStats{
+		SessionID:      sessionID,
+		ContainerID:    sess.ContainerID,
+		ContainerStats: *stats,
+	})
+}
+
+// containerTotals sums the resource usage of every running container this
+// server manages, warm pool included
+type containerTotals struct {
+	Containers int `json:"containers"` // how many were sampled
+	docker.ContainerStats
+	CollectedAt time.Time `json:"collected_at"`
+}
+
+// CollectStats samples every running container and replaces the totals the
+// metrics report. Containers that can't be sampled are left out.
+func (s *Server) CollectStats() {
+	ctx := context.Background()
+
+	containers, err := s.dockerClient.ListContainers(ctx, map[string]string{
+		docker.LabelManaged:  "true",
+		docker.LabelInstance: s.instanceID,
+	})
+	if err != nil {
+		log.Printf("Failed to list containers for stats: %v", err)
+		return
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var totals containerTotals
+	slots := make(chan struct{}, statsParallelism)
+	for _, c := range containers {
+		if c.State != "running" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			sampleCtx, cancel := context.WithTimeout(ctx, statsTimeout)
+			defer cancel()
+			stats, err := s.dockerClient.Stats(sampleCtx, c.ID)
+			if err != nil {
+				// Removed since it was listed
+				if !errors.Is(err, docker.ErrContainerNotFound) {
+					log.Printf("Failed to read stats of container %s: %v", c.ID, err)
+				}
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			totals.Containers++
+			totals.MemoryUsageBytes += stats.MemoryUsageBytes
+			totals.MemoryLimitBytes += stats.MemoryLimitBytes
+			totals.CPUPercent += stats.CPUPercent
+			totals.PIDs += stats.PIDs
+			totals.NetworkRxBytes += stats.NetworkRxBytes
+			totals.NetworkTxBytes += stats.NetworkTxBytes
+			totals.BlockReadBytes += stats.BlockReadBytes
+			totals.BlockWriteBytes += stats.BlockWriteBytes
+		}()
+	}
+	wg.Wait()
+	totals.CollectedAt = time.Now().UTC()
+
+	s.statsMu.Lock()
+	s.containerTotals = &totals
+	s.statsMu.Unlock()
+}
+
+// currentTotals returns the last collected totals, or nil before the first
+// collection
+func (s *Server) currentTotals() *containerTotals {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	return s.containerTotals
+}
+
+// registerTotals adds the container totals to the Prometheus metrics; they
+// read zero until stats are first collected
+func (s *Server) registerTotals(r prometheus.Registerer) {
+	gauges := []struct {
+		name, help string
+		value      func(t *containerTotals) float64
+	}{
+		{"shellcraft_containers_sampled", "Running containers in the resource totals.",
+			func(t *containerTotals) float64 { return float64(t.Containers) }},
+		{"shellcraft_containers_memory_usage_bytes", "Memory used by all running containers.",
+			func(t *containerTotals) float64 { return float64(t.MemoryUsageBytes) }},
+		{"shellcraft_containers_memory_limit_bytes", "Memory limits of all running containers, summed.",
+			func(t *containerTotals) float64 { return float64(t.MemoryLimitBytes) }},
+		{"shellcraft_containers_cpu_percent", "CPU used by all running containers; 100 is one CPU.",
+			func(t *containerTotals) float64 { return t.CPUPercent }},
+		{"shellcraft_containers_pids", "Processes in all running containers.",
+			func(t *containerTotals) float64 { return float64(t.PIDs) }},
+		{"shellcraft_containers_network_receive_bytes", "Network bytes received by running containers since they started.",
+			func(t *containerTotals) float64 { return float64(t.NetworkRxBytes) }},
+		{"shellcraft_containers_network_transmit_bytes", "Network bytes sent by running containers since they started.",
+			func(t *containerTotals) float64 { return float64(t.NetworkTxBytes) }},
+		{"shellcraft_containers_block_read_bytes", "Bytes read from block devices by running containers since they started.",
+			func(t *containerTotals) float64 { return float64(t.BlockReadBytes) }},
+		{"shellcraft_containers_block_write_bytes", "Bytes written to block devices by running containers since they started.",
+			func(t *containerTotals) float64 { return float64(t.BlockWriteBytes) }},
+	}
+
+	for _, g := range gauges {
+		r.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: g.name, Help: g.help}, func() float64 {
+			t := s.currentTotals()
+			if t == nil {
+				return 0
+			}
+			return g.value(t)
+		}))
+	}
+}
+
+// statsCollector periodically collects container stats
+type statsCollector struct {
+	ticker *time.Ticker
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// StartStatsCollection collects container stats now and every interval after
+func (s *Server) StartStatsCollection(interval time.Duration) {
+	if s.statsCollector != nil {
+		log.Println("Stats collection already running")
+		return
+	}
+
+	c := &statsCollector{
+		ticker: time.NewTicker(interval),
+		done:   make(chan struct{}),
+	}
+	s.statsCollector = c
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		s.CollectStats()
+		for {
+			select {
+			case <-c.done:
+				c.ticker.Stop()
+				return
+			case <-c.ticker.C:
+				s.CollectStats()
+			}
+		}
+	}()
+
+	log.Printf("Started stats collection (interval: %v)", interval)
+}
+
+// StopStatsCollection stops the stats collection goroutine
+func (s *Server) StopStatsCollection() {
+	if s.statsCollector == nil {
+		return
+	}
+
+	close(s.statsCollector.done)
+	s.statsCollector.wg.Wait()
+	s.statsCollector = nil
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shellcraft/server/internal/docker"
+)
+
+// getStats requests a session's stats with its access token
+func getStats(srv *Server, sessionID string) *httptest.ResponseRecorder {
+	req := authorize(srv, httptest.NewRequest(http.MethodGet, "/session/"+sessionID+"/stats", nil), sessionID)
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSessionStats(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, containerID := createTestSession(t, srv)
+	mockDocker.StartContainer(context.Background(), containerID)
+
+	rec := getStats(srv, sessionID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var stats map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &stats)
+	want := map[string]any{
+		"session_id":         sessionID,
+		"container_id":       containerID,
+		"memory_usage_bytes": float64(12 << 20),
+		"memory_limit_bytes": float64(50 << 20),
+		"cpu_percent":        2.5,
+		"pids":               float64(3),
+		"network_rx_bytes":   float64(1024),
+		"network_tx_bytes":   float64(2048),
+		"block_read_bytes":   float64(4096),
+		"block_write_bytes":  float64(8192),
+	}
+	for key, value := range want {
+		if stats[key] != value {
+			t.Errorf("%s: expected %v, got %v", key, value, stats[key])
+		}
+	}
+}
+
+func TestSessionStats_RequiresAccess(t *testing.T) {
+	srv := NewWithDockerClient(docker.NewMockClient())
+	sessionID, _ := createTestSession(t, srv)
+
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/session/"+sessionID+"/stats", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestSessionStats_ContainerMissing(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, containerID := createTestSession(t, srv)
+	mockDocker.RemoveContainer(context.Background(), containerID)
+
+	if rec := getStats(srv, sessionID); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestCollectStats_SumsRunningContainers(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	ctx := context.Background()
+
+	if srv.currentTotals() != nil {
+		t.Fatal("expected no totals before collecting")
+	}
+
+	for _, stats := range []docker.ContainerStats{
+		{MemoryUsageBytes: 10, MemoryLimitBytes: 100, CPUPercent: 1.5, PIDs: 2, NetworkRxBytes: 1, BlockWriteBytes: 5},
+		{MemoryUsageBytes: 20, MemoryLimitBytes: 100, CPUPercent: 2, PIDs: 3, NetworkTxBytes: 7, BlockReadBytes: 9},
+	} {
+		_, containerID := createTestSession(t, srv)
+		mockDocker.StartContainer(ctx, containerID)
+		mockDocker.SetStats(containerID, stats)
+	}
+	createTestSession(t, srv) // never started, so not sampled
+
+	srv.CollectStats()
+
+	expectSamples(t, scrape(t, srv),
+		"shellcraft_containers_sampled 2",
+		"shellcraft_containers_memory_usage_bytes 30",
+		"shellcraft_containers_memory_limit_bytes 200",
+		"shellcraft_containers_cpu_percent 3.5",
+		"shellcraft_containers_pids 5",
+		"shellcraft_containers_network_receive_bytes 1",
+		"shellcraft_containers_network_transmit_bytes 7",
+		"shellcraft_containers_block_read_bytes 9",
+		"shellcraft_containers_block_write_bytes 5",
+		`shellcraft_docker_operation_seconds_count{operation="container_stats"} 2`,
+	)
+
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var metrics ServerMetrics
+	json.Unmarshal(rec.Body.Bytes(), &metrics)
+	if totals := metrics.ContainerTotals; totals == nil || totals.Containers != 2 || totals.MemoryUsageBytes != 30 || totals.CollectedAt.IsZero() {
+		t.Errorf("expected container totals in the JSON metrics, got %+v", totals)
+	}
+}
+
+func TestStartStatsCollection_CollectsImmediately(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	_, containerID := createTestSession(t, srv)
+	mockDocker.StartContainer(context.Background(), containerID)
+
+	srv.StartStatsCollection(time.Hour)
+	defer srv.StopStatsCollection()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.currentTotals() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected stats to be collected on start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := srv.currentTotals().Containers; n != 1 {
+		t.Errorf("expected 1 container sampled, got %d", n)
+	}
+}
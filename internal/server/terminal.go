@@ -0,0 +1,420 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/shellcraft/server/internal/docker"
+	"github.com/shellcraft/server/internal/session"
+)
+
+// scrollbackSize is how much recent container output is kept per session
+// for replay to reconnecting clients
+const scrollbackSize = 64 * 1024
+
+// ringBuffer keeps the most recent bytes written to it
+type ringBuffer struct {
+	buf     []byte
+	size    int
+	wrapped bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{
+		buf:  make([]byte, 0, size),
+		size: size,
+	}
+}
+
+// Write appends p, discarding the oldest bytes beyond capacity
+func (r *ringBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if n >= r.size {
+		r.buf = append(r.buf[:0], p[n-r.size:]...)
+		r.wrapped = true
+		return n, nil
+	}
+
+	if overflow := len(r.buf) + n - r.size; overflow > 0 {
+		r.buf = append(r.buf[:0], r.buf[overflow:]...)
+		r.wrapped = true
+	}
+	r.buf = append(r.buf, p...)
+	return n, nil
+}
+
+// Bytes returns a copy of the buffered output. Once older output has been
+// discarded, the copy starts after the first newline so replay doesn't begin
+// in the middle of a line or escape sequence.
+func (r *ringBuffer) Bytes() []byte {
+	data := r.buf
+	if r.wrapped {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	return append([]byte(nil), data...)
+}
+
+// terminal is a session's live container attachment. It outlives individual
+// WebSocket connections so clients can disconnect and reconnect without
+// restarting or re-attaching the container.
+type terminal struct {
+	sessionID   string
+	containerID string
+	attach      *docker.AttachResult
+	done        chan struct{} // closed when container output ends
+
+	mu         sync.Mutex
+	scrollback *ringBuffer
+	clients    map[*terminalConn]bool
+	controller *terminalConn // the one client allowed to send input
+	recorder   *recorder     // nil unless the session is being recorded
+	closing    bool          // the server is closing the terminal
+	exit       serverMessage // final message, set before done is closed
+	ended      bool          // the session is over; clients shouldn't reconnect
+
+	inputMu sync.Mutex
+}
+
+// claim makes conn the session's controller. If another client is in control,
+// it fails unless takeover is set, in which case the previous controller is
+// returned so the caller can disconnect it.
+func (t *terminal) claim(conn *terminalConn, takeover bool) (displaced *terminalConn, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.controller != nil && !takeover {
+		return nil, false
+	}
+
+	displaced = t.controller
+	t.controller = conn
+	return displaced, true
+}
+
+// release gives up control if conn is still the controller
+func (t *terminal) release(conn *terminalConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.controller == conn {
+		t.controller = nil
+	}
+}
+
+// isController reports whether conn currently controls the session
+func (t *terminal) isController(conn *terminalConn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.controller == conn
+}
+
+// subscribe queues the scrollback for a client to replay, then adds it so
+// live output follows. Both happen under the lock so no output is missed,
+// duplicated or sent ahead of the replay.
+func (t *terminal) subscribe(conn *terminalConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if scrollback := t.scrollback.Bytes(); len(scrollback) > 0 {
+		conn.queueOutput(scrollback)
+	}
+	t.clients[conn] = true
+}
+
+// unsubscribe removes a client; the terminal keeps running without it
+func (t *terminal) unsubscribe(conn *terminalConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.clients, conn)
+}
+
+// broadcast records output in the scrollback and queues it for every client
+func (t *terminal) broadcast(data []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.scrollback.Write(data)
+	if t.recorder != nil {
+		t.recorder.output(data)
+	}
+	for conn := range t.clients {
+		if !conn.queueOutput(data) {
+			t.dropSlow(conn)
+		}
+	}
+}
+
+// notify queues a control message for every client
+func (t *terminal) notify(msg serverMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for conn := range t.clients {
+		if !conn.queueControl(msg) {
+			t.dropSlow(conn)
+		}
+	}
+}
+
+// dropSlow disconnects a client that can't keep up with the output. It
+// stops receiving output at once, and gives up control so the player can
+// reconnect. Called with t.mu held.
+func (t *terminal) dropSlow(conn *terminalConn) {
+	log.Printf("Disconnecting slow client from session %s", t.sessionID)
+	delete(t.clients, conn)
+	if t.controller == conn {
+		t.controller = nil
+	}
+	conn.tooSlow()
+}
+
+// disconnect closes every client's connection once its queued output is
+// written. The terminal keeps running.
+func (t *terminal) disconnect(code int, reason string) {
+	t.mu.Lock()
+	clients := make([]*terminalConn, 0, len(t.clients))
+	for conn := range t.clients {
+		clients = append(clients, conn)
+	}
+	t.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, conn := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn.close(code, reason)
+		}()
+	}
+	wg.Wait()
+}
+
+// write sends input to the container's stdin
+func (t *terminal) write(data []byte) error {
+	t.inputMu.Lock()
+	defer t.inputMu.Unlock()
+
+	_, err := t.attach.Writer.Write(data)
+	return err
+}
+
+// resize sets the container TTY size
+func (t *terminal) resize(rows, cols uint) error {
+	if err := t.attach.Resize(rows, cols); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.recorder != nil {
+		t.recorder.resize(cols, rows)
+	}
+	return nil
+}
+
+// isClosing reports whether the server closed the terminal
+func (t *terminal) isClosing() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.closing
+}
+
+// exitMessage returns the final message once the terminal is done, and
+// whether the session is over
+func (t *terminal) exitMessage() (serverMessage, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.exit, t.ended
+}
+
+// closeRecorder finishes the session's recording, if any
+func (t *terminal) closeRecorder() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.recorder != nil {
+		t.recorder.close()
+		t.recorder = nil
+	}
+}
+
+// openingTerminal is a terminal being attached; other connections to the
+// same session wait for it rather than attaching twice
+type openingTerminal struct {
+	ready chan struct{} // closed once t or err is set
+	t     *terminal
+	err   error
+}
+
+// openTerminal returns the session's running terminal, or starts the container
+// (if it isn't already running) and attaches a new one. resumed reports
+// whether an existing terminal or running container was picked up. The
+// Docker calls are made outside terminalsMu so one slow container doesn't
+// hold up every other session.
+func (s *Server) openTerminal(sess *session.Session) (t *terminal, resumed bool, err error) {
+	s.terminalsMu.Lock()
+	if t, exists := s.terminals[sess.ID]; exists {
+		s.terminalsMu.Unlock()
+		return t, true, nil
+	}
+	if opening, exists := s.openingTerminals[sess.ID]; exists {
+		s.terminalsMu.Unlock()
+		<-opening.ready
+		if opening.err != nil {
+			return nil, false, opening.err
+		}
+		return opening.t, true, nil
+	}
+	opening := &openingTerminal{ready: make(chan struct{})}
+	s.openingTerminals[sess.ID] = opening
+	s.terminalsMu.Unlock()
+
+	t, resumed, err = s.attachTerminal(sess)
+
+	s.terminalsMu.Lock()
+	delete(s.openingTerminals, sess.ID)
+	if err == nil {
+		s.terminals[sess.ID] = t
+	}
+	s.terminalsMu.Unlock()
+
+	opening.t, opening.err = t, err
+	close(opening.ready)
+	if err != nil {
+		return nil, false, err
+	}
+
+	go s.pumpTerminal(t)
+	return t, resumed, nil
+}
+
+// attachTerminal attaches a new terminal to the session's container,
+// starting it if it was created but not started. A container that has
+// exited ends the session with errGameEnded.
+func (s *Server) attachTerminal(sess *session.Session) (t *terminal, resumed bool, err error) {
+	ctx := context.Background()
+	t = &terminal{
+		sessionID:   sess.ID,
+		containerID: sess.ContainerID,
+		done:        make(chan struct{}),
+		scrollback:  newRingBuffer(scrollbackSize),
+		clients:     make(map[*terminalConn]bool),
+	}
+
+	// A prestarted warm pool container is already running and attached, but
+	// nobody has seen it yet; otherwise the container may already be running,
+	// e.g. after a server restart
+	t.attach = s.takeWarmAttach(sess.ContainerID)
+	started := t.attach != nil
+	if !started {
+		state, err := s.dockerClient.InspectContainer(ctx, sess.ContainerID)
+		if err != nil {
+			return nil, false, fmt.Errorf("inspect container: %w", err)
+		}
+
+		// The game ended while nobody was attached; starting it again would
+		// bring back a game the player quit or that crashed
+		if exited(state) {
+			s.endExited(ctx, sess.ID, sess.ContainerID, state)
+			return nil, false, errGameEnded
+		}
+		resumed = state.Running
+		started = state.Running
+
+		// Attach before starting so the game's first output isn't missed
+		t.attach, err = s.dockerClient.AttachContainer(ctx, sess.ContainerID)
+		if err != nil {
+			return nil, false, fmt.Errorf("attach container: %w", err)
+		}
+	}
+
+	if sess.RecordingID != "" && s.recordingsDir != "" {
+		rec, err := s.openRecorder(sess.RecordingID, sess.ID)
+		if err != nil {
+			log.Printf("Failed to open recording for session %s: %v", sess.ID, err)
+		}
+		t.recorder = rec
+	}
+
+	if !resumed {
+		// Show the welcome screen before the container's own output
+		t.scrollback.Write([]byte(welcomeScreen))
+		if t.recorder != nil {
+			t.recorder.output([]byte(welcomeScreen))
+		}
+	}
+
+	// Start the container now if it was created but not started
+	if !started {
+		if err := s.dockerClient.StartContainer(ctx, sess.ContainerID); err != nil {
+			t.attach.Writer.Close()
+			t.closeRecorder()
+			return nil, false, fmt.Errorf("start container: %w", err)
+		}
+	}
+
+	return t, resumed, nil
+}
+
+// pumpTerminal copies container output to the scrollback and clients until
+// the container's output stream ends
+func (s *Server) pumpTerminal(t *terminal) {
+	defer func() {
+		s.terminalsMu.Lock()
+		if s.terminals[t.sessionID] == t {
+			delete(s.terminals, t.sessionID)
+		}
+		s.terminalsMu.Unlock()
+
+		t.closeRecorder()
+		close(t.done)
+	}()
+
+	buf := make([]byte, 8192)
+	for {
+		n, err := t.attach.Reader.Read(buf)
+		if n > 0 {
+			// Update activity on output
+			s.sessionManager.UpdateActivity(t.sessionID)
+			t.broadcast(buf[:n])
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Container read error: %v", err)
+			}
+
+			// Tell clients why before they are disconnected
+			msg, ended := s.terminalExit(t)
+			t.mu.Lock()
+			t.exit, t.ended = msg, ended
+			t.mu.Unlock()
+			t.notify(msg)
+			return
+		}
+	}
+}
+
+// closeTerminal detaches from a session's container, if attached
+func (s *Server) closeTerminal(sessionID string) {
+	s.terminalsMu.Lock()
+	t, exists := s.terminals[sessionID]
+	s.terminalsMu.Unlock()
+
+	if exists {
+		t.mu.Lock()
+		t.closing = true
+		t.mu.Unlock()
+		t.attach.Writer.Close()
+	}
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shellcraft/server/internal/docker"
+	"github.com/shellcraft/server/internal/session"
+)
+
+func TestRingBuffer(t *testing.T) {
+	r := newRingBuffer(16)
+
+	r.Write([]byte("hello "))
+	if got := string(r.Bytes()); got != "hello " {
+		t.Errorf("expected 'hello ', got %q", got)
+	}
+
+	// Overflow discards the oldest bytes and trims to the next full line
+	r.Write([]byte("world\r\nline two\r\n"))
+	if got := string(r.Bytes()); got != "line two\r\n" {
+		t.Errorf("expected 'line two\\r\\n', got %q", got)
+	}
+
+	// A single write larger than the buffer keeps only its tail
+	r.Write([]byte(strings.Repeat("x", 20) + "\nend"))
+	if got := string(r.Bytes()); got != "end" {
+		t.Errorf("expected 'end', got %q", got)
+	}
+}
+
+func TestWebSocketReconnect_ReplaysScrollback(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, containerID := createTestSession(t, srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	// First connection starts the container and shows the welcome screen
+	ws := dialTyped(t, srv, server.URL, sessionID)
+	if status := readControl(t, ws, msgStatus); status.Resumed {
+		t.Error("first connection should not be a resume")
+	}
+	readOutputContaining(t, ws, "You awaken")
+	ws.WriteJSON(clientMessage{Type: msgInput, Data: "quest\r"})
+	readOutputContaining(t, ws, "quest\r")
+
+	c, _ := mockDocker.GetContainer(containerID)
+	startedAt := c.StartedAt
+	ws.Close()
+
+	// Reconnect: same container, no restart, scrollback replayed once. Like
+	// the browser, take over in case the server still sees the old connection.
+	ws2 := dialTypedQuery(t, srv, server.URL, sessionID, "takeover=1")
+	defer ws2.Close()
+
+	if status := readControl(t, ws2, msgStatus); !status.Resumed {
+		t.Error("reconnect should be a resume")
+	}
+
+	ws2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, replay, err := ws2.ReadMessage()
+	if err != nil {
+		t.Fatalf("expected scrollback replay: %v", err)
+	}
+	if strings.Count(string(replay), "You awaken") != 1 || !strings.Contains(string(replay), "quest\r") {
+		t.Errorf("unexpected replay: %q", replay)
+	}
+
+	if c, _ := mockDocker.GetContainer(containerID); !c.StartedAt.Equal(startedAt) {
+		t.Error("container should not be restarted on reconnect")
+	}
+
+	// Live output resumes
+	ws2.WriteJSON(clientMessage{Type: msgInput, Data: "status\r"})
+	readOutputContaining(t, ws2, "status\r")
+}
+
+func TestWebSocket_AttachesToAlreadyRunningContainer(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, containerID := createTestSession(t, srv)
+
+	// e.g. a container adopted after a server restart
+	mockDocker.StartContainer(context.Background(), containerID)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	ws := dialTyped(t, srv, server.URL, sessionID)
+	defer ws.Close()
+
+	if status := readControl(t, ws, msgStatus); !status.Resumed {
+		t.Error("attaching to a running container should be a resume")
+	}
+
+	// No welcome screen: the first output is the container's own
+	ws.WriteJSON(clientMessage{Type: msgInput, Data: "ls\r"})
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	frameType, data, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatalf("expected output: %v", err)
+	}
+	if frameType != websocket.BinaryMessage || strings.Contains(string(data), "You awaken") {
+		t.Errorf("unexpected first output: %q", data)
+	}
+}
+
+func TestDeleteSession_ClosesWebSocket(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, _ := createTestSession(t, srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	ws := dialTyped(t, srv, server.URL, sessionID)
+	defer ws.Close()
+	readControl(t, ws, msgStatus)
+
+	srv.teardownSession(context.Background(), mustGetSession(t, srv, sessionID))
+
+	if msg := readControl(t, ws, msgExit); msg.Reason != endReasonTerminated {
+		t.Errorf("expected reason %q, got %q", endReasonTerminated, msg.Reason)
+	}
+	expectClose(t, ws, closeSessionEnded)
+}
+
+func TestSubscribe_ReplaysScrollbackBeforeLiveOutput(t *testing.T) {
+	term := &terminal{
+		scrollback: newRingBuffer(scrollbackSize),
+		clients:    make(map[*terminalConn]bool),
+	}
+	term.broadcast([]byte("earlier\r\n"))
+
+	// No writer, so the queue shows the order frames would be sent in
+	conn := &terminalConn{
+		protocol: ProtocolV1,
+		queue:    make(chan frame, sendQueueSize),
+		stopping: make(chan struct{}),
+	}
+	term.subscribe(conn)
+	term.broadcast([]byte("live\r\n"))
+
+	for _, want := range []string{"earlier\r\n", "live\r\n"} {
+		select {
+		case f := <-conn.queue:
+			if string(f.data) != want {
+				t.Errorf("expected %q, got %q", want, f.data)
+			}
+		default:
+			t.Fatalf("expected %q to be queued", want)
+		}
+	}
+}
+
+func TestBroadcast_DisconnectsSlowClient(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+	sessionID, _ := createTestSession(t, srv)
+	token := issueViewToken(t, srv, sessionID)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	player := dialTyped(t, srv, server.URL, sessionID)
+	defer player.Close()
+	readControl(t, player, msgStatus)
+	readOutputContaining(t, player, "You awaken")
+
+	// The spectator never reads, so its socket buffers and then its queue fill
+	spectator := dialSpectator(t, server.URL, token)
+	defer spectator.Close()
+	readControl(t, spectator, msgStatus)
+
+	// The player reads each chunk before the next is sent, until the marker
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		for {
+			player.SetReadDeadline(time.Now().Add(10 * time.Second))
+			_, data, err := player.ReadMessage()
+			if err != nil || strings.Contains(string(data), "marker") {
+				return
+			}
+			received <- struct{}{}
+		}
+	}()
+
+	term, _ := srv.liveTerminal(sessionID)
+	chunk := []byte(strings.Repeat("x", 32*1024) + "\r\n")
+	deadline := time.Now().Add(10 * time.Second)
+	for srv.terminalClients(sessionID) > 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the slow spectator to be disconnected")
+		}
+		start := time.Now()
+		term.broadcast(chunk)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("broadcast blocked on the slow client for %v", elapsed)
+		}
+		if _, ok := <-received; !ok {
+			t.Fatal("player stopped receiving output")
+		}
+	}
+
+	// The player is unaffected: still in control and receiving output
+	term.broadcast([]byte("marker\r\n"))
+	<-received
+	if srv.terminalClients(sessionID) != 1 {
+		t.Error("expected the player to stay connected")
+	}
+	player.WriteJSON(clientMessage{Type: msgInput, Data: "still here\r"})
+	readOutputContaining(t, player, "still here\r")
+}
+
+// slowInspect holds up inspecting one container until released
+type slowInspect struct {
+	docker.Client
+	containerID string
+	entered     chan struct{}
+	release     chan struct{}
+}
+
+func (c *slowInspect) InspectContainer(ctx context.Context, containerID string) (*docker.ContainerState, error) {
+	if containerID == c.containerID {
+		close(c.entered)
+		<-c.release
+	}
+	return c.Client.InspectContainer(ctx, containerID)
+}
+
+func TestOpenTerminal_SlowContainerDoesNotBlockOthers(t *testing.T) {
+	slow := &slowInspect{
+		Client:  docker.NewMockClient(),
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	srv := NewWithDockerClient(slow)
+	slowID, slowContainer := createTestSession(t, srv)
+	otherID, _ := createTestSession(t, srv)
+	slow.containerID = slowContainer
+
+	type opened struct {
+		term    *terminal
+		resumed bool
+		err     error
+	}
+	first, second := make(chan opened, 1), make(chan opened, 1)
+	go func() {
+		term, resumed, err := srv.openTerminal(mustGetSession(t, srv, slowID))
+		first <- opened{term, resumed, err}
+	}()
+	<-slow.entered
+
+	// Another session opens while the first is stuck in Docker
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := srv.openTerminal(mustGetSession(t, srv, otherID))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("failed to open other terminal: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("opening a terminal was blocked by another session's container")
+	}
+
+	// A second connection to the slow session waits for the same terminal
+	go func() {
+		term, resumed, err := srv.openTerminal(mustGetSession(t, srv, slowID))
+		second <- opened{term, resumed, err}
+	}()
+	close(slow.release)
+
+	a, b := <-first, <-second
+	if a.err != nil || b.err != nil {
+		t.Fatalf("failed to open terminal: %v, %v", a.err, b.err)
+	}
+	if a.term != b.term {
+		t.Error("expected both connections to share one terminal")
+	}
+	if a.resumed || !b.resumed {
+		t.Errorf("expected only the second connection to resume, got %v and %v", a.resumed, b.resumed)
+	}
+}
+
+// mustGetSession fetches a session or fails the test
+func mustGetSession(t *testing.T, srv *Server, sessionID string) *session.Session {
+	sess, exists := srv.sessionManager.GetSession(sessionID)
+	if !exists {
+		t.Fatalf("session %s should exist", sessionID)
+	}
+	return sess
+}
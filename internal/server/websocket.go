@@ -1,8 +1,8 @@
 package server
 
 import (
-	"context"
-	"io"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"sync"
@@ -15,12 +15,43 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    []string{ProtocolV1},
 	CheckOrigin: func(r *http.Request) bool {
 		// Allow all origins for now (restrict in production)
 		return true
 	},
 }
 
+// Terminal size bounds accepted from clients
+const (
+	maxTerminalRows = 500
+	maxTerminalCols = 1000
+)
+
+// resizeMessage is the control message a client sends when its terminal
+// dimensions change (including once right after connecting)
+type resizeMessage struct {
+	Type string `json:"type"`
+	Cols uint   `json:"cols"`
+	Rows uint   `json:"rows"`
+}
+
+// parseResizeMessage reports whether a client frame is a resize control
+// message rather than terminal input
+func parseResizeMessage(message []byte) (resizeMessage, bool) {
+	var msg resizeMessage
+	if len(message) == 0 || message[0] != '{' {
+		return msg, false
+	}
+	if err := json.Unmarshal(message, &msg); err != nil || msg.Type != "resize" {
+		return msg, false
+	}
+	if msg.Rows == 0 || msg.Cols == 0 || msg.Rows > maxTerminalRows || msg.Cols > maxTerminalCols {
+		return msg, false
+	}
+	return msg, true
+}
+
 // handleWebSocket upgrades the HTTP connection to WebSocket and bridges terminal I/O
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	sessionID := chi.URLParam(r, "id")
@@ -44,94 +75,103 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer ws.Close()
+	conn, disconnected := s.connectClient(ws, "player")
+	defer disconnected()
 
-	ctx := context.Background()
-
-	// Send welcome screen immediately via WebSocket
-	// This ensures the player sees it before container starts
-	// Use \r\n for proper terminal line endings
-	welcomeScreen := "" +
-		"\r\n" +
-		"\x1b[32m> BOOT SEQUENCE INITIATED\x1b[0m\r\n" +
-		"\x1b[32m> Loading soul.dat...\x1b[0m\r\n" +
-		"\x1b[33m> ERROR: Telomeres corrupted. Reverting to default state.\x1b[0m\r\n" +
-		"\x1b[32m> Consciousness fragmentation detected: 97.3%\x1b[0m\r\n" +
-		"\x1b[32m> You are: PID 2048\x1b[0m\r\n" +
-		"\x1b[32m> Location: /home\x1b[0m\r\n" +
-		"\x1b[32m> Year: 2600\x1b[0m\r\n" +
-		"\r\n" +
-		"    ███████╗██╗  ██╗███████╗██╗     ██╗      ██████╗██████╗  █████╗ ███████╗████████╗\r\n" +
-		"    ██╔════╝██║  ██║██╔════╝██║     ██║     ██╔════╝██╔══██╗██╔══██╗██╔════╝╚══██╔══╝\r\n" +
-		"    ███████╗███████║█████╗  ██║     ██║     ██║     ██████╔╝███████║█████╗     ██║   \r\n" +
-		"    ╚════██║██╔══██║██╔══╝  ██║     ██║     ██║     ██╔══██╗██╔══██║██╔══╝     ██║   \r\n" +
-		"    ███████║██║  ██║███████╗███████╗███████╗╚██████╗██║  ██║██║  ██║██║        ██║   \r\n" +
-		"    ╚══════╝╚═╝  ╚═╝╚══════╝╚══════╝╚══════╝ ╚═════╝╚═╝  ╚═╝╚═╝  ╚═╝╚═╝        ╚═╝   \r\n" +
-		"\r\n" +
-		"\x1b[36mYou awaken.\x1b[0m\r\n" +
-		"\r\n" +
-		"No — not awaken. You \x1b[1minstantiate\x1b[0m. You are a process now,\r\n" +
-		"not a person. The last thing you remember is... nothing.\r\n" +
-		"Just static. Just void.\r\n" +
-		"\r\n" +
-		"The system calls you \"Player\". You have no other name.\r\n" +
-		"\r\n" +
-		"A single file exists: \x1b[33msoul.dat\x1b[0m (100 bytes)\r\n" +
-		"This is all that remains of whoever you were.\r\n" +
-		"\r\n" +
-		"\x1b[32mType 'help' to begin.\x1b[0m\r\n" +
-		"\r\n"
-
-	ws.WriteMessage(websocket.TextMessage, []byte(welcomeScreen))
+	// Don't restart a game that has ended; tell the client why instead
+	if sess.Ended() {
+		closeEndedSession(conn, sess)
+		return
+	}
 
 	// Update activity timestamp immediately on WebSocket connection
 	s.sessionManager.UpdateActivity(sessionID)
 
-	// Start the container now (it was created but not started)
-	if err := s.dockerClient.StartContainer(ctx, sess.ContainerID); err != nil {
-		log.Printf("Failed to start container: %v", err)
-		ws.WriteMessage(websocket.TextMessage, []byte("Failed to start container\r\n"))
+	// Start or resume the session's terminal
+	term, resumed, err := s.openTerminal(sess)
+	if errors.Is(err, errGameEnded) {
+		if ended, exists := s.sessionManager.GetSession(sessionID); exists {
+			closeEndedSession(conn, ended)
+			return
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to open terminal for session %s: %v", sessionID, err)
+		conn.writeError("Failed to connect to container")
 		return
 	}
 
-	// Small delay to let container initialize
-	time.Sleep(100 * time.Millisecond)
-
-	// Attach to container
-	attach, err := s.dockerClient.AttachContainer(ctx, sess.ContainerID)
-	if err != nil {
-		log.Printf("Failed to attach to container: %v", err)
-		ws.WriteMessage(websocket.TextMessage, []byte("Failed to attach to container\r\n"))
+	// Only one connection may control a session. A second one is rejected
+	// unless it asks to take over, which disconnects the current controller.
+	takeover := r.URL.Query().Get("takeover") == "1"
+	displaced, ok := term.claim(conn, takeover)
+	if !ok {
+		log.Printf("Rejected second connection for session %s", sessionID)
+		conn.close(closeControllerActive, "Session is open in another window")
 		return
 	}
-	defer attach.Writer.Close()
+	defer term.release(conn)
+	if displaced != nil {
+		log.Printf("Connection took over session %s", sessionID)
+		term.unsubscribe(displaced)
+		displaced.close(closeTakenOver, "Session was taken over by another window")
+	}
+
+	// Tell typed clients the terminal is live, then replay recent output
+	// (the welcome screen for a fresh session) before live output resumes
+	conn.writeControl(serverMessage{
+		Type:      msgStatus,
+		Version:   protocolVersion,
+		SessionID: sessionID,
+		Status:    "running",
+		Resumed:   resumed,
+	})
+	term.subscribe(conn)
+	defer term.unsubscribe(conn)
 
 	// Create channels for coordination
 	done := make(chan struct{})
 	var wg sync.WaitGroup
 
-	// Goroutine 1: WebSocket -> Container (stdin)
+	// Goroutine 1: WebSocket -> Container (stdin and control messages)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		defer close(done)
 
 		for {
-			messageType, message, err := ws.ReadMessage()
+			msg, err := conn.readMessage()
 			if err != nil {
+				var protoErr *protocolError
+				if errors.As(err, &protoErr) {
+					conn.writeError(protoErr.Error())
+					continue
+				}
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
 					log.Printf("WebSocket read error: %v", err)
 				}
 				return
 			}
 
+			// Drop anything that raced with a takeover
+			if !term.isController(conn) {
+				return
+			}
+
 			// Update activity on every message
 			s.sessionManager.UpdateActivity(sessionID)
 
-			// Handle different message types
-			switch messageType {
-			case websocket.TextMessage, websocket.BinaryMessage:
+			switch msg.Type {
+			case msgResize:
+				// Resize the container TTY to match the browser terminal
+				if err := term.resize(msg.Rows, msg.Cols); err != nil {
+					log.Printf("Failed to resize terminal: %v", err)
+				}
+			case msgPing:
+				conn.writePong(msg.Timestamp)
+			case msgInput:
 				// Write to container stdin
-				if _, err := attach.Writer.Write(message); err != nil {
+				if err := term.write([]byte(msg.Data)); err != nil {
 					log.Printf("Failed to write to container: %v", err)
 					return
 				}
@@ -139,35 +179,8 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	// Goroutine 2: Container -> WebSocket (stdout/stderr)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-
-		buf := make([]byte, 8192)
-		for {
-			n, err := attach.Reader.Read(buf)
-			if err != nil {
-				if err != io.EOF {
-					log.Printf("Container read error: %v", err)
-				}
-				return
-			}
-
-			if n > 0 {
-				// Update activity on output
-				s.sessionManager.UpdateActivity(sessionID)
-
-				// Send to WebSocket
-				if err := ws.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
-					log.Printf("WebSocket write error: %v", err)
-					return
-				}
-			}
-		}
-	}()
-
-	// Goroutine 3: Ping to keep connection alive
+	// Goroutine 2: Ping to keep connection alive; close when the container's
+	// output ends so the read loop above returns
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -178,8 +191,11 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			select {
 			case <-done:
 				return
+			case <-term.done:
+				closeEnded(conn, term)
+				return
 			case <-ticker.C:
-				if err := ws.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
+				if err := conn.writeKeepalive(); err != nil {
 					log.Printf("Ping error: %v", err)
 					return
 				}
@@ -192,3 +208,36 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("WebSocket closed for session %s", sessionID)
 }
+
+// welcomeScreen is shown when a session's container first starts, before the
+// game's own output. Use \r\n for proper terminal line endings.
+const welcomeScreen = "" +
+	"\r\n" +
+	"\x1b[32m> BOOT SEQUENCE INITIATED\x1b[0m\r\n" +
+	"\x1b[32m> Loading soul.dat...\x1b[0m\r\n" +
+	"\x1b[33m> ERROR: Telomeres corrupted. Reverting to default state.\x1b[0m\r\n" +
+	"\x1b[32m> Consciousness fragmentation detected: 97.3%\x1b[0m\r\n" +
+	"\x1b[32m> You are: PID 2048\x1b[0m\r\n" +
+	"\x1b[32m> Location: /home\x1b[0m\r\n" +
+	"\x1b[32m> Year: 2600\x1b[0m\r\n" +
+	"\r\n" +
+	"    ███████╗██╗  ██╗███████╗██╗     ██╗      ██████╗██████╗  █████╗ ███████╗████████╗\r\n" +
+	"    ██╔════╝██║  ██║██╔════╝██║     ██║     ██╔════╝██╔══██╗██╔══██╗██╔════╝╚══██╔══╝\r\n" +
+	"    ███████╗███████║█████╗  ██║     ██║     ██║     ██████╔╝███████║█████╗     ██║   \r\n" +
+	"    ╚════██║██╔══██║██╔══╝  ██║     ██║     ██║     ██╔══██╗██╔══██║██╔══╝     ██║   \r\n" +
+	"    ███████║██║  ██║███████╗███████╗███████╗╚██████╗██║  ██║██║  ██║██║        ██║   \r\n" +
+	"    ╚══════╝╚═╝  ╚═╝╚══════╝╚══════╝╚══════╝ ╚═════╝╚═╝  ╚═╝╚═╝  ╚═╝╚═╝        ╚═╝   \r\n" +
+	"\r\n" +
+	"\x1b[36mYou awaken.\x1b[0m\r\n" +
+	"\r\n" +
+	"No — not awaken. You \x1b[1minstantiate\x1b[0m. You are a process now,\r\n" +
+	"not a person. The last thing you remember is... nothing.\r\n" +
+	"Just static. Just void.\r\n" +
+	"\r\n" +
+	"The system calls you \"Player\". You have no other name.\r\n" +
+	"\r\n" +
+	"A single file exists: \x1b[33msoul.dat\x1b[0m (100 bytes)\r\n" +
+	"This is all that remains of whoever you were.\r\n" +
+	"\r\n" +
+	"\x1b[32mType 'help' to begin.\x1b[0m\r\n" +
+	"\r\n"
@@ -25,7 +25,7 @@ func TestWebSocketConnection(t *testing.T) {
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/session/" + sessionID + "/ws"
 
 	// Connect via WebSocket
-	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, accessHeader(srv, sessionID))
 	if err != nil {
 		t.Fatalf("Failed to connect to WebSocket: %v", err)
 	}
@@ -76,7 +76,7 @@ func TestWebSocketEcho(t *testing.T) {
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/session/" + sessionID + "/ws"
 
 	// Connect via WebSocket
-	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, accessHeader(srv, sessionID))
 	if err != nil {
 		t.Fatalf("Failed to connect to WebSocket: %v", err)
 	}
@@ -123,7 +123,7 @@ func TestWebSocketConcurrentConnections(t *testing.T) {
 	for _, sessionID := range sessions {
 		go func(sid string) {
 			wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/session/" + sid + "/ws"
-			ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+			ws, _, err := websocket.DefaultDialer.Dial(wsURL, accessHeader(srv, sid))
 			if err != nil {
 				t.Errorf("Failed to connect to session %s: %v", sid, err)
 				done <- false
@@ -168,7 +168,7 @@ func TestWebSocketActivityTracking(t *testing.T) {
 	defer server.Close()
 
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/session/" + sessionID + "/ws"
-	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, accessHeader(srv, sessionID))
 	if err != nil {
 		t.Fatalf("Failed to connect: %v", err)
 	}
@@ -185,6 +185,57 @@ func TestWebSocketActivityTracking(t *testing.T) {
 	}
 }
 
+func TestWebSocketResize(t *testing.T) {
+	mockDocker := docker.NewMockClient()
+	srv := NewWithDockerClient(mockDocker)
+
+	sessionID, containerID := createTestSession(t, srv)
+
+	server := httptest.NewServer(srv.Router())
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/session/" + sessionID + "/ws"
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, accessHeader(srv, sessionID))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer ws.Close()
+
+	// Initial size sent on connect
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"resize","cols":132,"rows":43}`))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if height, width := mockDocker.GetTerminalSize(containerID); height == 43 && width == 132 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	height, width := mockDocker.GetTerminalSize(containerID)
+	t.Errorf("expected TTY 43x132, got %dx%d", height, width)
+}
+
+func TestParseResizeMessage(t *testing.T) {
+	tests := []struct {
+		input string
+		ok    bool
+	}{
+		{`{"type":"resize","cols":80,"rows":24}`, true},
+		{`{"type":"resize","cols":0,"rows":24}`, false},
+		{`{"type":"resize","cols":80,"rows":100000}`, false},
+		{`{"type":"other","cols":80,"rows":24}`, false},
+		{`{not json`, false},
+		{"ls -la\r", false},
+	}
+
+	for _, tt := range tests {
+		if _, ok := parseResizeMessage([]byte(tt.input)); ok != tt.ok {
+			t.Errorf("parseResizeMessage(%q) = %v, want %v", tt.input, ok, tt.ok)
+		}
+	}
+}
+
 // TestWebSocketContainerAttach tests attaching to a real container (integration test)
 func TestWebSocketContainerAttach(t *testing.T) {
 	if testing.Short() {
@@ -1,7 +1,9 @@
 package session
 
 import (
+	"crypto/subtle"
 	"fmt"
+	"log"
 	"sync"
 	"time"
 
@@ -10,23 +12,59 @@ import (
 
 // Session represents a player session
 type Session struct {
-	ID           string
-	ContainerID  string
-	CreatedAt    time.Time
-	LastActivity time.Time
+	ID           string    `json:"id"`
+	ContainerID  string    `json:"container_id"`
+	Image        string    `json:"image,omitempty"`
+	Profile      string    `json:"profile,omitempty"` // resource profile; the game's default if empty
+	ClientIP     string    `json:"client_ip,omitempty"`
+	PlayerToken  string    `json:"player_token,omitempty"`
+	ViewToken    string    `json:"view_token,omitempty"`
+	RecordingID  string    `json:"recording_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastActivity time.Time `json:"last_activity"`
+	IdleUntil    time.Time `json:"idle_until,omitzero"` // not idle before this, however long since activity
+
+	// Set once the session's container has exited on its own
+	EndedAt   time.Time `json:"ended_at,omitzero"`
+	EndReason string    `json:"end_reason,omitempty"`
+	ExitCode  int       `json:"exit_code,omitempty"`
+}
+
+// Ended reports whether the session's container has exited
+func (s *Session) Ended() bool {
+	return !s.EndedAt.IsZero()
 }
 
 // Manager handles session lifecycle and state
 type Manager struct {
-	mu       sync.RWMutex
-	sessions map[string]*Session
+	mu    sync.RWMutex
+	store Store
+
+	// Activity since the last flush. It changes with every keystroke and
+	// output chunk, so it is kept out of the store until FlushActivity.
+	activityMu sync.Mutex
+	activity   map[string]time.Time
 }
 
-// NewManager creates a new session manager
+// NewManager creates a new session manager backed by an in-memory store
 func NewManager() *Manager {
+	return NewManagerWithStore(NewMemoryStore())
+}
+
+// NewManagerWithStore creates a session manager backed by the given store
+func NewManagerWithStore(store Store) *Manager {
 	return &Manager{
-		sessions: make(map[string]*Session),
+		store:    store,
+		activity: make(map[string]time.Time),
+	}
+}
+
+// Close flushes recent activity and closes the underlying store
+func (m *Manager) Close() error {
+	if err := m.FlushActivity(); err != nil {
+		log.Printf("Failed to persist session activity: %v", err)
 	}
+	return m.store.Close()
 }
 
 // NewSession creates a new session and returns its unique ID
@@ -37,10 +75,12 @@ func (m *Manager) NewSession() string {
 	sessionID := uuid.New().String()
 	now := time.Now()
 
-	m.sessions[sessionID] = &Session{
+	if err := m.store.Put(&Session{
 		ID:           sessionID,
 		CreatedAt:    now,
 		LastActivity: now,
+	}); err != nil {
+		log.Printf("Failed to persist session %s: %v", sessionID, err)
 	}
 
 	return sessionID
@@ -51,7 +91,7 @@ func (m *Manager) AttachContainer(sessionID, containerID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	session, exists := m.sessions[sessionID]
+	session, exists := m.store.Get(sessionID)
 	if !exists {
 		return fmt.Errorf("session %s not found", sessionID)
 	}
@@ -59,7 +99,134 @@ func (m *Manager) AttachContainer(sessionID, containerID string) error {
 	session.ContainerID = containerID
 	session.LastActivity = time.Now()
 
-	return nil
+	return m.store.Put(session)
+}
+
+// SetPlayerToken associates a player's save vault token with a session
+func (m *Manager) SetPlayerToken(sessionID, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, exists := m.store.Get(sessionID)
+	if !exists {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+
+	session.PlayerToken = token
+
+	return m.store.Put(session)
+}
+
+// SetViewToken sets the token spectators use to watch a session, replacing
+// (and thereby revoking) any previous one
+func (m *Manager) SetViewToken(sessionID, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, exists := m.store.Get(sessionID)
+	if !exists {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+
+	session.ViewToken = token
+
+	return m.store.Put(session)
+}
+
+// SetGame records the image and resource profile a session runs
+func (m *Manager) SetGame(sessionID, image, profile string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, exists := m.store.Get(sessionID)
+	if !exists {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+
+	session.Image = image
+	session.Profile = profile
+
+	return m.store.Put(session)
+}
+
+// SetClientIP records the address of the client that created a session
+func (m *Manager) SetClientIP(sessionID, clientIP string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, exists := m.store.Get(sessionID)
+	if !exists {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+
+	session.ClientIP = clientIP
+
+	return m.store.Put(session)
+}
+
+// SetRecordingID marks a session as recorded to the given recording
+func (m *Manager) SetRecordingID(sessionID, recordingID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, exists := m.store.Get(sessionID)
+	if !exists {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+
+	session.RecordingID = recordingID
+
+	return m.store.Put(session)
+}
+
+// SetIdleUntil keeps a session from counting as idle before the given time
+func (m *Manager) SetIdleUntil(sessionID string, t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, exists := m.store.Get(sessionID)
+	if !exists {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+
+	session.IdleUntil = t
+
+	return m.store.Put(session)
+}
+
+// EndSession records that a session's container exited, and why
+func (m *Manager) EndSession(sessionID, reason string, exitCode int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, exists := m.store.Get(sessionID)
+	if !exists {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+
+	session.EndedAt = time.Now()
+	session.EndReason = reason
+	session.ExitCode = exitCode
+
+	return m.store.Put(session)
+}
+
+// GetSessionByViewToken finds the session a spectator view token belongs to
+func (m *Manager) GetSessionByViewToken(token string) (*Session, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if token == "" {
+		return nil, false
+	}
+
+	for _, session := range m.store.List() {
+		if subtle.ConstantTimeCompare([]byte(session.ViewToken), []byte(token)) == 1 {
+			m.withActivity(session)
+			return session, true
+		}
+	}
+	return nil, false
 }
 
 // DestroySession removes a session and returns the associated container ID
@@ -67,15 +234,20 @@ func (m *Manager) DestroySession(sessionID string) (string, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	session, exists := m.sessions[sessionID]
+	session, exists := m.store.Get(sessionID)
 	if !exists {
 		return "", fmt.Errorf("session %s not found", sessionID)
 	}
 
-	containerID := session.ContainerID
-	delete(m.sessions, sessionID)
+	if err := m.store.Delete(sessionID); err != nil {
+		return "", err
+	}
 
-	return containerID, nil
+	m.activityMu.Lock()
+	delete(m.activity, sessionID)
+	m.activityMu.Unlock()
+
+	return session.ContainerID, nil
 }
 
 // GetSession retrieves a session by ID
@@ -83,14 +255,12 @@ func (m *Manager) GetSession(sessionID string) (*Session, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	session, exists := m.sessions[sessionID]
-	if !exists {
-		return nil, false
+	// The store returns a copy to prevent external modification
+	session, exists := m.store.Get(sessionID)
+	if exists {
+		m.withActivity(session)
 	}
-
-	// Return a copy to prevent external modification
-	sessionCopy := *session
-	return &sessionCopy, true
+	return session, exists
 }
 
 // ListSessions returns all active sessions
@@ -98,49 +268,114 @@ func (m *Manager) ListSessions() []*Session {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	sessions := make([]*Session, 0, len(m.sessions))
-	for _, session := range m.sessions {
-		sessionCopy := *session
-		sessions = append(sessions, &sessionCopy)
-	}
-
+	sessions := m.store.List()
+	m.withActivity(sessions...)
 	return sessions
 }
 
-// UpdateActivity updates the last activity timestamp for a session
+// UpdateActivity updates the last activity timestamp for a session. It is
+// kept in memory until the next FlushActivity.
 func (m *Manager) UpdateActivity(sessionID string) {
+	m.activityMu.Lock()
+	defer m.activityMu.Unlock()
+
+	m.activity[sessionID] = time.Now()
+}
+
+// withActivity applies activity not yet flushed to copies of sessions
+func (m *Manager) withActivity(sessions ...*Session) {
+	m.activityMu.Lock()
+	defer m.activityMu.Unlock()
+
+	for _, session := range sessions {
+		if t, exists := m.activity[session.ID]; exists && t.After(session.LastActivity) {
+			session.LastActivity = t
+		}
+	}
+}
+
+// FlushActivity writes activity recorded since the last flush to the store
+func (m *Manager) FlushActivity() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if session, exists := m.sessions[sessionID]; exists {
-		session.LastActivity = time.Now()
+	m.activityMu.Lock()
+	pending := m.activity
+	m.activity = make(map[string]time.Time)
+	m.activityMu.Unlock()
+
+	var sessions []*Session
+	for sessionID, t := range pending {
+		session, exists := m.store.Get(sessionID)
+		if !exists || !t.After(session.LastActivity) {
+			continue
+		}
+		session.LastActivity = t
+		sessions = append(sessions, session)
 	}
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	return m.store.PutAll(sessions)
 }
 
-// GetIdleSessions returns sessions that have been idle for longer than the specified duration
+// GetIdleSessions returns sessions that have been idle for longer than the
+// specified duration and whose idle deadline (if extended) has passed
 func (m *Manager) GetIdleSessions(idleDuration time.Duration) []*Session {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	cutoff := time.Now().Add(-idleDuration)
+	now := time.Now()
+	cutoff := now.Add(-idleDuration)
 	var idleSessions []*Session
 
-	for _, session := range m.sessions {
-		if session.LastActivity.Before(cutoff) {
-			sessionCopy := *session
-			idleSessions = append(idleSessions, &sessionCopy)
+	sessions := m.store.List()
+	m.withActivity(sessions...)
+	for _, session := range sessions {
+		if session.LastActivity.Before(cutoff) && !now.Before(session.IdleUntil) {
+			idleSessions = append(idleSessions, session)
 		}
 	}
 
 	return idleSessions
 }
 
-// SetLastActivity manually sets the last activity time for a session (for testing)
+// GetEndedSessions returns sessions whose container exited longer ago than
+// the specified duration
+func (m *Manager) GetEndedSessions(after time.Duration) []*Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cutoff := time.Now().Add(-after)
+	var endedSessions []*Session
+
+	for _, session := range m.store.List() {
+		if session.Ended() && session.EndedAt.Before(cutoff) {
+			endedSessions = append(endedSessions, session)
+		}
+	}
+
+	return endedSessions
+}
+
+// SetLastActivity manually sets the last activity time for a session (for
+// testing), replacing any activity not yet flushed
 func (m *Manager) SetLastActivity(sessionID string, t time.Time) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if session, exists := m.sessions[sessionID]; exists {
-		session.LastActivity = t
+	m.activityMu.Lock()
+	delete(m.activity, sessionID)
+	m.activityMu.Unlock()
+
+	session, exists := m.store.Get(sessionID)
+	if !exists {
+		return
+	}
+
+	session.LastActivity = t
+	if err := m.store.Put(session); err != nil {
+		log.Printf("Failed to persist activity for session %s: %v", sessionID, err)
 	}
 }
@@ -165,11 +165,7 @@ func TestSessionManager_GetIdleSessions(t *testing.T) {
 	mgr.UpdateActivity(id2)
 
 	// Manually set the first session's timestamp to the past
-	mgr.mu.Lock()
-	if s, exists := mgr.sessions[id1]; exists {
-		s.LastActivity = time.Now().Add(-20 * time.Minute)
-	}
-	mgr.mu.Unlock()
+	mgr.SetLastActivity(id1, time.Now().Add(-20*time.Minute))
 
 	// Get sessions idle for more than 15 minutes
 	idle := mgr.GetIdleSessions(15 * time.Minute)
@@ -182,3 +178,119 @@ func TestSessionManager_GetIdleSessions(t *testing.T) {
 		t.Errorf("expected idle session %s, got %s", id1, idle[0].ID)
 	}
 }
+
+func TestSessionManager_ViewToken(t *testing.T) {
+	mgr := NewManager()
+
+	sessionID := mgr.NewSession()
+	if err := mgr.SetViewToken(sessionID, "token-1"); err != nil {
+		t.Fatalf("SetViewToken failed: %v", err)
+	}
+
+	session, exists := mgr.GetSessionByViewToken("token-1")
+	if !exists || session.ID != sessionID {
+		t.Fatalf("expected session %s for token, got %v", sessionID, session)
+	}
+
+	// Issuing a new token revokes the old one
+	mgr.SetViewToken(sessionID, "token-2")
+	if _, exists := mgr.GetSessionByViewToken("token-1"); exists {
+		t.Error("old view token should be revoked")
+	}
+
+	if _, exists := mgr.GetSessionByViewToken(""); exists {
+		t.Error("empty token should never match")
+	}
+
+	if err := mgr.SetViewToken("nonexistent", "token-3"); err == nil {
+		t.Error("expected error setting token on nonexistent session")
+	}
+}
+
+func TestSessionManager_EndSession(t *testing.T) {
+	mgr := NewManager()
+
+	sessionID := mgr.NewSession()
+	session, _ := mgr.GetSession(sessionID)
+	if session.Ended() {
+		t.Fatal("new session should not be ended")
+	}
+
+	if err := mgr.EndSession(sessionID, "oom", 137); err != nil {
+		t.Fatalf("EndSession failed: %v", err)
+	}
+
+	session, _ = mgr.GetSession(sessionID)
+	if !session.Ended() || session.EndReason != "oom" || session.ExitCode != 137 {
+		t.Errorf("unexpected ended session: %+v", session)
+	}
+
+	if ended := mgr.GetEndedSessions(time.Hour); len(ended) != 0 {
+		t.Errorf("session ended just now should not be past an hour, got %d", len(ended))
+	}
+	if ended := mgr.GetEndedSessions(0); len(ended) != 1 || ended[0].ID != sessionID {
+		t.Errorf("expected ended session %s, got %v", sessionID, ended)
+	}
+
+	if err := mgr.EndSession("nonexistent", "exited", 0); err == nil {
+		t.Error("expected error ending nonexistent session")
+	}
+}
+
+func TestSessionManager_SetGame(t *testing.T) {
+	mgr := NewManager()
+
+	sessionID := mgr.NewSession()
+	if err := mgr.SetGame(sessionID, "shellcraft/game:latest", "heavy"); err != nil {
+		t.Fatalf("SetGame failed: %v", err)
+	}
+
+	session, _ := mgr.GetSession(sessionID)
+	if session.Image != "shellcraft/game:latest" || session.Profile != "heavy" {
+		t.Errorf("unexpected game %q profile %q", session.Image, session.Profile)
+	}
+
+	if err := mgr.SetGame("nonexistent", "shellcraft/game:latest", ""); err == nil {
+		t.Error("expected error for nonexistent session")
+	}
+}
+
+func TestSessionManager_SetClientIP(t *testing.T) {
+	mgr := NewManager()
+
+	sessionID := mgr.NewSession()
+	if err := mgr.SetClientIP(sessionID, "203.0.113.7"); err != nil {
+		t.Fatalf("SetClientIP failed: %v", err)
+	}
+
+	if session, _ := mgr.GetSession(sessionID); session.ClientIP != "203.0.113.7" {
+		t.Errorf("expected client IP, got %q", session.ClientIP)
+	}
+
+	if err := mgr.SetClientIP("nonexistent", "203.0.113.7"); err == nil {
+		t.Error("expected error for nonexistent session")
+	}
+}
+
+func TestSessionManager_SetIdleUntil(t *testing.T) {
+	mgr := NewManager()
+
+	sessionID := mgr.NewSession()
+	mgr.SetLastActivity(sessionID, time.Now().Add(-20*time.Minute))
+	if err := mgr.SetIdleUntil(sessionID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("SetIdleUntil failed: %v", err)
+	}
+
+	if idle := mgr.GetIdleSessions(15 * time.Minute); len(idle) != 0 {
+		t.Errorf("expected extended session not to be idle, got %d", len(idle))
+	}
+
+	mgr.SetIdleUntil(sessionID, time.Now().Add(-time.Second))
+	if idle := mgr.GetIdleSessions(15 * time.Minute); len(idle) != 1 {
+		t.Errorf("expected session idle once its deadline passed, got %d", len(idle))
+	}
+
+	if err := mgr.SetIdleUntil("nonexistent", time.Now()); err == nil {
+		t.Error("expected error for nonexistent session")
+	}
+}
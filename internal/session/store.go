@@ -0,0 +1,179 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store persists session records. Implementations must be safe for concurrent
+// use and must return copies so callers cannot mutate stored state.
+type Store interface {
+	Get(sessionID string) (*Session, bool)
+	Put(session *Session) error
+	PutAll(sessions []*Session) error
+	Delete(sessionID string) error
+	List() []*Session
+	Close() error
+}
+
+// MemoryStore keeps sessions in an in-memory map (lost on restart)
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]*Session),
+	}
+}
+
+// Get returns a copy of the session with the given ID
+func (s *MemoryStore) Get(sessionID string) (*Session, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return nil, false
+	}
+
+	sessionCopy := *session
+	return &sessionCopy, true
+}
+
+// Put inserts or replaces a session
+func (s *MemoryStore) Put(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessionCopy := *session
+	s.sessions[session.ID] = &sessionCopy
+	return nil
+}
+
+// PutAll inserts or replaces several sessions
+func (s *MemoryStore) PutAll(sessions []*Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range sessions {
+		sessionCopy := *session
+		s.sessions[session.ID] = &sessionCopy
+	}
+	return nil
+}
+
+// Delete removes a session (no-op if it does not exist)
+func (s *MemoryStore) Delete(sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, sessionID)
+	return nil
+}
+
+// List returns copies of all stored sessions
+func (s *MemoryStore) List() []*Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessionCopy := *session
+		sessions = append(sessions, &sessionCopy)
+	}
+	return sessions
+}
+
+// Close releases store resources (no-op)
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// FileStore keeps sessions in memory and writes every change through to a
+// JSON file on disk, so sessions survive a server restart. The Manager
+// batches activity updates so they don't each rewrite the file.
+type FileStore struct {
+	*MemoryStore
+	path    string
+	writeMu sync.Mutex
+}
+
+// NewFileStore opens (or creates) a file-backed store at path
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read session store %s: %w", path, err)
+	}
+
+	if len(data) > 0 {
+		var sessions []*Session
+		if err := json.Unmarshal(data, &sessions); err != nil {
+			return nil, fmt.Errorf("decode session store %s: %w", path, err)
+		}
+		for _, session := range sessions {
+			s.sessions[session.ID] = session
+		}
+	}
+
+	return s, nil
+}
+
+// Put inserts or replaces a session and persists the store
+func (s *FileStore) Put(session *Session) error {
+	s.MemoryStore.Put(session)
+	return s.flush()
+}
+
+// PutAll inserts or replaces several sessions and persists the store once
+func (s *FileStore) PutAll(sessions []*Session) error {
+	s.MemoryStore.PutAll(sessions)
+	return s.flush()
+}
+
+// Delete removes a session and persists the store
+func (s *FileStore) Delete(sessionID string) error {
+	s.MemoryStore.Delete(sessionID)
+	return s.flush()
+}
+
+// flush atomically rewrites the store file (write temp file, then rename)
+func (s *FileStore) flush() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	data, err := json.MarshalIndent(s.List(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("write session store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write session store: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write session store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write session store: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
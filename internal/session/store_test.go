@@ -0,0 +1,122 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_ReturnsCopies(t *testing.T) {
+	store := NewMemoryStore()
+	store.Put(&Session{ID: "abc", ContainerID: "container-1"})
+
+	s, exists := store.Get("abc")
+	if !exists {
+		t.Fatal("session should exist")
+	}
+	s.ContainerID = "modified"
+
+	s2, _ := store.Get("abc")
+	if s2.ContainerID != "container-1" {
+		t.Errorf("store was modified through returned copy: %s", s2.ContainerID)
+	}
+}
+
+func TestFileStore_SurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	mgr := NewManagerWithStore(store)
+
+	kept := mgr.NewSession()
+	mgr.AttachContainer(kept, "container-kept")
+	idleSince := time.Now().Add(-20 * time.Minute).Truncate(time.Second)
+	mgr.SetLastActivity(kept, idleSince)
+
+	destroyed := mgr.NewSession()
+	mgr.AttachContainer(destroyed, "container-destroyed")
+	mgr.DestroySession(destroyed)
+	mgr.Close()
+
+	// Simulate a server restart by reopening the same file
+	store2, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reopening store failed: %v", err)
+	}
+	mgr2 := NewManagerWithStore(store2)
+
+	session, exists := mgr2.GetSession(kept)
+	if !exists {
+		t.Fatal("session should survive restart")
+	}
+	if session.ContainerID != "container-kept" {
+		t.Errorf("expected container ID 'container-kept', got %s", session.ContainerID)
+	}
+	if !session.LastActivity.Equal(idleSince) {
+		t.Errorf("expected LastActivity %v, got %v", idleSince, session.LastActivity)
+	}
+
+	if _, exists := mgr2.GetSession(destroyed); exists {
+		t.Error("destroyed session should not survive restart")
+	}
+}
+
+func TestFileStore_MissingFileStartsEmpty(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+
+	if len(store.List()) != 0 {
+		t.Errorf("expected empty store, got %d sessions", len(store.List()))
+	}
+}
+
+func TestFileStore_CorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	os.WriteFile(path, []byte("{not json"), 0o600)
+
+	if _, err := NewFileStore(path); err == nil {
+		t.Error("expected error opening corrupt store")
+	}
+}
+
+func TestFileStore_ActivityWrittenOnFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	mgr := NewManagerWithStore(store)
+	sessionID := mgr.NewSession()
+	created, _ := mgr.GetSession(sessionID)
+
+	// Activity is visible at once but doesn't rewrite the file
+	before, _ := os.ReadFile(path)
+	time.Sleep(10 * time.Millisecond)
+	mgr.UpdateActivity(sessionID)
+	if session, _ := mgr.GetSession(sessionID); !session.LastActivity.After(created.LastActivity) {
+		t.Error("expected LastActivity to be updated in memory")
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Error("activity should not be written until flushed")
+	}
+
+	// Closing flushes it
+	active, _ := mgr.GetSession(sessionID)
+	mgr.Close()
+
+	store2, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reopening store failed: %v", err)
+	}
+	session, _ := NewManagerWithStore(store2).GetSession(sessionID)
+	if !session.LastActivity.Equal(active.LastActivity) {
+		t.Errorf("expected LastActivity %v after restart, got %v", active.LastActivity, session.LastActivity)
+	}
+}
@@ -0,0 +1,159 @@
+// Package soul reads and writes the soul.dat save format described in SOUL_SPEC.md.
+//
+// Layout (little-endian): magic "SHC!" (4), version u16 (2), checksum u64 (8),
+// level u32 (4), xp u64 (8), quest slots [8]u32 (32), then HP encoded as that
+// many null "telomere" bytes. File size = HeaderSize + HP.
+package soul
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+)
+
+const (
+	// Magic identifies a soul file
+	Magic = "SHC!"
+
+	// Version is the newest format version this package understands
+	Version = 1
+
+	// HeaderSize is the size of the fixed header (everything except HP telomere)
+	HeaderSize = 58
+
+	// MaxLevel is the highest player level
+	MaxLevel = 42
+
+	// QuestSlots is the number of quest slots in the header
+	QuestSlots = 8
+)
+
+// Field offsets within the header
+const (
+	offsetVersion  = 0x04
+	offsetChecksum = 0x06
+	offsetLevel    = 0x0E
+	offsetXP       = 0x12
+	offsetQuests   = 0x1A
+)
+
+// Errors returned for corrupt or unsupported soul files. Decode and Encode
+// wrap these with details; match them with errors.Is.
+var (
+	ErrTooSmall           = errors.New("soul: file too small")
+	ErrBadMagic           = errors.New("soul: bad magic bytes")
+	ErrUnsupportedVersion = errors.New("soul: unsupported version")
+	ErrChecksumMismatch   = errors.New("soul: checksum mismatch")
+	ErrCorruptTelomere    = errors.New("soul: non-null telomere byte")
+	ErrInvalidLevel       = errors.New("soul: invalid level")
+	ErrInvalidHP          = errors.New("soul: invalid HP")
+)
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// Soul is a player's saved state
+type Soul struct {
+	Level  uint32
+	XP     uint64
+	Quests [QuestSlots]uint32
+	HP     uint32
+}
+
+// New returns a fresh level 0 soul at full HP
+func New() *Soul {
+	return &Soul{HP: MaxHP(0)}
+}
+
+// MaxHP returns the maximum HP for a level (100 + level*20)
+func MaxHP(level uint32) uint32 {
+	return 100 + level*20
+}
+
+// Validate checks the soul's data constraints
+func (s *Soul) Validate() error {
+	if s.Level > MaxLevel {
+		return fmt.Errorf("%w: %d (max %d)", ErrInvalidLevel, s.Level, MaxLevel)
+	}
+	if max := MaxHP(s.Level); s.HP > max {
+		return fmt.Errorf("%w: %d (max %d for level %d)", ErrInvalidHP, s.HP, max, s.Level)
+	}
+	return nil
+}
+
+// Checksum computes the value stored in the checksum field: CRC-64/ECMA over
+// the whole file with the checksum field itself treated as zero
+func Checksum(data []byte) uint64 {
+	if len(data) < HeaderSize {
+		return 0
+	}
+
+	var zero [8]byte
+	crc := crc64.Update(0, crcTable, data[:offsetChecksum])
+	crc = crc64.Update(crc, crcTable, zero[:])
+	return crc64.Update(crc, crcTable, data[offsetLevel:])
+}
+
+// Decode parses and validates a soul file. A checksum of zero is accepted
+// because the game (Perl) and quest tool (Rust) still write it as reserved.
+func Decode(data []byte) (*Soul, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("%w: %d bytes (need %d)", ErrTooSmall, len(data), HeaderSize)
+	}
+
+	if string(data[:offsetVersion]) != Magic {
+		return nil, fmt.Errorf("%w: %q", ErrBadMagic, data[:offsetVersion])
+	}
+
+	version := binary.LittleEndian.Uint16(data[offsetVersion:])
+	if version == 0 || version > Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	stored := binary.LittleEndian.Uint64(data[offsetChecksum:])
+	if stored != 0 {
+		if computed := Checksum(data); stored != computed {
+			return nil, fmt.Errorf("%w: stored %#x, computed %#x", ErrChecksumMismatch, stored, computed)
+		}
+	}
+
+	for i, b := range data[HeaderSize:] {
+		if b != 0 {
+			return nil, fmt.Errorf("%w at offset %#x", ErrCorruptTelomere, HeaderSize+i)
+		}
+	}
+
+	s := &Soul{
+		Level: binary.LittleEndian.Uint32(data[offsetLevel:]),
+		XP:    binary.LittleEndian.Uint64(data[offsetXP:]),
+		HP:    uint32(len(data) - HeaderSize),
+	}
+	for i := range s.Quests {
+		s.Quests[i] = binary.LittleEndian.Uint32(data[offsetQuests+4*i:])
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Encode serializes a valid soul, filling in the checksum field
+func (s *Soul) Encode() ([]byte, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, HeaderSize+int(s.HP))
+	copy(data, Magic)
+	binary.LittleEndian.PutUint16(data[offsetVersion:], Version)
+	binary.LittleEndian.PutUint32(data[offsetLevel:], s.Level)
+	binary.LittleEndian.PutUint64(data[offsetXP:], s.XP)
+	for i, quest := range s.Quests {
+		binary.LittleEndian.PutUint32(data[offsetQuests+4*i:], quest)
+	}
+	binary.LittleEndian.PutUint64(data[offsetChecksum:], Checksum(data))
+
+	return data, nil
+}
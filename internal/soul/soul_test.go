@@ -0,0 +1,111 @@
+package soul
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// legacySoul builds a soul file the way Player.pm writes it (checksum 0)
+func legacySoul(level uint32, xp uint64, hp int) []byte {
+	data := make([]byte, HeaderSize+hp)
+	copy(data, "SHC!")
+	binary.LittleEndian.PutUint16(data[4:], 1)
+	binary.LittleEndian.PutUint32(data[14:], level)
+	binary.LittleEndian.PutUint64(data[18:], xp)
+	binary.LittleEndian.PutUint32(data[26:], 7) // quest 7 in slot 0
+	return data
+}
+
+func TestRoundTrip(t *testing.T) {
+	original := &Soul{Level: 10, XP: 1_100_000_000_000, HP: 250}
+	original.Quests[0] = 3
+	original.Quests[7] = 9
+
+	data, err := original.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	if len(data) != HeaderSize+250 {
+		t.Errorf("expected file size %d, got %d", HeaderSize+250, len(data))
+	}
+	if binary.LittleEndian.Uint64(data[6:]) == 0 {
+		t.Error("expected checksum field to be filled in")
+	}
+
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if *decoded != *original {
+		t.Errorf("expected %+v, got %+v", original, decoded)
+	}
+}
+
+func TestDecode_LegacyZeroChecksum(t *testing.T) {
+	s, err := Decode(legacySoul(2, 4500, 120))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	if s.Level != 2 || s.XP != 4500 || s.HP != 120 || s.Quests[0] != 7 {
+		t.Errorf("unexpected soul: %+v", s)
+	}
+}
+
+func TestNew(t *testing.T) {
+	s := New()
+	if s.Level != 0 || s.HP != 100 {
+		t.Errorf("expected level 0 with 100 HP, got %+v", s)
+	}
+}
+
+func TestDecode_Corrupt(t *testing.T) {
+	valid, _ := (&Soul{Level: 1, XP: 10, HP: 50}).Encode()
+
+	tests := []struct {
+		name   string
+		mutate func([]byte) []byte
+		want   error
+	}{
+		{"too small", func(d []byte) []byte { return d[:HeaderSize-1] }, ErrTooSmall},
+		{"bad magic", func(d []byte) []byte { d[0] = 'X'; return d }, ErrBadMagic},
+		{"future version", func(d []byte) []byte { binary.LittleEndian.PutUint16(d[4:], 2); return d }, ErrUnsupportedVersion},
+		{"zero version", func(d []byte) []byte { binary.LittleEndian.PutUint16(d[4:], 0); return d }, ErrUnsupportedVersion},
+		{"tampered xp", func(d []byte) []byte { d[18]++; return d }, ErrChecksumMismatch},
+		{"extra hp", func(d []byte) []byte { return append(d, 0) }, ErrChecksumMismatch},
+		{"dirty telomere", func(d []byte) []byte { d[HeaderSize] = 1; return d }, ErrChecksumMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.mutate(append([]byte(nil), valid...))
+			if _, err := Decode(data); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestDecode_LegacyConstraints(t *testing.T) {
+	dirty := legacySoul(0, 0, 10)
+	dirty[HeaderSize+3] = 0xFF
+	if _, err := Decode(dirty); !errors.Is(err, ErrCorruptTelomere) {
+		t.Errorf("expected ErrCorruptTelomere, got %v", err)
+	}
+
+	if _, err := Decode(legacySoul(43, 0, 10)); !errors.Is(err, ErrInvalidLevel) {
+		t.Errorf("expected ErrInvalidLevel, got %v", err)
+	}
+
+	if _, err := Decode(legacySoul(0, 0, 101)); !errors.Is(err, ErrInvalidHP) {
+		t.Errorf("expected ErrInvalidHP, got %v", err)
+	}
+}
+
+func TestEncode_Invalid(t *testing.T) {
+	if _, err := (&Soul{Level: 1, HP: 500}).Encode(); !errors.Is(err, ErrInvalidHP) {
+		t.Errorf("expected ErrInvalidHP, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned when no soul is stored for a token
+var ErrNotFound = errors.New("soul not found")
+
+// ErrInvalidToken is returned for tokens that are not well-formed player tokens
+var ErrInvalidToken = errors.New("invalid player token")
+
+// Vault stores players' soul.dat files between sessions, keyed by player token
+type Vault interface {
+	Save(token string, soul []byte) error
+	Load(token string) ([]byte, error)
+	Delete(token string) error
+}
+
+// NewToken generates a new random player token
+func NewToken() string {
+	return uuid.New().String()
+}
+
+// ValidToken reports whether token is a well-formed player token
+func ValidToken(token string) bool {
+	_, err := uuid.Parse(token)
+	return err == nil
+}
+
+// MemoryVault keeps souls in memory (lost on restart)
+type MemoryVault struct {
+	mu    sync.RWMutex
+	souls map[string][]byte
+}
+
+// NewMemoryVault creates an empty in-memory vault
+func NewMemoryVault() *MemoryVault {
+	return &MemoryVault{
+		souls: make(map[string][]byte),
+	}
+}
+
+// Save stores a copy of soul under token
+func (v *MemoryVault) Save(token string, soul []byte) error {
+	if !ValidToken(token) {
+		return ErrInvalidToken
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.souls[token] = append([]byte(nil), soul...)
+	return nil
+}
+
+// Load returns a copy of the soul stored under token
+func (v *MemoryVault) Load(token string) ([]byte, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	soul, exists := v.souls[token]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), soul...), nil
+}
+
+// Delete forgets the soul stored under token (no-op if absent)
+func (v *MemoryVault) Delete(token string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	delete(v.souls, token)
+	return nil
+}
+
+// DirVault stores each soul as <token>.dat in a directory on disk
+type DirVault struct {
+	dir string
+}
+
+// NewDirVault opens (or creates) a vault directory
+func NewDirVault(dir string) (*DirVault, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create vault %s: %w", dir, err)
+	}
+	return &DirVault{dir: dir}, nil
+}
+
+// path returns the file path for token, rejecting malformed tokens so they
+// cannot escape the vault directory
+func (v *DirVault) path(token string) (string, error) {
+	if !ValidToken(token) {
+		return "", ErrInvalidToken
+	}
+	return filepath.Join(v.dir, token+".dat"), nil
+}
+
+// Save atomically writes soul under token
+func (v *DirVault) Save(token string, soul []byte) error {
+	path, err := v.path(token)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(v.dir, token+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("save soul: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(soul); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save soul: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save soul: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads the soul stored under token
+func (v *DirVault) Load(token string) ([]byte, error) {
+	path, err := v.path(token)
+	if err != nil {
+		return nil, err
+	}
+
+	soul, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return soul, err
+}
+
+// Delete removes the soul stored under token (no-op if absent)
+func (v *DirVault) Delete(token string) error {
+	path, err := v.path(token)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func testVault(t *testing.T, v Vault) {
+	token := NewToken()
+	soul := []byte("SHC!soul")
+
+	if _, err := v.Load(token); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for empty vault, got %v", err)
+	}
+
+	if err := v.Save(token, soul); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := v.Load(token)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !bytes.Equal(loaded, soul) {
+		t.Errorf("expected %q, got %q", soul, loaded)
+	}
+
+	if err := v.Delete(token); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := v.Load(token); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+
+	if err := v.Save("../../etc/passwd", soul); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken, got %v", err)
+	}
+}
+
+func TestMemoryVault(t *testing.T) {
+	testVault(t, NewMemoryVault())
+}
+
+func TestDirVault(t *testing.T) {
+	v, err := NewDirVault(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDirVault failed: %v", err)
+	}
+	testVault(t, v)
+}
+
+func TestDirVault_SurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	token := NewToken()
+
+	v1, _ := NewDirVault(dir)
+	v1.Save(token, []byte("persisted"))
+
+	v2, _ := NewDirVault(dir)
+	loaded, err := v2.Load(token)
+	if err != nil {
+		t.Fatalf("Load after reopen failed: %v", err)
+	}
+	if string(loaded) != "persisted" {
+		t.Errorf("expected 'persisted', got %q", loaded)
+	}
+}